@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,25 +13,52 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/jonas-koeritz/actioncam/download"
+	"github.com/jonas-koeritz/actioncam/dvr"
+	"github.com/jonas-koeritz/actioncam/fileproxy"
+	"github.com/jonas-koeritz/actioncam/hls"
 	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/library"
+	"github.com/jonas-koeritz/actioncam/mp4"
 	"github.com/jonas-koeritz/actioncam/rtsp"
+	"github.com/jonas-koeritz/actioncam/webdav"
 	"github.com/spf13/cobra"
 )
 
-func connectAndLogin(ip net.IP, port int, username, password string, verbose bool) *libipcamera.Camera {
+// gracefulShutdown is the annotation of commands that finish their work when interrupted
+const gracefulShutdown = "graceful-shutdown"
+
+// shutdownGracePeriod is the time gracefully shutting down commands get after the first signal
+const shutdownGracePeriod = 10 * time.Second
+
+func connectAndLogin(ip net.IP, profile *libipcamera.DeviceProfile, port int, username, password string, verbose bool) *libipcamera.Camera {
 	camera, err := libipcamera.CreateCamera(ip, port, username, password)
 	if err != nil {
 		log.Printf("ERROR instantiating camera: %s\n", err)
 		os.Exit(1)
 	}
 	camera.SetVerbose(verbose)
+	camera.SetProfile(profile)
 	camera.Connect()
 	camera.Login()
 
+	if profile == nil {
+		_, err = camera.DetectProfile()
+		if err != nil {
+			log.Printf("ERROR detecting device profile: %s\n", err)
+		}
+	}
+
 	return camera
 }
 
@@ -39,6 +67,7 @@ func main() {
 	var password string
 	var port int16
 	var verbose bool
+	var profileName string
 	var cpuprofile string
 	var memoryprofile string
 
@@ -48,31 +77,123 @@ func main() {
 
 	var applicationContext context.Context
 
+	// connectCamera connects to the camera at the given IP-Address (or discovers one if ip is nil),
+	// flags that have not been set explicitly default to the values of the selected device profile
+	connectCamera := func(cmd *cobra.Command, ip net.IP) *libipcamera.Camera {
+		var profile *libipcamera.DeviceProfile
+		if profileName != "auto" {
+			var err error
+			profile, err = libipcamera.ProfileByName(profileName)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if ip == nil {
+			var discoveredProfile *libipcamera.DeviceProfile
+			ip, discoveredProfile = discoverCamera(verbose)
+			if profile == nil && discoveredProfile != libipcamera.GenericProfile {
+				profile = discoveredProfile
+			}
+		}
+
+		if profile != nil {
+			if !cmd.Flags().Changed("port") {
+				port = int16(profile.ControlPort)
+			}
+			if !cmd.Flags().Changed("username") {
+				username = profile.Username
+			}
+			if !cmd.Flags().Changed("password") {
+				password = profile.Password
+			}
+		}
+
+		return connectAndLogin(ip, profile, int(port), username, password, verbose)
+	}
+
+	var previewListen string
+	// previewAddress returns the local address to receive the preview stream of the camera on.
+	// The camera always sends the preview to the port of its profile, only the interface can be chosen.
+	previewAddress := func() string {
+		if previewListen == "" {
+			return camera.PreviewAddress()
+		}
+		previewPort := strconv.Itoa(camera.Profile().PreviewPort)
+		host, port, err := net.SplitHostPort(previewListen)
+		if err != nil {
+			// Only the interface has been given
+			return net.JoinHostPort(previewListen, previewPort)
+		}
+		if port != previewPort {
+			log.Printf("ERROR: the camera sends the preview to port %s, --preview-address can only select the local interface\n", previewPort)
+			os.Exit(1)
+		}
+		return net.JoinHostPort(host, port)
+	}
+
+	var rtpDestination string
+
+	var saveStream string
 	var rootCmd = &cobra.Command{
 		Use:   "actioncam [Cameras IP Address]",
 		Short: "actioncam is a tool to stream the video preview of cheap action cameras without the mobile application",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			defer camera.Disconnect()
-			relay := libipcamera.CreateRTPRelay(applicationContext, net.ParseIP("127.0.0.1"), 5220)
+			destination, err := net.ResolveUDPAddr("udp", rtpDestination)
+			if err != nil {
+				log.Printf("ERROR invalid RTP destination: %s\n", err)
+				return
+			}
+			relay, err := libipcamera.CreateRTPRelay(applicationContext, previewAddress(), destination.IP, destination.Port)
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
 			defer relay.Stop()
 
+			if saveStream != "" {
+				out, err := os.Create(saveStream)
+				if err != nil {
+					log.Printf("ERROR creating %s: %s\n", saveStream, err)
+					return
+				}
+				defer out.Close()
+				unsubscribe := relay.Ingest().Subscribe(libipcamera.FrameSinkFunc(func(frame libipcamera.Frame) error {
+					_, err := out.Write(frame.Data)
+					return err
+				}))
+				defer unsubscribe()
+			}
+
 			camera.StartPreviewStream()
 
 			bufio.NewReader(os.Stdin).ReadBytes('\n')
 		},
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			signalChannel := make(chan os.Signal)
+			signalChannel := make(chan os.Signal, 1)
 			signal.Notify(signalChannel, os.Interrupt)
 			var cancel context.CancelFunc
 			applicationContext, cancel = context.WithCancel(context.Background())
+			// Commands annotated with gracefulShutdown get time to finish their output after the
+			// first signal, a second signal exits immediately
+			_, graceful := cmd.Annotations[gracefulShutdown]
 			go func(cancel context.CancelFunc) {
-				select {
-				case sig := <-signalChannel:
+				sig := <-signalChannel
+				cancel()
+				if !graceful {
 					log.Printf("Got signal %s, exiting...\n", sig)
-					cancel()
 					os.Exit(0)
 				}
+				log.Printf("Got signal %s, finishing (press Ctrl-C again to exit immediately)...\n", sig)
+				select {
+				case <-signalChannel:
+				case <-time.After(shutdownGracePeriod):
+					log.Printf("Could not finish within %s, exiting...\n", shutdownGracePeriod)
+				}
+				os.Exit(1)
 			}(cancel)
 
 			if cpuprofile != "" {
@@ -89,9 +210,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -117,36 +238,57 @@ func main() {
 		Version: "0.2.2",
 	}
 
+	rootCmd.Flags().StringVar(&saveStream, "save", "", "Additionally save the H.264 preview stream to a file")
+	rootCmd.PersistentFlags().StringVar(&rtpDestination, "rtp-destination", "127.0.0.1:5220", "Address the RTP stream of the preview is sent to (RTCP uses the next port)")
 	rootCmd.PersistentFlags().Int16VarP(&port, "port", "P", 6666, "Specify an alternative camera port to connect to")
 	rootCmd.PersistentFlags().StringVarP(&username, "username", "u", "admin", "Specify the camera username")
 	rootCmd.PersistentFlags().StringVarP(&password, "password", "p", "12345", "Specify the camera password")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print verbose output")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "auto", "Select the device profile of the camera (auto, act76, xpro2, generic)")
+	rootCmd.PersistentFlags().StringVar(&previewListen, "preview-address", "", "Local interface to receive the preview stream on (e.g. 192.168.1.100), the port is fixed by the device profile (default: all interfaces)")
 	rootCmd.PersistentFlags().StringVarP(&cpuprofile, "cpuprofile", "c", "", "Profile CPU usage")
 	rootCmd.PersistentFlags().StringVarP(&memoryprofile, "memoryprofile", "m", "", "Profile memory usage")
 
 	rootCmd.PersistentFlags().MarkHidden("cpuprofile")
 	rootCmd.PersistentFlags().MarkHidden("memoryprofile")
 
+	var kind string
 	var ls = &cobra.Command{
 		Use:   "ls [Cameras IP Address]",
 		Short: "List files stored on the cameras SD-Card",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			files, err := camera.GetFileList()
+			files, err := getFileList(camera)
 			if err != nil {
-				log.Printf("ERROR Receiving File List: %s\n", err)
 				return
 			}
 
+			if kind != "" {
+				fileKind, err := libipcamera.ParseFileKind(kind)
+				if err != nil {
+					log.Printf("ERROR: %s\n", err)
+					return
+				}
+				files = files.FilterByKind(fileKind)
+			}
+
 			for _, file := range files {
-				fmt.Printf("%s\t%d\n", file.Path, file.Size)
+				captureTime := "-"
+				if !file.CaptureTime.IsZero() {
+					captureTime = file.CaptureTime.Format("2006-01-02 15:04:05")
+				}
+				locked := ""
+				if file.Locked {
+					locked = "locked"
+				}
+				fmt.Printf("%s\t%d\t%s\t%s\t%s\n", file.Path, file.Size, file.Kind, captureTime, locked)
 			}
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -154,17 +296,20 @@ func main() {
 		},
 	}
 
+	ls.Flags().StringVar(&kind, "kind", "", "Only list files of the given kind (video, photo, thumbnail)")
+
 	var discover = &cobra.Command{
 		Use:   "discover",
 		Short: "Try to discover a camera by sending UDP broadcasts",
 		Args:  cobra.MaximumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			cameraIP, err := libipcamera.AutodiscoverCamera(verbose)
+			cameraIP, profile, err := libipcamera.DiscoverCamera(verbose)
 			if err != nil {
 				log.Printf("ERROR Discovering Camera: %s\n", err)
+				return
 			}
 
-			log.Printf("Found Camera: %+v\n", cameraIP)
+			log.Printf("Found Camera: %+v (Profile: %s)\n", cameraIP, profile)
 		},
 	}
 
@@ -177,9 +322,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -196,9 +341,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -215,9 +360,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -236,12 +381,13 @@ func main() {
 				return
 			}
 			log.Printf("Firmware Version: %s\n", firmware)
+			log.Printf("Device Profile: %s\n", libipcamera.ProfileForFirmware(firmware))
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -255,6 +401,7 @@ func main() {
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			rtspServer := rtsp.CreateServer(applicationContext, "127.0.0.1", 8554, camera)
+			rtspServer.PreviewAddress = previewAddress()
 			defer rtspServer.Stop()
 
 			log.Printf("Created RTSP Server\n")
@@ -266,9 +413,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -300,9 +447,9 @@ func main() {
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) != 2 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[1]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[1]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
@@ -310,78 +457,1185 @@ func main() {
 		},
 	}
 
+	var fetchOptions fileSelection
+	var outputDirectory string
+	var parallelDownloads int
+	var manifestFormat string
 	var fetch = &cobra.Command{
-		Use:   "fetch [Cameras IP Address]",
+		Use:   "fetch [Cameras IP Address] [Path Patterns]",
 		Short: "Download files from the cameras SD-Card",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Download files from the cameras SD-Card.
+
+Files can be selected using glob patterns matching the path or the name of a file,
+their capture time and kind. Without any selection the latest file is downloaded.
+Files with the same name in different directories are prefixed with their directory.`,
+		Args: cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			files, err := getFileList(camera)
+			if err != nil {
+				return
+			}
+
+			fetchOptions.patterns = patternArguments(args)
+			selected, err := fetchOptions.apply(files, time.Now())
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				return
+			}
+			if len(selected) == 0 {
+				log.Printf("No files matched the selection\n")
+				return
+			}
+
+			names, err := localNames(selected)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				return
+			}
+
+			err = os.MkdirAll(outputDirectory, 0755)
+			if err != nil {
+				log.Printf("ERROR creating output directory: %s\n", err)
+				return
+			}
+
+			manifest, err := openManifest(outputDirectory, manifestFormat)
+			if err != nil {
+				log.Printf("ERROR opening manifest: %s\n", err)
+				return
+			}
+
+			jobs := make([]download.Job, 0, len(selected))
+			sources := make(map[string]string)
+			for i, file := range selected {
+				job := download.Job{
+					URL:  camera.FileURL(file.Path),
+					Path: filepath.Join(outputDirectory, names[i]),
+					Size: file.Size,
+				}
+				jobs = append(jobs, job)
+				sources[job.Path] = file.Path
+			}
+
+			progress := download.NewTerminalProgress(os.Stderr, jobs)
+			manager := download.NewManager(parallelDownloads)
+			manager.OnProgress = func(p download.Progress) {
+				progress.Update(p)
+				addToManifest(manifest, p, sources[p.Job.Path])
+			}
+			err = manager.Download(applicationContext, jobs)
+			if err != nil {
+				log.Printf("ERROR downloading files: %s\n", err)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			camera = connectCamera(cmd, addressArgument(args))
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	fetch.Flags().StringVar(&fetchOptions.since, "since", "", "Only fetch files captured at or after this time (e.g. 2006-01-02, \"2006-01-02 15:04\" or 24h for the last day)")
+	fetch.Flags().StringVar(&fetchOptions.until, "until", "", "Only fetch files captured before this time")
+	fetch.Flags().StringVar(&fetchOptions.kind, "kind", "", "Only fetch files of the given kind (video, photo, thumbnail)")
+	fetch.Flags().BoolVar(&fetchOptions.all, "all", false, "Fetch all matching files")
+	fetch.Flags().IntVar(&fetchOptions.latest, "latest", 0, "Only fetch the latest N matching files")
+	fetch.Flags().StringVarP(&outputDirectory, "output", "o", ".", "Directory to save the downloaded files to")
+	fetch.Flags().IntVarP(&parallelDownloads, "parallel", "j", 2, "Number of files to download concurrently")
+	fetch.Flags().StringVar(&manifestFormat, "manifest", "sha256sum", "Format of the checksum manifest written alongside the downloads (sha256sum, json, none)")
+
+	var syncCmd = &cobra.Command{
+		Use:   "sync [Directory] [Cameras IP Address]",
+		Short: "Download all new files from the cameras SD-Card into a local directory",
+		Long: `Download all new files from the cameras SD-Card into a local directory.
+
+Files are organized into date-based folders, completed downloads are recorded
+in a state file inside the directory so interrupted runs can be resumed.`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			lib, err := library.Open(args[0])
+			if err != nil {
+				log.Printf("ERROR opening library: %s\n", err)
+				return
+			}
+
+			files, err := getFileList(camera)
+			if err != nil {
+				return
+			}
+
+			manifest, err := openManifest(lib.Dir(), manifestFormat)
+			if err != nil {
+				log.Printf("ERROR opening manifest: %s\n", err)
+				return
+			}
+
+			pending := lib.Pending(files)
+			if len(pending) == 0 {
+				log.Printf("Library is up to date (%d files)\n", len(files))
+				return
+			}
+
+			jobs := make([]download.Job, 0, len(pending))
+			pendingFiles := make(map[string]libipcamera.StoredFile)
+			for _, file := range pending {
+				job := download.Job{
+					URL:  camera.FileURL(file.Path),
+					Path: lib.LocalPath(file),
+					Size: file.Size,
+				}
+				jobs = append(jobs, job)
+				pendingFiles[job.Path] = file
+			}
+
+			added := make([]libipcamera.StoredFile, 0)
+			addedLock := sync.Mutex{}
+
+			progress := download.NewTerminalProgress(os.Stderr, jobs)
+			manager := download.NewManager(parallelDownloads)
+			manager.OnProgress = func(p download.Progress) {
+				progress.Update(p)
+				addToManifest(manifest, p, pendingFiles[p.Job.Path].Path)
+				if p.Done && p.Err == nil {
+					file := pendingFiles[p.Job.Path]
+					err := lib.MarkComplete(file)
+					if err != nil {
+						log.Printf("ERROR saving library state: %s\n", err)
+					}
+					addedLock.Lock()
+					added = append(added, file)
+					addedLock.Unlock()
+				}
+			}
+			err = manager.Download(applicationContext, jobs)
+			if err != nil {
+				log.Printf("ERROR synchronizing files: %s\n", err)
+			}
+
+			var addedBytes uint64
+			for _, file := range added {
+				addedBytes += file.Size
+			}
+			fmt.Printf("Added %d of %d new or changed files (%s) to %s, %d files were already up to date\n",
+				len(added), len(pending), download.FormatBytes(float64(addedBytes)), lib.Dir(), len(files)-len(pending))
+			for _, file := range added {
+				fmt.Printf("  %s\n", lib.LocalPath(file))
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[1]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	syncCmd.Flags().IntVarP(&parallelDownloads, "parallel", "j", 2, "Number of files to download concurrently")
+	syncCmd.Flags().StringVar(&manifestFormat, "manifest", "sha256sum", "Format of the checksum manifest written alongside the downloads (sha256sum, json, none)")
+
+	var thumbnailDirectory string
+	var thumbs = &cobra.Command{
+		Use:   "thumbs [Cameras IP Address]",
+		Short: "Fetch thumbnails of all videos on the cameras SD-Card and create an HTML contact sheet",
+		Long: `Fetch thumbnails of all videos on the cameras SD-Card and create an HTML contact sheet.
+
+The thumbnails created by the camera are used if the firmware provides them, otherwise
+the first key frame of each video is read and stored as a single frame MP4 file.`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			files, err := camera.GetFileList()
+			files, err := getFileList(camera)
+			if err != nil {
+				return
+			}
+
+			err = os.MkdirAll(thumbnailDirectory, 0755)
+			if err != nil {
+				log.Printf("ERROR creating output directory: %s\n", err)
+				return
+			}
+
+			thumbnails := make([]thumbnail, 0)
+			for _, video := range files.FilterByKind(libipcamera.KindVideo) {
+				if applicationContext.Err() != nil {
+					break
+				}
+				thumbnail, err := fetchThumbnail(applicationContext, camera, files, video, thumbnailDirectory)
+				if err != nil {
+					log.Printf("ERROR creating thumbnail of %s: %s\n", video.Path, err)
+					continue
+				}
+				log.Printf("Created thumbnail of %s\n", video.Path)
+				thumbnails = append(thumbnails, thumbnail)
+			}
+
+			err = writeContactSheet(thumbnailDirectory, thumbnails)
 			if err != nil {
-				log.Printf("ERROR Receiving File List: %s\n", err)
+				log.Printf("ERROR writing contact sheet: %s\n", err)
 				return
 			}
+			log.Printf("Wrote contact sheet of %d videos to %s\n", len(thumbnails), filepath.Join(thumbnailDirectory, "index.html"))
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	thumbs.Flags().StringVarP(&thumbnailDirectory, "output", "o", "thumbnails", "Directory to save the thumbnails and contact sheet to")
+
+	var listenAddress string
+	var webdavCmd = &cobra.Command{
+		Use:   "webdav [Cameras IP Address]",
+		Short: "Serve the cameras SD-Card as a read-only WebDAV share",
+		Long: `Serve the cameras SD-Card as a read-only WebDAV share.
+
+Directory listings are created from the cameras file list, file contents (including
+Range requests) are proxied to the HTTP server of the camera.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			server := &http.Server{
+				Addr:    listenAddress,
+				Handler: webdav.NewServer(camera),
+			}
+			go func() {
+				<-applicationContext.Done()
+				server.Close()
+			}()
 
-			newestFile := files[len(files)-1].Path
-			url := "http://" + args[0] + newestFile
-			log.Printf("Downloading latest File: %s\n", url)
-			downloadFile(filepath.Base(newestFile), url)
+			log.Printf("Serving WebDAV on %s\n", listenAddress)
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("ERROR serving WebDAV: %s\n", err)
+			}
 		},
 		PreRun: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				camera = connectAndLogin(discoverCamera(verbose), int(port), username, password, verbose)
+				camera = connectCamera(cmd, nil)
 			} else {
-				camera = connectAndLogin(net.ParseIP(args[0]), int(port), username, password, verbose)
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
 			}
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
 			camera.Disconnect()
 		},
 	}
+	webdavCmd.Flags().StringVar(&listenAddress, "listen", ":8080", "Address to listen on")
 
-	rootCmd.AddCommand(ls)
-	rootCmd.AddCommand(cmd)
-	rootCmd.AddCommand(still)
-	rootCmd.AddCommand(stop)
-	rootCmd.AddCommand(fetch)
-	rootCmd.AddCommand(record)
-	rootCmd.AddCommand(firmware)
-	rootCmd.AddCommand(rtsp)
-	rootCmd.AddCommand(discover)
+	var proxyAddress string
+	var cacheDirectory string
+	var cacheSize int64
+	var serveFiles = &cobra.Command{
+		Use:   "serve-files [Cameras IP Address]",
+		Short: "Serve the files on the cameras SD-Card through a local caching HTTP proxy",
+		Long: `Serve the files on the cameras SD-Card through a local caching HTTP proxy.
 
-	if err := rootCmd.Execute(); err != nil {
-		log.Println(err)
-		os.Exit(1)
+Files are downloaded from the camera once and kept in the cache directory, the least
+recently used files are removed when the cache exceeds its size. The root path lists
+all files as JSON, files are available at their path on the SD-Card.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if cacheDirectory == "" {
+				userCache, err := os.UserCacheDir()
+				if err != nil {
+					log.Printf("ERROR finding cache directory, use --cache-dir: %s\n", err)
+					return
+				}
+				cacheDirectory = filepath.Join(userCache, "actioncam")
+			}
+
+			cache, err := fileproxy.NewCache(cacheDirectory, cacheSize*1024*1024)
+			if err != nil {
+				log.Printf("ERROR opening cache: %s\n", err)
+				return
+			}
+
+			server := &http.Server{
+				Addr:    proxyAddress,
+				Handler: fileproxy.NewServer(camera, cache),
+			}
+			go func() {
+				<-applicationContext.Done()
+				server.Close()
+			}()
+
+			log.Printf("Serving files on %s (cache: %s, %s used)\n", proxyAddress, cacheDirectory, download.FormatBytes(float64(cache.Used())))
+			err = server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("ERROR serving files: %s\n", err)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
 	}
-}
+	serveFiles.Flags().StringVar(&proxyAddress, "listen", ":8081", "Address to listen on")
+	serveFiles.Flags().StringVar(&cacheDirectory, "cache-dir", "", "Directory to cache downloaded files in (default: the users cache directory)")
+	serveFiles.Flags().Int64Var(&cacheSize, "cache-size", 10240, "Maximum size of the cache in MiB")
 
-func downloadFile(filepath string, url string) error {
+	var offline bool
+	var verify = &cobra.Command{
+		Use:   "verify [Directory] [Cameras IP Address]",
+		Short: "Verify downloaded files against their checksum manifest and the cameras file list",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			manifest, err := download.LoadManifest(args[0])
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				os.Exit(1)
+			}
 
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+			var cameraFiles libipcamera.FileList
+			if camera != nil {
+				cameraFiles, err = getFileList(camera)
+				if err != nil {
+					os.Exit(1)
+				}
+			}
+
+			failures := 0
+			results := manifest.Verify()
+			for _, result := range results {
+				status := string(result.Status)
+				if result.Status != download.StatusOK {
+					failures++
+				} else if cameraFiles != nil {
+					cameraFile, found := findCameraFile(cameraFiles, result.Entry)
+					if found && cameraFile.Size != result.Size {
+						status = fmt.Sprintf("CAMERA SIZE MISMATCH (%d Bytes on camera)", cameraFile.Size)
+						failures++
+					} else if !found {
+						status += " (not on camera)"
+					}
+				}
+				fmt.Printf("%s: %s\n", result.Entry.Path, status)
+			}
+
+			fmt.Printf("Verified %d files, %d failed\n", len(results), failures)
+			if failures > 0 {
+				if camera != nil {
+					camera.Disconnect()
+				}
+				os.Exit(1)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if offline {
+				return
+			}
+			if len(args) != 2 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[1]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			if camera != nil {
+				camera.Disconnect()
+			}
+		},
 	}
-	defer resp.Body.Close()
+	verify.Flags().BoolVar(&offline, "offline", false, "Only verify the checksums without connecting to the camera")
 
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
+	var remote bool
+	var info = &cobra.Command{
+		Use:   "info [File] [Cameras IP Address]",
+		Short: "Show the metadata of an MP4/MOV file",
+		Long: `Show the metadata of an MP4/MOV file (duration, resolution, frame rate, codec,
+creation time and vendor specific user data).
+
+With --remote the file is read from the cameras SD-Card using HTTP Range requests,
+it can be given by its path or name on the SD-Card.`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var reader io.ReaderAt
+			var size int64
+			name := args[0]
+
+			if remote {
+				files, err := getFileList(camera)
+				if err != nil {
+					return
+				}
+				var stored *libipcamera.StoredFile
+				for i := range files {
+					if files[i].Path == name || files[i].Name() == path.Base(name) {
+						stored = &files[i]
+						break
+					}
+				}
+				if stored == nil {
+					log.Printf("ERROR: %s not found on the SD-Card\n", name)
+					return
+				}
+				remoteFile := camera.OpenFile(applicationContext, *stored)
+				reader, size, name = remoteFile, remoteFile.Size(), stored.Path
+			} else {
+				file, err := os.Open(name)
+				if err != nil {
+					log.Printf("ERROR: %s\n", err)
+					return
+				}
+				defer file.Close()
+				stat, err := file.Stat()
+				if err != nil {
+					log.Printf("ERROR: %s\n", err)
+					return
+				}
+				reader, size = file, stat.Size()
+			}
+
+			file, err := mp4.Open(reader, size)
+			if err != nil {
+				log.Printf("ERROR parsing %s: %s\n", name, err)
+				return
+			}
+			err = printMediaInfo(os.Stdout, name, size, file)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if !remote {
+				return
+			}
+			if len(args) != 2 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[1]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			if camera != nil {
+				camera.Disconnect()
+			}
+		},
 	}
-	defer out.Close()
+	info.Flags().BoolVar(&remote, "remote", false, "Read the file from the cameras SD-Card")
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	var probeDuration time.Duration
+	var probe = &cobra.Command{
+		Use:   "probe [Cameras IP Address]",
+		Short: "Analyze the H.264 preview stream of the camera",
+		Long: `Analyze the H.264 preview stream of the camera.
+
+Captures the preview for a few seconds and reports the stream parameters (profile, level,
+resolution and frame rate from the SPS), the GOP length, the bitrate and the jitter of
+the frame intervals as stamped by the camera and as received.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+			frames, unsubscribe := ingest.Frames()
+			defer unsubscribe()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+			log.Printf("Capturing the preview stream for %s\n", probeDuration)
+
+			result := newStreamProbe()
+			timeout := time.After(probeDuration)
+		capture:
+			for {
+				select {
+				case frame, ok := <-frames:
+					if !ok {
+						break capture
+					}
+					result.add(frame)
+				case <-timeout:
+					break capture
+				case <-applicationContext.Done():
+					break capture
+				}
+			}
+
+			err = result.report(os.Stdout)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	probe.Flags().DurationVar(&probeDuration, "duration", 5*time.Second, "Time to capture the preview stream for")
+
+	var sdpCmd = &cobra.Command{
+		Use:   "sdp [Cameras IP Address]",
+		Short: "Print an SDP file describing the RTP stream of the preview",
+		Long: `Print an SDP file describing the RTP stream of the preview.
+
+The preview is started until the SPS and PPS of the stream have been received, they are
+included in the SDP (sprop-parameter-sets) so players can start decoding immediately.
+The SDP describes the stream sent to --rtp-destination (127.0.0.1:5220 by default).`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			destination, err := net.ResolveUDPAddr("udp", rtpDestination)
+			if err != nil {
+				log.Printf("ERROR invalid RTP destination: %s\n", err)
+				return
+			}
+
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(applicationContext, 10*time.Second)
+			defer cancel()
+			parameterSets, err := ingest.ParameterSets(ctx)
+			if err != nil {
+				log.Printf("ERROR receiving the parameter sets of the stream: %s\n", err)
+				return
+			}
+			fmt.Print(parameterSets.SessionDescription(destination.IP, destination.Port))
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+
+	var captureOutput string
+	var captureFormatName string
+	var captureDuration time.Duration
+	var capture = &cobra.Command{
+		Use:   "capture [Output] [Cameras IP Address]",
+		Short: "Record the preview stream to an MP4 or MPEG-TS file or stream",
+		Long: `Record the preview stream to a fragmented MP4 file or as MPEG transport stream.
+
+The output is a file, - for stdout, udp://host:port (multicast groups are supported) or
+tcp://host:port. The format is derived from the output unless selected with --format:
+network outputs and files ending in .ts use MPEG-TS, files ending in .h264 the raw H.264
+elementary stream (Annex-B), everything else MP4.
+
+Recording starts with the first key frame and stops after --duration or when interrupted
+(Ctrl-C), the file is finalized in both cases. Without --duration the preview is recorded
+until interrupted.
+
+  actioncam capture --out preview.mp4 --duration 60s
+  actioncam capture -f mpegts - | ffplay -
+  actioncam capture udp://239.0.0.1:1234`,
+		Args:        cobra.MaximumNArgs(2),
+		Annotations: map[string]string{gracefulShutdown: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			// Arguments that are no IP address select the output
+			for _, arg := range args {
+				if net.ParseIP(arg) == nil {
+					captureOutput = arg
+				}
+			}
+			format, err := captureFormat(captureFormatName, captureOutput)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				return
+			}
+			if captureOutput == "" {
+				captureOutput = "preview" + formatExtensions[format]
+			}
+
+			out, err := openCaptureOutput(captureOutput)
+			if err != nil {
+				log.Printf("ERROR opening %s: %s\n", captureOutput, err)
+				return
+			}
+			defer out.Close()
+
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+
+			recorder := newRecorder(format, out)
+			unsubscribe := ingest.Subscribe(recorder)
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				unsubscribe()
+				return
+			}
+			log.Printf("Recording the preview stream to %s (%s)\n", captureOutput, format)
+
+			var timeout <-chan time.Time
+			if captureDuration > 0 {
+				timeout = time.After(captureDuration)
+			}
+			select {
+			case <-timeout:
+			case <-applicationContext.Done():
+			}
+
+			unsubscribe()
+			err = recorder.Close()
+			if err != nil {
+				log.Printf("ERROR finalizing %s: %s\n", captureOutput, err)
+				return
+			}
+			log.Printf("Recorded %d frames (%s) to %s\n", recorder.Frames(), recorder.Duration(), captureOutput)
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			var ip net.IP
+			for _, arg := range args {
+				if parsed := net.ParseIP(arg); parsed != nil {
+					ip = parsed
+				}
+			}
+			camera = connectCamera(cmd, ip)
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	capture.Flags().StringVarP(&captureOutput, "out", "o", "", "File or address to record the preview to (default: preview.mp4, .ts or .h264)")
+	capture.Flags().StringVarP(&captureFormatName, "format", "f", "auto", "Container format (auto, mp4, mpegts, h264)")
+	capture.Flags().DurationVar(&captureDuration, "duration", 0, "Time to record (default: until interrupted)")
+
+	var pipe = &cobra.Command{
+		Use:   "pipe [Cameras IP Address]",
+		Short: "Write the preview as raw H.264 stream to stdout",
+		Long: `Write the preview as raw H.264 elementary stream (Annex-B) to stdout.
+
+The stream starts with the first key frame, the SPS and PPS are repeated before every key
+frame. Frames are written as soon as they are received to keep the latency low.
+
+  actioncam pipe | ffplay -f h264 -fflags nobuffer -
+  actioncam pipe | ffmpeg -f h264 -i - -c copy preview.mkv`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+
+			// Stop when the reading process exits, without ignoring SIGPIPE the process would be
+			// killed by the first write to the closed pipe instead of receiving EPIPE
+			signal.Ignore(syscall.SIGPIPE)
+			closed := make(chan struct{})
+			var once sync.Once
+			recorder := libipcamera.NewAnnexBRecorder(os.Stdout)
+			unsubscribe := ingest.Subscribe(libipcamera.FrameSinkFunc(func(frame libipcamera.Frame) error {
+				err := recorder.WriteFrame(frame)
+				if err != nil {
+					once.Do(func() { close(closed) })
+				}
+				return err
+			}))
+			defer unsubscribe()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+
+			select {
+			case <-closed:
+			case <-applicationContext.Done():
+			}
+			recorder.Close()
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+
+	var hlsAddress string
+	var hlsFormat string
+	var hlsSegmentDuration time.Duration
+	var hlsWindowSize int
+	var hlsCmd = &cobra.Command{
+		Use:   "hls [Cameras IP Address]",
+		Short: "Serve the preview via HTTP Live Streaming for browsers",
+		Long: `Serve the preview via HTTP Live Streaming (HLS) for browsers.
+
+The preview is split into segments at key frames, the root path serves a page playing
+the stream, the playlist is available at /stream.m3u8. fMP4 segments are additionally
+published in parts for low latency clients (LL-HLS), MPEG-TS segments are supported by
+older players. Only the last segments of the stream are kept in memory.
+
+Browsers without native HLS support (everything but Safari) load the hls.js player from
+cdn.jsdelivr.net, which requires internet access in addition to the cameras Wi-Fi. Without
+internet access open the playlist in a player like VLC or ffplay instead.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			segmenter, err := hls.NewServer(hlsFormat)
+			if err != nil {
+				log.Printf("ERROR: %s\n", err)
+				return
+			}
+			if hlsWindowSize < 1 || hlsSegmentDuration <= 0 {
+				log.Printf("ERROR: the window must contain at least one segment of a positive duration\n")
+				return
+			}
+			segmenter.SegmentDuration = hlsSegmentDuration
+			segmenter.WindowSize = hlsWindowSize
+
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+			unsubscribe := ingest.Subscribe(segmenter)
+			defer unsubscribe()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+
+			server := &http.Server{
+				Addr:    hlsAddress,
+				Handler: segmenter,
+			}
+			go func() {
+				<-applicationContext.Done()
+				server.Close()
+			}()
+
+			log.Printf("Serving HLS on %s\n", hlsAddress)
+			err = server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("ERROR serving HLS: %s\n", err)
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	hlsCmd.Flags().StringVar(&hlsAddress, "listen", ":8080", "Address to listen on")
+	hlsCmd.Flags().StringVar(&hlsFormat, "format", hls.FormatFMP4, "Segment format (fmp4, ts)")
+	hlsCmd.Flags().DurationVar(&hlsSegmentDuration, "segment", hls.DefaultSegmentDuration, "Target duration of the segments, segments start at key frames")
+	hlsCmd.Flags().IntVar(&hlsWindowSize, "window", hls.DefaultWindowSize, "Number of segments kept in memory and listed in the playlist")
+
+	var dvrDirectory string
+	var dvrFormat string
+	var dvrSegmentDuration time.Duration
+	var dvrRetention time.Duration
+	var dvrTimeout time.Duration
+	var dvrCmd = &cobra.Command{
+		Use:   "dvr [Cameras IP Address]",
+		Short: "Continuously record the preview to segments (dashcam mode)",
+		Long: `Continuously record the preview to segments named after their start time (dashcam mode).
+
+A new segment is started at the first key frame after the segment duration, segments
+older than the retention time are deleted. If the camera stops sending the preview or the
+connection is lost, the camera is reconnected and a new segment is started.`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{gracefulShutdown: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			if dvrFormat != formatMP4 && dvrFormat != formatMPEGTS {
+				log.Printf("ERROR: Unknown format %s (mp4, mpegts)\n", dvrFormat)
+				return
+			}
+			if dvrSegmentDuration <= 0 {
+				log.Printf("ERROR: the segment duration has to be positive\n")
+				return
+			}
+			err := os.MkdirAll(dvrDirectory, 0755)
+			if err != nil {
+				log.Printf("ERROR creating %s: %s\n", dvrDirectory, err)
+				return
+			}
+
+			recorder := dvr.NewRecorder(dvrDirectory, formatExtensions[dvrFormat], func(w io.Writer) dvr.SegmentWriter {
+				return newRecorder(dvrFormat, w)
+			})
+			recorder.SegmentDuration = dvrSegmentDuration
+			recorder.Retention = dvrRetention
+			defer func() {
+				err := recorder.Close()
+				if err != nil {
+					log.Printf("ERROR finalizing segment: %s\n", err)
+				}
+				log.Printf("Recorded %d segments to %s\n", recorder.Segments(), dvrDirectory)
+			}()
+
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+			unsubscribe := ingest.Subscribe(recorder)
+			defer unsubscribe()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+			}
+			log.Printf("Recording the preview stream to %s\n", dvrDirectory)
+
+			// Reconnect when the connection is lost or no frames have been received for too long
+			lastAttempt := time.Now()
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-applicationContext.Done():
+					return
+				case <-ticker.C:
+				}
+
+				lastActivity := recorder.LastFrame()
+				if lastAttempt.After(lastActivity) {
+					lastActivity = lastAttempt
+				}
+				if camera.IsConnected() && time.Since(lastActivity) < dvrTimeout {
+					continue
+				}
+
+				log.Printf("Lost the preview stream, reconnecting to the camera\n")
+				lastAttempt = time.Now()
+				recorder.Split()
+				err := camera.Reconnect()
+				if err == nil {
+					err = camera.StartPreviewStream()
+				}
+				if err != nil {
+					log.Printf("ERROR reconnecting: %s\n", err)
+				}
+			}
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	dvrCmd.Flags().StringVar(&dvrDirectory, "dir", "clips", "Directory to save the segments to")
+	dvrCmd.Flags().StringVarP(&dvrFormat, "format", "f", formatMP4, "Container format of the segments (mp4, mpegts)")
+	dvrCmd.Flags().DurationVar(&dvrSegmentDuration, "segment", dvr.DefaultSegmentDuration, "Duration of the segments")
+	dvrCmd.Flags().DurationVar(&dvrRetention, "keep", dvr.DefaultRetention, "Delete segments older than this (0 keeps all segments)")
+	dvrCmd.Flags().DurationVar(&dvrTimeout, "timeout", 10*time.Second, "Reconnect if no frames have been received for this long")
+
+	var snapshotOutput string
+	var snapshotTimeout time.Duration
+	var snapshot = &cobra.Command{
+		Use:   "snapshot [Cameras IP Address]",
+		Short: "Save the next key frame of the preview as local snapshot",
+		Long: `Save the next key frame (IDR) of the preview as local snapshot.
+
+Unlike still, no picture is taken on the SD-Card. Files ending in .mp4 contain a single
+frame MP4, all other outputs (including "-" for stdout) receive the raw H.264 access unit
+including its SPS and PPS. Use ffmpeg to convert the snapshot to an image:
+
+  actioncam snapshot --out frame.h264
+  ffmpeg -i frame.h264 -frames:v 1 frame.jpg`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ingest, err := libipcamera.CreateStreamIngest(applicationContext, previewAddress())
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer ingest.Stop()
+
+			ctx, cancel := context.WithTimeout(applicationContext, snapshotTimeout)
+			defer cancel()
+			snapshotReady := make(chan libipcamera.Frame, 1)
+			snapshotError := make(chan error, 1)
+			go func() {
+				frame, err := ingest.Snapshot(ctx)
+				if err != nil {
+					snapshotError <- err
+					return
+				}
+				snapshotReady <- frame
+			}()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+
+			var frame libipcamera.Frame
+			select {
+			case frame = <-snapshotReady:
+			case err := <-snapshotError:
+				log.Printf("ERROR waiting for a key frame: %s\n", err)
+				return
+			}
+
+			var out io.WriteCloser = stdoutOutput{os.Stdout}
+			if snapshotOutput != "-" {
+				out, err = os.Create(snapshotOutput)
+				if err != nil {
+					log.Printf("ERROR creating %s: %s\n", snapshotOutput, err)
+					return
+				}
+			}
+			defer out.Close()
+
+			if strings.HasSuffix(strings.ToLower(snapshotOutput), ".mp4") {
+				err = libipcamera.WriteSnapshotMP4(out, frame)
+			} else {
+				_, err = out.Write(frame.Data)
+			}
+			if err != nil {
+				log.Printf("ERROR writing %s: %s\n", snapshotOutput, err)
+				return
+			}
+			log.Printf("Saved snapshot to %s\n", snapshotOutput)
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	snapshot.Flags().StringVarP(&snapshotOutput, "out", "o", "snapshot.mp4", "File to save the snapshot to (.mp4 or raw H.264, - for stdout)")
+	snapshot.Flags().DurationVar(&snapshotTimeout, "timeout", 10*time.Second, "Time to wait for a key frame")
+
+	var statsInterval time.Duration
+	var statsCmd = &cobra.Command{
+		Use:   "stats [Cameras IP Address]",
+		Short: "Show live statistics of the preview stream",
+		Long: `Show live statistics of the preview stream while relaying it via RTP.
+
+Shows the frame rate, the bitrate, the number of lost and invalid packets, messages of
+unknown types and the longest gap between two frames. The totals are printed when
+interrupted with Ctrl-C.`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{gracefulShutdown: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			if statsInterval <= 0 {
+				log.Printf("ERROR: the interval has to be positive\n")
+				return
+			}
+			destination, err := net.ResolveUDPAddr("udp", rtpDestination)
+			if err != nil {
+				log.Printf("ERROR invalid RTP destination: %s\n", err)
+				return
+			}
+			relay, err := libipcamera.CreateRTPRelay(applicationContext, previewAddress(), destination.IP, destination.Port)
+			if err != nil {
+				log.Printf("ERROR receiving preview stream: %s\n", err)
+				return
+			}
+			defer relay.Stop()
+
+			err = camera.StartPreviewStream()
+			if err != nil {
+				log.Printf("ERROR starting preview stream: %s\n", err)
+				return
+			}
+
+			// Redraw a single line on terminals, print a line per interval otherwise
+			terminal := download.IsTerminal(os.Stdout)
+			ticker := time.NewTicker(statsInterval)
+			defer ticker.Stop()
+		monitor:
+			for {
+				select {
+				case <-ticker.C:
+					line := formatStats(relay.Stats())
+					if terminal {
+						fmt.Printf("\r\x1b[K%s", line)
+					} else {
+						fmt.Println(line)
+					}
+				case <-applicationContext.Done():
+					break monitor
+				}
+			}
+
+			if terminal {
+				fmt.Println()
+			}
+			reportStats(os.Stdout, relay.Stats())
+		},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				camera = connectCamera(cmd, nil)
+			} else {
+				camera = connectCamera(cmd, net.ParseIP(args[0]))
+			}
+		},
+		PostRun: func(cmd *cobra.Command, args []string) {
+			camera.Disconnect()
+		},
+	}
+	statsCmd.Flags().DurationVar(&statsInterval, "interval", time.Second, "Time between two updates")
+
+	rootCmd.AddCommand(ls)
+	rootCmd.AddCommand(cmd)
+	rootCmd.AddCommand(still)
+	rootCmd.AddCommand(stop)
+	rootCmd.AddCommand(fetch)
+	rootCmd.AddCommand(record)
+	rootCmd.AddCommand(firmware)
+	rootCmd.AddCommand(rtsp)
+	rootCmd.AddCommand(discover)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(verify)
+	rootCmd.AddCommand(thumbs)
+	rootCmd.AddCommand(webdavCmd)
+	rootCmd.AddCommand(serveFiles)
+	rootCmd.AddCommand(info)
+	rootCmd.AddCommand(probe)
+	rootCmd.AddCommand(sdpCmd)
+	rootCmd.AddCommand(capture)
+	rootCmd.AddCommand(pipe)
+	rootCmd.AddCommand(hlsCmd)
+	rootCmd.AddCommand(dvrCmd)
+	rootCmd.AddCommand(snapshot)
+	rootCmd.AddCommand(statsCmd)
+
+	if err := rootCmd.Execute(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// addressArgument returns the cameras IP-Address if the first argument is one
+func addressArgument(args []string) net.IP {
+	if len(args) == 0 {
+		return nil
+	}
+	return net.ParseIP(args[0])
+}
+
+// patternArguments returns all arguments that are not the cameras IP-Address
+func patternArguments(args []string) []string {
+	if addressArgument(args) != nil {
+		return args[1:]
+	}
+	return args
+}
+
+// openManifest opens the checksum manifest in dir, it returns nil if format is "none"
+func openManifest(dir string, format string) (*download.Manifest, error) {
+	if format == "none" {
+		return nil, nil
+	}
+	return download.OpenManifest(dir, download.ManifestFormat(format))
+}
+
+// addToManifest records the checksum of a completed download in the manifest (if any)
+func addToManifest(manifest *download.Manifest, p download.Progress, source string) {
+	if manifest == nil || !p.Done || p.Err != nil {
+		return
+	}
+	err := manifest.Add(p.Job.Path, source, p.Job.Size, p.SHA256)
+	if err != nil {
+		log.Printf("ERROR updating manifest: %s\n", err)
+	}
+}
+
+// findCameraFile returns the file on the camera a manifest entry has been downloaded from
+func findCameraFile(files libipcamera.FileList, entry download.ManifestEntry) (libipcamera.StoredFile, bool) {
+	for _, file := range files {
+		if entry.Source != "" && file.Path == entry.Source {
+			return file, true
+		}
+	}
+	if entry.Source != "" {
+		return libipcamera.StoredFile{}, false
+	}
+	for _, file := range files {
+		if file.Name() == path.Base(entry.Path) {
+			return file, true
+		}
+	}
+	return libipcamera.StoredFile{}, false
+}
+
+// getFileList retrieves the file list from the camera, malformed entries are logged and skipped
+func getFileList(camera *libipcamera.Camera) (libipcamera.FileList, error) {
+	files, err := camera.GetFileList()
+	if err != nil {
+		var listErr *libipcamera.FileListError
+		if !errors.As(err, &listErr) {
+			log.Printf("ERROR Receiving File List: %s\n", err)
+			return nil, err
+		}
+		log.Printf("WARNING: %s\n", err)
+	}
+	return files, nil
 }
 
-func discoverCamera(verbose bool) net.IP {
-	cameraIP, err := libipcamera.AutodiscoverCamera(verbose)
+func discoverCamera(verbose bool) (net.IP, *libipcamera.DeviceProfile) {
+	cameraIP, profile, err := libipcamera.DiscoverCamera(verbose)
 	if err != nil {
 		log.Printf("ERROR during Autodiscover: %s\n", err)
 	}
 	if verbose {
-		log.Printf("Found Camera: %s\n", cameraIP)
+		log.Printf("Found Camera: %s (Profile: %s)\n", cameraIP, profile)
 	}
-	return cameraIP
+	return cameraIP, profile
 }
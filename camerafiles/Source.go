@@ -0,0 +1,97 @@
+package camerafiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// fileListTTL is the time the file list of the camera is cached
+const fileListTTL = 10 * time.Second
+
+// Source provides the files stored on the camera, it is implemented by *libipcamera.Camera
+type Source interface {
+	GetFileList() (libipcamera.FileList, error)
+	FileURL(path string) string
+}
+
+// CachedList caches the file list of a Source
+type CachedList struct {
+	source Source
+
+	lock      sync.Mutex
+	files     libipcamera.FileList
+	refreshed time.Time
+}
+
+// NewCachedList creates a CachedList of the files of source
+func NewCachedList(source Source) *CachedList {
+	return &CachedList{source: source}
+}
+
+// Files returns the file list of the camera and the time it has been loaded, the list is
+// refreshed if it is outdated. If refreshing fails the previous list is returned.
+func (l *CachedList) Files() (libipcamera.FileList, time.Time, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.files != nil && time.Since(l.refreshed) < fileListTTL {
+		return l.files, l.refreshed, nil
+	}
+
+	files, err := l.source.GetFileList()
+	if err != nil {
+		var listErr *libipcamera.FileListError
+		if !errors.As(err, &listErr) {
+			if l.files != nil {
+				log.Printf("ERROR refreshing file list, serving the previous list: %s\n", err)
+				return l.files, l.refreshed, nil
+			}
+			return nil, time.Time{}, err
+		}
+		log.Printf("WARNING: %s\n", err)
+	}
+
+	l.files = files
+	l.refreshed = time.Now()
+	return l.files, l.refreshed, nil
+}
+
+// proxiedHeaders are copied from the cameras response
+var proxiedHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag"}
+
+// Proxy passes a GET or HEAD request (including its Range header) through to the cameras
+// HTTP server, fileURL is the URL of the file on the camera
+func Proxy(client *http.Client, w http.ResponseWriter, r *http.Request, fileURL string) {
+	request, err := http.NewRequestWithContext(r.Context(), r.Method, fileURL, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		request.Header.Set("Range", rangeHeader)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Could not reach camera: %s", err), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+
+	for _, header := range proxiedHeaders {
+		if value := response.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(response.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, response.Body)
+	}
+}
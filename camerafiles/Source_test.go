@@ -0,0 +1,91 @@
+package camerafiles
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+type testSource struct {
+	files     libipcamera.FileList
+	err       error
+	requests  int
+	cameraURL string
+}
+
+func (s *testSource) GetFileList() (libipcamera.FileList, error) {
+	s.requests++
+	return s.files, s.err
+}
+
+func (s *testSource) FileURL(path string) string {
+	return s.cameraURL + path
+}
+
+func TestCachedList(t *testing.T) {
+	source := &testSource{files: libipcamera.FileList{{Path: "/DCIM/MOVIE/2019_0412_153001.MP4", Size: 10}}}
+	list := NewCachedList(source)
+
+	files, loaded, err := list.Files()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected file list %v (%v)", files, err)
+	}
+	files, cached, err := list.Files()
+	if err != nil || len(files) != 1 || !cached.Equal(loaded) || source.requests != 1 {
+		t.Errorf("expected the list to be cached, got %d requests", source.requests)
+	}
+
+	// The previous list is served if refreshing fails
+	list.refreshed = time.Now().Add(-fileListTTL)
+	source.err = errors.New("Camera not reachable")
+	files, _, err = list.Files()
+	if err != nil || len(files) != 1 || source.requests != 2 {
+		t.Errorf("expected the previous list, got %v (%v)", files, err)
+	}
+
+	// Without a previous list the error is returned
+	if _, _, err := NewCachedList(source).Files(); err != source.err {
+		t.Errorf("expected the error of the source, got %v", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	content := []byte("0123456789")
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Internal", "1")
+		http.ServeContent(w, r, "file", time.Now(), bytes.NewReader(content))
+	}))
+	defer camera.Close()
+
+	request := httptest.NewRequest(http.MethodGet, "/file", nil)
+	request.Header.Set("Range", "bytes=2-5")
+	recorder := httptest.NewRecorder()
+	Proxy(http.DefaultClient, recorder, request, camera.URL+"/file")
+
+	body, _ := io.ReadAll(recorder.Body)
+	if recorder.Code != http.StatusPartialContent || string(body) != "2345" {
+		t.Errorf("expected partial content 2345, got %d %q", recorder.Code, body)
+	}
+	if recorder.Header().Get("Content-Range") != "bytes 2-5/10" || recorder.Header().Get("X-Internal") != "" {
+		t.Errorf("unexpected headers %v", recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	Proxy(http.DefaultClient, recorder, httptest.NewRequest(http.MethodHead, "/file", nil), camera.URL+"/file")
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 || recorder.Header().Get("Content-Length") != "10" {
+		t.Errorf("unexpected HEAD response %d %v", recorder.Code, recorder.Header())
+	}
+
+	camera.Close()
+	recorder = httptest.NewRecorder()
+	Proxy(http.DefaultClient, recorder, httptest.NewRequest(http.MethodGet, "/file", nil), camera.URL+"/file")
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502 without a camera, got %d", recorder.Code)
+	}
+}
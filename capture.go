@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mpegts"
+)
+
+// recorder writes the frames of the preview stream into a container format
+type recorder interface {
+	libipcamera.FrameSink
+	Frames() int
+	Duration() time.Duration
+	Close() error
+}
+
+// Container formats of recordings
+const (
+	formatMP4    = "mp4"
+	formatMPEGTS = "mpegts"
+	formatH264   = "h264"
+)
+
+// formatExtensions are the file extensions of the default output of each format
+var formatExtensions = map[string]string{
+	formatMP4:    ".mp4",
+	formatMPEGTS: ".ts",
+	formatH264:   ".h264",
+}
+
+// isNetworkOutput returns true for udp:// and tcp:// outputs
+func isNetworkOutput(output string) bool {
+	return strings.HasPrefix(output, "udp://") || strings.HasPrefix(output, "tcp://")
+}
+
+// captureFormat returns the container format of a recording, if it has not been selected
+// explicitly it is derived from the output
+func captureFormat(format, output string) (string, error) {
+	switch format {
+	case formatMP4, formatMPEGTS, formatH264:
+		if format == formatMP4 && isNetworkOutput(output) {
+			return "", fmt.Errorf("MP4 can not be streamed to %s, use mpegts", output)
+		}
+		return format, nil
+	case "", "auto":
+	default:
+		return "", fmt.Errorf("Unknown format %s (mp4, mpegts, h264)", format)
+	}
+
+	lower := strings.ToLower(output)
+	switch {
+	case isNetworkOutput(output) || strings.HasSuffix(lower, ".ts") || strings.HasSuffix(lower, ".m2ts"):
+		return formatMPEGTS, nil
+	case strings.HasSuffix(lower, ".h264") || strings.HasSuffix(lower, ".264"):
+		return formatH264, nil
+	}
+	return formatMP4, nil
+}
+
+// newRecorder creates a recorder for the given format
+func newRecorder(format string, w io.Writer) recorder {
+	switch format {
+	case formatMPEGTS:
+		return libipcamera.NewMPEGTSRecorder(w)
+	case formatH264:
+		return libipcamera.NewAnnexBRecorder(w)
+	}
+	return libipcamera.NewMP4Recorder(w)
+}
+
+// stdoutOutput writes to stdout without closing it
+type stdoutOutput struct {
+	io.Writer
+}
+
+func (stdoutOutput) Close() error {
+	return nil
+}
+
+// datagramOutput sends a transport stream in datagrams of whole packets
+type datagramOutput struct {
+	*mpegts.DatagramWriter
+	conn net.Conn
+}
+
+func (d datagramOutput) Close() error {
+	return d.conn.Close()
+}
+
+// openCaptureOutput opens the destination of a recording: a file, stdout ("-"),
+// udp://host:port (including multicast groups) or tcp://host:port
+func openCaptureOutput(output string) (io.WriteCloser, error) {
+	switch {
+	case output == "-":
+		return stdoutOutput{os.Stdout}, nil
+	case strings.HasPrefix(output, "udp://"):
+		conn, err := net.Dial("udp", strings.TrimPrefix(output, "udp://"))
+		if err != nil {
+			return nil, err
+		}
+		return datagramOutput{mpegts.NewDatagramWriter(conn), conn}, nil
+	case strings.HasPrefix(output, "tcp://"):
+		return net.Dial("tcp", strings.TrimPrefix(output, "tcp://"))
+	default:
+		return os.Create(output)
+	}
+}
@@ -0,0 +1,197 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultAttempts is the number of times a download is tried before giving up
+	DefaultAttempts = 5
+	// stallTimeout aborts an attempt if no data has been received for this long
+	stallTimeout = 30 * time.Second
+)
+
+var client = &http.Client{
+	Transport: &http.Transport{
+		ResponseHeaderTimeout: 10 * time.Second,
+	},
+}
+
+// Job describes a single file to download
+type Job struct {
+	// URL to download the file from
+	URL string
+	// Path is the local destination of the file
+	Path string
+	// Size of the file in Bytes, if not 0 the download is verified against it
+	Size uint64
+}
+
+// File downloads a single file, data is written to a ".part" file first which is resumed
+// using HTTP Range requests if an attempt fails. The file is moved into place once it is complete.
+// progress (if not nil) is called with the number of Bytes stored locally whenever data has been received.
+// The hex encoded SHA-256 checksum of the file is computed while downloading and returned.
+func File(ctx context.Context, job Job, attempts int, progress func(received uint64)) (string, error) {
+	partialPath := job.Path + ".part"
+	backoff := time.Second
+
+	var checksum string
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		checksum, err = resume(ctx, partialPath, job, progress)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if attempt < attempts {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+			}
+			backoff *= 2
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	return checksum, os.Rename(partialPath, job.Path)
+}
+
+// resume continues downloading into the partial file at partialPath and returns the checksum of the file
+func resume(ctx context.Context, partialPath string, job Job, progress func(received uint64)) (string, error) {
+	err := os.MkdirAll(filepath.Dir(partialPath), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(partialPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	// Hash the data received by earlier attempts
+	hash := sha256.New()
+	offset, err := io.Copy(hash, out)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Size > 0 && uint64(offset) == job.Size {
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	if job.Size > 0 && uint64(offset) > job.Size {
+		// The file on the camera has changed, start over
+		offset, err = restart(out, hash)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, job.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		// The server ignored the Range header and sends the whole file
+		if offset > 0 {
+			offset, err = restart(out, hash)
+			if err != nil {
+				return "", err
+			}
+		}
+	case http.StatusPartialContent:
+		var start int64
+		_, err := fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-", &start)
+		if err != nil || start != offset {
+			restart(out, hash)
+			return "", fmt.Errorf("Unexpected Content-Range %q for offset %d", response.Header.Get("Content-Range"), offset)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		restart(out, hash)
+		return "", errors.New("Partial file does not match the file on the camera")
+	default:
+		return "", fmt.Errorf("Unexpected HTTP status: %s", response.Status)
+	}
+
+	if progress != nil {
+		progress(uint64(offset))
+	}
+
+	// Abort the attempt if the connection stalls, the next attempt resumes the download
+	watchdog := time.AfterFunc(stallTimeout, cancel)
+	defer watchdog.Stop()
+
+	reader := &progressReader{
+		reader:   response.Body,
+		watchdog: watchdog,
+		received: uint64(offset),
+		progress: progress,
+	}
+	_, err = io.Copy(io.MultiWriter(out, hash), reader)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Size > 0 && reader.received != job.Size {
+		return "", fmt.Errorf("Size mismatch: expected %d Bytes, got %d", job.Size, reader.received)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// restart truncates the partial file to start downloading from the beginning
+func restart(out *os.File, hash hash.Hash) (int64, error) {
+	hash.Reset()
+	err := out.Truncate(0)
+	if err != nil {
+		return 0, err
+	}
+	return out.Seek(0, io.SeekStart)
+}
+
+// progressReader resets the watchdog timer and reports progress whenever data has been read
+type progressReader struct {
+	reader   io.Reader
+	watchdog *time.Timer
+	received uint64
+	progress func(received uint64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.watchdog.Reset(stallTimeout)
+		r.received += uint64(n)
+		if r.progress != nil {
+			r.progress(r.received)
+		}
+	}
+	return n, err
+}
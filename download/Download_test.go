@@ -0,0 +1,71 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileResumesInterruptedDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100000)
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Drop the connection after sending a part of the file
+			w.Header().Set("Content-Length", "1000000")
+			w.WriteHeader(http.StatusOK)
+			w.Write(data[:300000])
+			return
+		}
+		if r.Header.Get("Range") != "bytes=300000-" {
+			t.Errorf("expected the download to be resumed, got Range %q", r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "file", time.Now(), bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	destination := filepath.Join(t.TempDir(), "file")
+	checksum, err := File(context.Background(), Job{URL: server.URL, Path: destination, Size: uint64(len(data))}, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("%x", sha256.Sum256(data)); checksum != expected {
+		t.Errorf("expected checksum %s, got %s", expected, checksum)
+	}
+
+	received, err := os.ReadFile(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Error("downloaded data does not match")
+	}
+	if _, err := os.Stat(destination + ".part"); !os.IsNotExist(err) {
+		t.Error("partial file has not been removed")
+	}
+}
+
+func TestFileDetectsSizeMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("short"))
+	}))
+	defer server.Close()
+
+	destination := filepath.Join(t.TempDir(), "file")
+	_, err := File(context.Background(), Job{URL: server.URL, Path: destination, Size: 10}, 1, nil)
+	if err == nil {
+		t.Fatal("expected a size mismatch error")
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Error("incomplete file has been moved into place")
+	}
+}
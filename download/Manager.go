@@ -0,0 +1,263 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// progressInterval limits how often progress is reported for a single file
+const progressInterval = 250 * time.Millisecond
+
+// Progress describes the state of a single download
+type Progress struct {
+	Job Job
+	// Received is the number of Bytes stored locally
+	Received uint64
+	// Rate is the current transfer rate in Bytes per second
+	Rate float64
+	// Done is true once the download has finished, Err is set if it failed
+	Done bool
+	Err  error
+	// SHA256 is the hex encoded checksum of the file, it is set once the download succeeded
+	SHA256 string
+}
+
+// ETA returns the estimated time until the download is complete or 0 if it is unknown
+func (p Progress) ETA() time.Duration {
+	if p.Rate <= 0 || p.Job.Size <= p.Received {
+		return 0
+	}
+	return time.Duration(float64(p.Job.Size-p.Received) / p.Rate * float64(time.Second))
+}
+
+// Manager downloads multiple files concurrently
+type Manager struct {
+	// Concurrency is the number of simultaneous transfers
+	Concurrency int
+	// Attempts is the number of times a download is tried before giving up
+	Attempts int
+	// OnProgress (if set) is called with progress updates, it may be called from multiple goroutines
+	OnProgress func(Progress)
+
+	// progress is the channel created by ProgressChannel for the next call to Download
+	progress chan Progress
+}
+
+// NewManager creates a new Manager running up to concurrency transfers at once
+func NewManager(concurrency int) *Manager {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Manager{
+		Concurrency: concurrency,
+		Attempts:    DefaultAttempts,
+	}
+}
+
+// ProgressChannel makes the next call to Download report its progress to the returned channel
+// in addition to OnProgress. Updates are dropped if the channel is not drained fast enough,
+// except for final updates which are queued without delaying the downloads. The channel is
+// closed after the final updates have been delivered once Download returned.
+func (m *Manager) ProgressChannel(buffer int) <-chan Progress {
+	m.progress = make(chan Progress, buffer)
+	return m.progress
+}
+
+// Download downloads all jobs and returns once every transfer has finished or ctx is done
+func (m *Manager) Download(ctx context.Context, jobs []Job) error {
+	report := m.OnProgress
+	if m.progress != nil {
+		queue := newProgressQueue(m.progress)
+		m.progress = nil
+		defer queue.close()
+
+		onProgress := m.OnProgress
+		report = func(p Progress) {
+			if onProgress != nil {
+				onProgress(p)
+			}
+			queue.add(p)
+		}
+	}
+
+	queue := make(chan Job)
+	failures := make([]error, 0)
+	failuresLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < m.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				err := m.download(ctx, job, report)
+				if err != nil {
+					failuresLock.Lock()
+					failures = append(failures, fmt.Errorf("%s: %w", job.URL, err))
+					failuresLock.Unlock()
+				}
+			}
+		}()
+	}
+
+Jobs:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break Jobs
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d downloads failed, first error: %w", len(failures), len(jobs), failures[0])
+	}
+	return nil
+}
+
+func (m *Manager) download(ctx context.Context, job Job, report func(Progress)) error {
+	rate := newRateMeter()
+	lastReport := time.Time{}
+	var received uint64
+
+	checksum, err := File(ctx, job, m.Attempts, func(r uint64) {
+		received = r
+		rate.update(r)
+		if report != nil && time.Since(lastReport) >= progressInterval {
+			lastReport = time.Now()
+			report(Progress{Job: job, Received: r, Rate: rate.rate()})
+		}
+	})
+
+	if report != nil {
+		if err == nil && job.Size > 0 {
+			received = job.Size
+		}
+		report(Progress{Job: job, Received: received, Rate: rate.rate(), Done: true, Err: err, SHA256: checksum})
+	}
+	return err
+}
+
+// progressQueue delivers progress updates to a channel without blocking the downloads, final
+// updates are queued until they have been delivered, other updates are dropped while the
+// channel is full or final updates are pending
+type progressQueue struct {
+	updates chan Progress
+
+	lock    sync.Mutex
+	pending []Progress
+	closed  bool
+	// wake signals the delivering goroutine that updates have been queued or the queue has been closed
+	wake chan struct{}
+}
+
+func newProgressQueue(updates chan Progress) *progressQueue {
+	q := &progressQueue{
+		updates: updates,
+		wake:    make(chan struct{}, 1),
+	}
+	go q.deliver()
+	return q
+}
+
+// add queues a progress update
+func (q *progressQueue) add(p Progress) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if !p.Done {
+		if len(q.pending) == 0 {
+			select {
+			case q.updates <- p:
+			default:
+			}
+		}
+		return
+	}
+	q.pending = append(q.pending, p)
+	q.signal()
+}
+
+// close closes the channel once the pending updates have been delivered
+func (q *progressQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+func (q *progressQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *progressQueue) deliver() {
+	for {
+		q.lock.Lock()
+		if len(q.pending) == 0 {
+			closed := q.closed
+			q.lock.Unlock()
+			if closed {
+				close(q.updates)
+				return
+			}
+			<-q.wake
+			continue
+		}
+		p := q.pending[0]
+		q.pending = q.pending[1:]
+		q.lock.Unlock()
+
+		q.updates <- p
+	}
+}
+
+// rateMeter estimates a transfer rate using an exponential moving average
+type rateMeter struct {
+	lastTime     time.Time
+	lastReceived uint64
+	average      float64
+}
+
+func newRateMeter() *rateMeter {
+	return &rateMeter{}
+}
+
+func (m *rateMeter) update(received uint64) {
+	now := time.Now()
+	if m.lastTime.IsZero() {
+		// The first update contains Bytes received by earlier attempts
+		m.lastTime = now
+		m.lastReceived = received
+		return
+	}
+	elapsed := now.Sub(m.lastTime).Seconds()
+	if elapsed < 0.1 {
+		return
+	}
+	if received < m.lastReceived {
+		// The download has been restarted
+		m.lastReceived = received
+	}
+	current := float64(received-m.lastReceived) / elapsed
+	if m.average == 0 {
+		m.average = current
+	} else {
+		m.average = 0.7*m.average + 0.3*current
+	}
+	m.lastTime = now
+	m.lastReceived = received
+}
+
+func (m *rateMeter) rate() float64 {
+	return m.average
+}
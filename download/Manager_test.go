@@ -0,0 +1,157 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer serves /file-N with the content "file N", paths starting with /missing fail
+func testServer(t *testing.T, delay time.Duration) (*httptest.Server, func() int) {
+	lock := sync.Mutex{}
+	active, maxActive := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			active--
+			lock.Unlock()
+		}()
+
+		time.Sleep(delay)
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.Replace(strings.TrimPrefix(r.URL.Path, "/"), "-", " ", 1)))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return maxActive
+	}
+}
+
+func testJobs(server *httptest.Server, directory string, names ...string) []Job {
+	jobs := make([]Job, 0, len(names))
+	for _, name := range names {
+		jobs = append(jobs, Job{URL: server.URL + "/" + name, Path: filepath.Join(directory, name)})
+	}
+	return jobs
+}
+
+func TestManagerDownloadsConcurrently(t *testing.T) {
+	server, maxActive := testServer(t, 50*time.Millisecond)
+	directory := t.TempDir()
+	jobs := testJobs(server, directory, "file-1", "file-2", "file-3", "file-4", "file-5", "file-6", "file-7")
+
+	manager := NewManager(3)
+	if err := manager.Download(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	if maxActive() != 3 {
+		t.Errorf("expected 3 concurrent transfers, got %d", maxActive())
+	}
+	for i, job := range jobs {
+		data, err := os.ReadFile(job.Path)
+		if err != nil || string(data) != fmt.Sprintf("file %d", i+1) {
+			t.Errorf("unexpected content of %s: %q (%v)", job.Path, data, err)
+		}
+	}
+
+	if NewManager(0).Concurrency != 1 {
+		t.Error("expected at least one concurrent transfer")
+	}
+}
+
+func TestManagerAggregatesFailures(t *testing.T) {
+	server, _ := testServer(t, 0)
+	directory := t.TempDir()
+	jobs := testJobs(server, directory, "file-1", "missing-1", "file-2", "missing-2")
+
+	manager := NewManager(2)
+	manager.Attempts = 1
+	err := manager.Download(context.Background(), jobs)
+	if err == nil || !strings.Contains(err.Error(), "2 of 4 downloads failed") || !strings.Contains(err.Error(), "/missing-") {
+		t.Fatalf("expected the failures to be aggregated, got %v", err)
+	}
+	for _, name := range []string{"file-1", "file-2"} {
+		if _, err := os.Stat(filepath.Join(directory, name)); err != nil {
+			t.Errorf("successful download %s is missing: %s", name, err)
+		}
+	}
+
+	// Canceling stops the remaining downloads
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := manager.Download(ctx, testJobs(server, t.TempDir(), "file-3")); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestManagerProgressChannel(t *testing.T) {
+	server, _ := testServer(t, 0)
+	jobs := testJobs(server, t.TempDir(), "file-1", "file-2", "missing-1", "file-3", "file-4")
+
+	manager := NewManager(2)
+	manager.Attempts = 1
+	callbacks := make(chan Progress, 100)
+	manager.OnProgress = func(p Progress) {
+		callbacks <- p
+	}
+	// The channel is not read until all downloads have finished, the workers must not block
+	updates := manager.ProgressChannel(0)
+
+	finished := make(chan error)
+	go func() {
+		finished <- manager.Download(context.Background(), jobs)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("downloads are blocked by the progress channel")
+	}
+
+	final := make(map[string]Progress)
+	for p := range updates {
+		if p.Done {
+			final[p.Job.Path] = p
+		}
+	}
+	if len(final) != len(jobs) {
+		t.Fatalf("expected %d final updates, got %d", len(jobs), len(final))
+	}
+	for _, job := range jobs {
+		p := final[job.Path]
+		failed := strings.Contains(job.URL, "missing")
+		if failed != (p.Err != nil) {
+			t.Errorf("unexpected result of %s: %v", job.URL, p.Err)
+		}
+		expected := fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Replace(filepath.Base(job.Path), "-", " ", 1))))
+		if !failed && p.SHA256 != expected {
+			t.Errorf("unexpected checksum of %s: %s", job.URL, p.SHA256)
+		}
+	}
+	if len(callbacks) < len(jobs) {
+		t.Errorf("expected OnProgress to be called for every download, got %d calls", len(callbacks))
+	}
+
+	// The channel only applies to a single call to Download
+	if err := manager.Download(context.Background(), testJobs(server, t.TempDir(), "file-5")); err != nil {
+		t.Fatal(err)
+	}
+}
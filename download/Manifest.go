@@ -0,0 +1,255 @@
+package download
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManifestFormat selects the file format of a Manifest
+type ManifestFormat string
+
+const (
+	// FormatSHA256Sum writes the manifest in the format of the sha256sum tool
+	FormatSHA256Sum ManifestFormat = "sha256sum"
+	// FormatJSON writes the manifest as JSON including the files source and size
+	FormatJSON ManifestFormat = "json"
+)
+
+// Manifest file names inside a download directory
+const (
+	SHA256SumManifestName = "SHA256SUMS"
+	JSONManifestName      = "manifest.json"
+)
+
+// ManifestEntry describes a single downloaded file
+type ManifestEntry struct {
+	// Path of the file relative to the manifest, always using forward slashes
+	Path string `json:"path"`
+	// Source is the path of the file on the cameras SD-Card
+	Source string `json:"source,omitempty"`
+	// Size of the file in Bytes, it is not stored in the sha256sum format
+	Size uint64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded checksum of the file
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest records checksums of all files downloaded into a directory
+type Manifest struct {
+	dir     string
+	format  ManifestFormat
+	lock    sync.Mutex
+	entries map[string]ManifestEntry
+}
+
+// ManifestPath returns the path of the manifest file in dir for the given format
+func ManifestPath(dir string, format ManifestFormat) string {
+	if format == FormatJSON {
+		return filepath.Join(dir, JSONManifestName)
+	}
+	return filepath.Join(dir, SHA256SumManifestName)
+}
+
+// OpenManifest opens the manifest in dir using the given format, existing entries are loaded
+func OpenManifest(dir string, format ManifestFormat) (*Manifest, error) {
+	if format != FormatSHA256Sum && format != FormatJSON {
+		return nil, fmt.Errorf("Unknown manifest format %q", format)
+	}
+
+	manifest := &Manifest{
+		dir:     dir,
+		format:  format,
+		entries: make(map[string]ManifestEntry),
+	}
+
+	err := manifest.load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// LoadManifest loads the manifest stored in dir, whichever format exists
+func LoadManifest(dir string) (*Manifest, error) {
+	for _, format := range []ManifestFormat{FormatJSON, FormatSHA256Sum} {
+		if _, err := os.Stat(ManifestPath(dir, format)); err == nil {
+			return OpenManifest(dir, format)
+		}
+	}
+	return nil, fmt.Errorf("No manifest found in %s", dir)
+}
+
+func (m *Manifest) load() error {
+	file, err := os.Open(ManifestPath(m.dir, m.format))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if m.format == FormatJSON {
+		entries := make([]ManifestEntry, 0)
+		err = json.NewDecoder(file).Decode(&entries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			m.entries[entry.Path] = entry
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Lines look like "<checksum>  <path>", binary mode uses "<checksum> *<path>"
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || len(parts[0]) != sha256.Size*2 {
+			continue
+		}
+		path := strings.TrimPrefix(strings.TrimPrefix(parts[1], " "), "*")
+		m.entries[path] = ManifestEntry{Path: path, SHA256: parts[0]}
+	}
+	return scanner.Err()
+}
+
+// Dir returns the directory the manifest is stored in
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// Entries returns all entries of the manifest ordered by path
+func (m *Manifest) Entries() []ManifestEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.sortedEntries()
+}
+
+func (m *Manifest) sortedEntries() []ManifestEntry {
+	entries := make([]ManifestEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Add records a downloaded file and saves the manifest, localPath must be located inside the manifests directory
+func (m *Manifest) Add(localPath, source string, size uint64, checksum string) error {
+	relative, err := filepath.Rel(m.dir, localPath)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not located inside %s", localPath, m.dir)
+	}
+	path := filepath.ToSlash(relative)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.entries[path] = ManifestEntry{
+		Path:   path,
+		Source: source,
+		Size:   size,
+		SHA256: checksum,
+	}
+	return m.save()
+}
+
+// save writes the manifest atomically
+func (m *Manifest) save() error {
+	manifestPath := ManifestPath(m.dir, m.format)
+	out, err := os.Create(manifestPath + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	entries := m.sortedEntries()
+	if m.format == FormatJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entries)
+	} else {
+		writer := bufio.NewWriter(out)
+		for _, entry := range entries {
+			fmt.Fprintf(writer, "%s  %s\n", entry.SHA256, entry.Path)
+		}
+		err = writer.Flush()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(manifestPath+".tmp", manifestPath)
+}
+
+// VerifyStatus is the result of verifying a single file
+type VerifyStatus string
+
+const (
+	// StatusOK means the file matches the manifest
+	StatusOK VerifyStatus = "OK"
+	// StatusMissing means the file does not exist
+	StatusMissing VerifyStatus = "MISSING"
+	// StatusSizeMismatch means the size of the file differs from the manifest
+	StatusSizeMismatch VerifyStatus = "SIZE MISMATCH"
+	// StatusChecksumMismatch means the content of the file differs from the manifest
+	StatusChecksumMismatch VerifyStatus = "CHECKSUM MISMATCH"
+)
+
+// VerifyResult describes the state of a single file listed in a manifest
+type VerifyResult struct {
+	Entry  ManifestEntry
+	Status VerifyStatus
+	// Size is the size of the local file
+	Size uint64
+	Err  error
+}
+
+// Verify re-computes the checksums of all files listed in the manifest
+func (m *Manifest) Verify() []VerifyResult {
+	results := make([]VerifyResult, 0)
+	for _, entry := range m.Entries() {
+		results = append(results, m.verifyEntry(entry))
+	}
+	return results
+}
+
+func (m *Manifest) verifyEntry(entry ManifestEntry) VerifyResult {
+	result := VerifyResult{Entry: entry, Status: StatusOK}
+
+	file, err := os.Open(filepath.Join(m.dir, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		result.Status = StatusMissing
+		result.Err = err
+		return result
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	result.Size = uint64(size)
+	if err != nil {
+		result.Status = StatusMissing
+		result.Err = err
+		return result
+	}
+
+	if entry.Size > 0 && result.Size != entry.Size {
+		result.Status = StatusSizeMismatch
+	} else if hex.EncodeToString(hash.Sum(nil)) != strings.ToLower(entry.SHA256) {
+		result.Status = StatusChecksumMismatch
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package download
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestVerify(t *testing.T) {
+	for _, format := range []ManifestFormat{FormatSHA256Sum, FormatJSON} {
+		dir := t.TempDir()
+		manifest, err := OpenManifest(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string][]byte{
+			"a.MP4":                 []byte("first file"),
+			"2019/2019-04-12/b.JPG": []byte("second file"),
+		}
+		for name, data := range files {
+			localPath := filepath.Join(dir, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(localPath), 0755)
+			os.WriteFile(localPath, data, 0644)
+			err := manifest.Add(localPath, "/DCIM/"+filepath.Base(name), uint64(len(data)), fmt.Sprintf("%x", sha256.Sum256(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Corrupt one of the files
+		os.WriteFile(filepath.Join(dir, "a.MP4"), []byte("First file"), 0644)
+
+		manifest, err = LoadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results := manifest.Verify()
+		if len(results) != 2 {
+			t.Fatalf("%s: expected 2 results, got %d", format, len(results))
+		}
+		if results[0].Entry.Path != "2019/2019-04-12/b.JPG" || results[0].Status != StatusOK {
+			t.Errorf("%s: unexpected result %+v", format, results[0])
+		}
+		if results[1].Entry.Path != "a.MP4" || results[1].Status != StatusChecksumMismatch {
+			t.Errorf("%s: unexpected result %+v", format, results[1])
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const barWidth = 30
+
+// TerminalProgress renders progress bars for every active download and the total progress
+type TerminalProgress struct {
+	out         io.Writer
+	interactive bool
+	lock        sync.Mutex
+	jobs        []Job
+	state       map[string]Progress
+	linesDrawn  int
+}
+
+// IsTerminal returns true if f is a character device, e.g. an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewTerminalProgress creates a TerminalProgress for the given jobs writing to out,
+// if out is not a terminal only finished downloads are reported
+func NewTerminalProgress(out *os.File, jobs []Job) *TerminalProgress {
+	return &TerminalProgress{
+		out:         out,
+		interactive: IsTerminal(out),
+		jobs:        jobs,
+		state:       make(map[string]Progress),
+	}
+}
+
+// Update processes a progress update, it can be used as Manager.OnProgress
+func (t *TerminalProgress) Update(p Progress) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.state[p.Job.Path] = p
+
+	if !t.interactive {
+		if p.Done {
+			fmt.Fprintln(t.out, finishedLine(p))
+		}
+		return
+	}
+	t.redraw(p)
+}
+
+func (t *TerminalProgress) redraw(update Progress) {
+	// Move the cursor back to the first line of the previous output
+	if t.linesDrawn > 0 {
+		fmt.Fprintf(t.out, "\033[%dA", t.linesDrawn)
+	}
+
+	// Finished downloads are printed once above the progress bars
+	printed := 0
+	if update.Done {
+		fmt.Fprintf(t.out, "\033[2K%s\n", finishedLine(update))
+		printed++
+	}
+
+	lines := 0
+	var total, received uint64
+	var rate float64
+	for _, job := range t.jobs {
+		total += job.Size
+		p, ok := t.state[job.Path]
+		if !ok {
+			continue
+		}
+		received += p.Received
+		if p.Done {
+			continue
+		}
+		rate += p.Rate
+		fmt.Fprintf(t.out, "\033[2K%s\n", progressLine(filepath.Base(job.Path), p.Received, job.Size, p.Rate))
+		lines++
+	}
+
+	fmt.Fprintf(t.out, "\033[2K%s\n", progressLine("Total", received, total, rate))
+	lines++
+
+	// Clear lines left over from earlier output
+	printed += lines
+	for i := printed; i < t.linesDrawn; i++ {
+		fmt.Fprint(t.out, "\033[2K\n")
+	}
+	if t.linesDrawn > printed {
+		fmt.Fprintf(t.out, "\033[%dA", t.linesDrawn-printed)
+	}
+	t.linesDrawn = lines
+}
+
+func finishedLine(p Progress) string {
+	if p.Err != nil {
+		return fmt.Sprintf("FAILED %s: %s", p.Job.Path, p.Err)
+	}
+	return fmt.Sprintf("Downloaded %s (%s)", p.Job.Path, FormatBytes(float64(p.Received)))
+}
+
+func progressLine(name string, received, total uint64, rate float64) string {
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(received) / float64(total)
+		if fraction > 1 {
+			fraction = 1
+		}
+	}
+	filled := int(fraction * barWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+
+	eta := "--"
+	if rate > 0 && total > received {
+		eta = (time.Duration(float64(total-received)/rate) * time.Second).String()
+	}
+
+	if len(name) > 24 {
+		name = "..." + name[len(name)-21:]
+	}
+	return fmt.Sprintf("%-24s [%s] %3.0f%% %10s/s ETA %s", name, bar, fraction*100, FormatBytes(rate), eta)
+}
+
+// FormatBytes formats a number of Bytes using binary prefixes
+func FormatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
@@ -0,0 +1,64 @@
+package download
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTerminalProgressNonInteractive(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	jobs := []Job{{Path: "a.MP4", Size: 2048}, {Path: "b.MP4", Size: 1024}}
+	progress := NewTerminalProgress(out, jobs)
+	if progress.interactive {
+		t.Fatal("a regular file is not a terminal")
+	}
+
+	// Only finished downloads are reported
+	progress.Update(Progress{Job: jobs[0], Received: 1024, Rate: 512})
+	progress.Update(Progress{Job: jobs[0], Received: 2048, Done: true})
+	progress.Update(Progress{Job: jobs[1], Done: true, Err: errors.New("timeout")})
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Downloaded a.MP4 (2.0 KiB)\nFAILED b.MP4: timeout\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	line := progressLine("2019_0412_153001_and_a_long_name.MP4", 512, 1024, 256)
+	if !strings.HasPrefix(line, "...1_and_a_long_name.MP4 [===============               ]  50%") {
+		t.Errorf("unexpected progress line %q", line)
+	}
+	if !strings.HasSuffix(line, "256.0 B/s ETA 2s") {
+		t.Errorf("unexpected rate or ETA in %q", line)
+	}
+	if line := progressLine("file", 0, 0, 0); !strings.HasSuffix(line, "ETA --") {
+		t.Errorf("expected an unknown ETA in %q", line)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for value, expected := range map[float64]string{
+		0:                  "0.0 B",
+		1536:               "1.5 KiB",
+		3 * 1024 * 1024:    "3.0 MiB",
+		1 << 50:            "1024.0 TiB",
+		1024*1024*1024 - 1: "1024.0 MiB",
+	} {
+		if formatted := FormatBytes(value); formatted != expected {
+			t.Errorf("expected %s for %.0f, got %s", expected, value, formatted)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package dvr
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// Defaults of the recording parameters
+const (
+	DefaultSegmentDuration = 5 * time.Minute
+	DefaultRetention       = 24 * time.Hour
+)
+
+// nameLayout is the time layout of the segment file names
+const nameLayout = "2006-01-02_15-04-05"
+
+// SegmentWriter writes the frames of a single segment into a container format
+type SegmentWriter interface {
+	libipcamera.FrameSink
+	Close() error
+}
+
+// Recorder is a FrameSink continuously recording the stream to files in a directory, a new
+// file is started at the first key frame after SegmentDuration. Files are named after the
+// local time their first frame was received, files older than Retention are removed.
+type Recorder struct {
+	Directory       string
+	Extension       string
+	SegmentDuration time.Duration
+	Retention       time.Duration
+
+	newWriter func(w io.Writer) SegmentWriter
+
+	lock          sync.Mutex
+	parameterSets libipcamera.ParameterSets
+	file          *os.File
+	writer        SegmentWriter
+	started       time.Time
+	split         bool
+	lastFrame     time.Time
+	segments      int
+}
+
+// NewRecorder creates a Recorder writing files with the given extension (e.g. ".mp4") to
+// directory, newWriter creates the writer of each segment
+func NewRecorder(directory, extension string, newWriter func(w io.Writer) SegmentWriter) *Recorder {
+	return &Recorder{
+		Directory:       directory,
+		Extension:       extension,
+		SegmentDuration: DefaultSegmentDuration,
+		Retention:       DefaultRetention,
+		newWriter:       newWriter,
+	}
+}
+
+// WriteFrame adds a frame to the current segment. Errors writing a segment are logged and
+// the segment is closed, recording continues with a new segment at the next key frame.
+func (r *Recorder) WriteFrame(frame libipcamera.Frame) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lastFrame = frame.Received
+	r.parameterSets.Update(frame)
+	keyFrame := frame.IsKeyFrame()
+
+	if keyFrame && r.writer != nil && (r.split || frame.Received.Sub(r.started) >= r.SegmentDuration) {
+		r.closeSegment()
+	}
+	if r.writer == nil {
+		if !keyFrame || !r.parameterSets.Complete() {
+			return nil
+		}
+		err := r.startSegment(frame.Received)
+		if err != nil {
+			log.Printf("ERROR starting segment: %s\n", err)
+			return nil
+		}
+	}
+
+	// Every segment has to start with the parameter sets
+	frame.Data = r.parameterSets.Prepend(frame)
+	err := r.writer.WriteFrame(frame)
+	if err != nil {
+		log.Printf("ERROR writing %s: %s\n", r.file.Name(), err)
+		r.closeSegment()
+	}
+	return nil
+}
+
+// Split starts a new segment at the next key frame, e.g. after the camera reconnected
+func (r *Recorder) Split() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.split = true
+}
+
+// LastFrame returns the local time the last frame was received
+func (r *Recorder) LastFrame() time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lastFrame
+}
+
+// Segments returns the number of segments started
+func (r *Recorder) Segments() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.segments
+}
+
+// Close finishes the current segment
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.writer == nil {
+		return nil
+	}
+	return r.closeSegment()
+}
+
+// startSegment creates the file of a new segment and removes expired segments
+func (r *Recorder) startSegment(started time.Time) error {
+	name := started.Format(nameLayout)
+	var file *os.File
+	var err error
+	// Segments started within the same second get a counter appended
+	for i := 1; ; i++ {
+		path := filepath.Join(r.Directory, name+r.Extension)
+		if i > 1 {
+			path = filepath.Join(r.Directory, fmt.Sprintf("%s_%d%s", name, i, r.Extension))
+		}
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Recording segment %s\n", file.Name())
+	r.file = file
+	r.writer = r.newWriter(file)
+	r.started = started
+	r.split = false
+	r.segments++
+
+	err = r.removeExpired(started)
+	if err != nil {
+		log.Printf("ERROR removing expired segments: %s\n", err)
+	}
+	return nil
+}
+
+// closeSegment finalizes the current segment
+func (r *Recorder) closeSegment() error {
+	err := r.writer.Close()
+	closeErr := r.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("ERROR finalizing %s: %s\n", r.file.Name(), err)
+	}
+	r.writer = nil
+	r.file = nil
+	return err
+}
+
+// removeExpired deletes segments that have last been written before now - Retention,
+// only files named like segments are considered
+func (r *Recorder) removeExpired(now time.Time) error {
+	if r.Retention <= 0 {
+		return nil
+	}
+	segments, err := r.List()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment == r.file.Name() {
+			continue
+		}
+		info, err := os.Stat(segment)
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > r.Retention {
+			log.Printf("Removing expired segment %s\n", segment)
+			err = os.Remove(segment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the paths of all segments in the directory, oldest first
+func (r *Recorder) List() ([]string, error) {
+	entries, err := os.ReadDir(r.Directory)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, r.Extension) || len(name) < len(nameLayout) {
+			continue
+		}
+		if _, err := time.Parse(nameLayout, name[:len(nameLayout)]); err != nil {
+			continue
+		}
+		segments = append(segments, filepath.Join(r.Directory, name))
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
@@ -0,0 +1,158 @@
+package dvr
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+var (
+	testSPS = []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x1F, 0xDA, 0x02, 0x80, 0xF6, 0x40}
+	testPPS = []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x3C, 0x80}
+)
+
+// testWriter writes the Annex-B data of the frames
+type testWriter struct {
+	w      io.Writer
+	closed bool
+}
+
+func (t *testWriter) WriteFrame(frame libipcamera.Frame) error {
+	_, err := t.w.Write(frame.Data)
+	return err
+}
+
+func (t *testWriter) Close() error {
+	t.closed = true
+	return nil
+}
+
+// testFrames returns one frame per second, every 10th frame is a key frame
+func testFrames(start time.Time, from, to int) []libipcamera.Frame {
+	frames := make([]libipcamera.Frame, 0)
+	for i := from; i < to; i++ {
+		data := []byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9A, byte(i)}
+		if i%10 == 0 {
+			data = []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, byte(i)}
+			if i == 0 {
+				data = append(append(append([]byte(nil), testSPS...), testPPS...), data...)
+			}
+		}
+		frames = append(frames, libipcamera.Frame{
+			Data:     data,
+			PTS:      time.Duration(i) * time.Second,
+			Received: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return frames
+}
+
+func TestRecorder(t *testing.T) {
+	directory := t.TempDir()
+	start := time.Date(2020, 5, 17, 12, 0, 0, 0, time.Local)
+
+	// An expired segment and an unrelated file
+	expired := filepath.Join(directory, "2020-05-15_08-00-00.mp4")
+	unrelated := filepath.Join(directory, "notes.mp4")
+	for _, path := range []string{expired, unrelated} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, start.Add(-48*time.Hour), start.Add(-48*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writers := make([]*testWriter, 0)
+	recorder := NewRecorder(directory, ".mp4", func(w io.Writer) SegmentWriter {
+		writer := &testWriter{w: w}
+		writers = append(writers, writer)
+		return writer
+	})
+	recorder.SegmentDuration = 25 * time.Second
+
+	// Frames before the first key frame are skipped, segments are split at the first key frame after 25 seconds
+	for _, frame := range testFrames(start, 0, 65) {
+		if err := recorder.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The camera reconnected, the next key frame starts a new segment
+	recorder.Split()
+	for _, frame := range testFrames(start, 65, 75) {
+		recorder.WriteFrame(frame)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := recorder.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(directory, "2020-05-17_12-00-00.mp4"),
+		filepath.Join(directory, "2020-05-17_12-00-30.mp4"),
+		filepath.Join(directory, "2020-05-17_12-01-00.mp4"),
+		filepath.Join(directory, "2020-05-17_12-01-10.mp4"),
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("expected segments %v, got %v", expected, segments)
+	}
+	for i := range expected {
+		if segments[i] != expected[i] {
+			t.Errorf("expected segment %s, got %s", expected[i], segments[i])
+		}
+	}
+	if recorder.Segments() != 4 {
+		t.Errorf("expected 4 segments, got %d", recorder.Segments())
+	}
+	for i, writer := range writers {
+		if !writer.closed {
+			t.Errorf("segment %d has not been closed", i)
+		}
+	}
+
+	// Every segment starts with the parameter sets
+	for _, segment := range segments {
+		data, err := os.ReadFile(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, append(append([]byte(nil), testSPS...), testPPS...)) {
+			t.Errorf("%s does not start with the parameter sets: %X", segment, data)
+		}
+	}
+
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("unrelated file has been removed: %s", err)
+	}
+	if recorder.LastFrame() != start.Add(74*time.Second) {
+		t.Errorf("unexpected time of the last frame %s", recorder.LastFrame())
+	}
+}
+
+func TestRecorderSameSecond(t *testing.T) {
+	directory := t.TempDir()
+	start := time.Date(2020, 5, 17, 12, 0, 0, 0, time.Local)
+	recorder := NewRecorder(directory, ".ts", func(w io.Writer) SegmentWriter {
+		return &testWriter{w: w}
+	})
+
+	frames := testFrames(start, 0, 1)
+	recorder.WriteFrame(frames[0])
+	recorder.Split()
+	frames[0].Received = frames[0].Received.Add(500 * time.Millisecond)
+	recorder.WriteFrame(frames[0])
+	recorder.Close()
+
+	segments, _ := recorder.List()
+	if len(segments) != 2 || filepath.Base(segments[1]) != "2020-05-17_12-00-00_2.ts" {
+		t.Errorf("unexpected segments %v", segments)
+	}
+}
@@ -0,0 +1,232 @@
+package fileproxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jonas-koeritz/actioncam/download"
+)
+
+// ErrTooLarge is returned by Cache.Open for files that do not fit into the cache
+var ErrTooLarge = errors.New("File is larger than the cache")
+
+// Cache stores files downloaded from the camera on local disk, the least recently
+// used files are removed once the total size exceeds the limit
+type Cache struct {
+	dir   string
+	limit int64
+
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+	// order contains all entries, the most recently used first
+	order   *list.List
+	used    int64
+	pending map[string]*fill
+
+	// fillSlots limits the number of concurrent downloads from the camera
+	fillSlots chan struct{}
+}
+
+type cacheEntry struct {
+	key     string
+	size    int64
+	users   int
+	element *list.Element
+}
+
+// fill is a download into the cache that other requests for the same file wait for
+type fill struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCache creates a cache in dir holding at most limit Bytes, files already present in dir are reused
+func NewCache(dir string, limit int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:       dir,
+		limit:     limit,
+		entries:   make(map[string]*cacheEntry),
+		order:     list.New(),
+		pending:   make(map[string]*fill),
+		fillSlots: make(chan struct{}, 1),
+	}
+
+	// Files of a previous run are ordered by their modification time
+	type existingFile struct {
+		key  string
+		info os.FileInfo
+	}
+	existing := make([]existingFile, 0)
+	err = filepath.Walk(dir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(localPath, ".part") {
+			return err
+		}
+		relative, err := filepath.Rel(dir, localPath)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, existingFile{key: "/" + filepath.ToSlash(relative), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(existing, func(i, j int) bool {
+		return existing[i].info.ModTime().After(existing[j].info.ModTime())
+	})
+	for _, file := range existing {
+		c.insert(file.key, file.info.Size())
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// Used returns the number of Bytes stored in the cache
+func (c *Cache) Used() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.used
+}
+
+// Contains returns true if the file at cameraPath is cached with the given size
+func (c *Cache) Contains(cameraPath string, size int64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, found := c.entries[cacheKey(cameraPath)]
+	return found && entry.size == size
+}
+
+// Open returns the cached copy of the file at cameraPath, the file is downloaded from url first
+// if it is not cached yet. hit is true if the file was already cached. release must be called once
+// the file is no longer used, files in use are never evicted.
+func (c *Cache) Open(ctx context.Context, cameraPath, url string, size int64) (file *os.File, hit bool, release func(), err error) {
+	if size > c.limit {
+		return nil, false, nil, ErrTooLarge
+	}
+	key := cacheKey(cameraPath)
+	hit = true
+
+	var entry *cacheEntry
+	for {
+		var found bool
+		c.lock.Lock()
+		if entry, found = c.entries[key]; found {
+			if entry.size == size {
+				entry.users++
+				c.order.MoveToFront(entry.element)
+				c.lock.Unlock()
+				break
+			}
+			// The file changed on the camera
+			c.remove(entry)
+		}
+		hit = false
+
+		current, downloading := c.pending[key]
+		if !downloading {
+			current = &fill{done: make(chan struct{})}
+			c.pending[key] = current
+			go c.fill(ctx, key, url, size, current)
+		}
+		c.lock.Unlock()
+
+		select {
+		case <-current.done:
+		case <-ctx.Done():
+			return nil, false, nil, ctx.Err()
+		}
+		// A failed download is retried if it was canceled by another request
+		if current.err != nil && (ctx.Err() != nil || !errors.Is(current.err, context.Canceled)) {
+			return nil, false, nil, current.err
+		}
+	}
+
+	release = func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		entry.users--
+		c.evict()
+	}
+
+	file, err = os.Open(c.localPath(key))
+	if err != nil {
+		release()
+		return nil, false, nil, err
+	}
+	return file, hit, release, nil
+}
+
+// fill downloads a file into the cache and adds it once it is complete
+func (c *Cache) fill(ctx context.Context, key, url string, size int64, current *fill) {
+	select {
+	case c.fillSlots <- struct{}{}:
+		_, current.err = download.File(ctx, download.Job{
+			URL:  url,
+			Path: c.localPath(key),
+			Size: uint64(size),
+		}, download.DefaultAttempts, nil)
+		<-c.fillSlots
+	case <-ctx.Done():
+		current.err = ctx.Err()
+	}
+
+	c.lock.Lock()
+	delete(c.pending, key)
+	if current.err == nil {
+		c.insert(key, size)
+		c.evict()
+	}
+	c.lock.Unlock()
+	close(current.done)
+}
+
+// insert adds a file as the most recently used entry
+func (c *Cache) insert(key string, size int64) {
+	entry := &cacheEntry{key: key, size: size}
+	entry.element = c.order.PushFront(entry)
+	c.entries[key] = entry
+	c.used += size
+}
+
+// remove deletes an entry from the index, the file is only deleted if nobody uses it
+func (c *Cache) remove(entry *cacheEntry) {
+	c.order.Remove(entry.element)
+	delete(c.entries, entry.key)
+	c.used -= entry.size
+	if entry.users == 0 {
+		os.Remove(c.localPath(entry.key))
+	}
+}
+
+// evict removes the least recently used files that are not in use until the cache fits its limit
+func (c *Cache) evict() {
+	for element := c.order.Back(); element != nil && c.used > c.limit; {
+		entry := element.Value.(*cacheEntry)
+		element = element.Prev()
+		if entry.users == 0 {
+			c.remove(entry)
+		}
+	}
+}
+
+func (c *Cache) localPath(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+// cacheKey returns the normalized path of a file on the camera
+func cacheKey(cameraPath string) string {
+	return path.Clean("/" + cameraPath)
+}
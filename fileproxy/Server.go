@@ -0,0 +1,123 @@
+package fileproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/camerafiles"
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// Server serves the files stored on the camera from a local Cache, the file list
+// is served as JSON at the root path, files are served at their path on the camera
+type Server struct {
+	source camerafiles.Source
+	files  *camerafiles.CachedList
+	cache  *Cache
+	client *http.Client
+}
+
+// NewServer creates a new Server serving the files of source through cache
+func NewServer(source camerafiles.Source, cache *Cache) *Server {
+	return &Server{
+		source: source,
+		files:  camerafiles.NewCachedList(source),
+		cache:  cache,
+		client: &http.Client{},
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "The camera is served read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, _, err := s.files.Files()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Could not load file list: %s", err), http.StatusBadGateway)
+		return
+	}
+
+	requestPath := path.Clean("/" + r.URL.Path)
+	if requestPath == "/" {
+		s.listFiles(w, files)
+		return
+	}
+
+	for _, file := range files {
+		if cacheKey(file.Path) == requestPath {
+			s.serveFile(w, r, file)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// listEntry is a file in the JSON listing
+type listEntry struct {
+	Path        string     `json:"path"`
+	URL         string     `json:"url"`
+	Size        uint64     `json:"size"`
+	Kind        string     `json:"kind"`
+	CaptureTime *time.Time `json:"captureTime,omitempty"`
+	Locked      bool       `json:"locked"`
+	Cached      bool       `json:"cached"`
+}
+
+func (s *Server) listFiles(w http.ResponseWriter, files libipcamera.FileList) {
+	entries := make([]listEntry, 0, len(files))
+	for _, file := range files {
+		entry := listEntry{
+			Path:   file.Path,
+			URL:    (&url.URL{Path: cacheKey(file.Path)}).EscapedPath(),
+			Size:   file.Size,
+			Kind:   file.Kind.String(),
+			Locked: file.Locked,
+			Cached: s.cache.Contains(file.Path, int64(file.Size)),
+		}
+		if !file.CaptureTime.IsZero() {
+			captureTime := file.CaptureTime
+			entry.CaptureTime = &captureTime
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(entries)
+}
+
+// serveFile serves a file from the cache, it is downloaded from the camera first if necessary.
+// Range requests are answered from the cached copy.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, file libipcamera.StoredFile) {
+	w.Header().Set("Content-Type", file.ContentType())
+
+	cached, hit, release, err := s.cache.Open(r.Context(), file.Path, s.source.FileURL(file.Path), int64(file.Size))
+	if errors.Is(err, ErrTooLarge) {
+		w.Header().Set("X-Cache", "BYPASS")
+		camerafiles.Proxy(s.client, w, r, s.source.FileURL(file.Path))
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Could not fetch file from camera: %s", err), http.StatusBadGateway)
+		return
+	}
+	defer release()
+	defer cached.Close()
+
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	http.ServeContent(w, r, file.Name(), file.CaptureTime, cached)
+}
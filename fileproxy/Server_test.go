@@ -0,0 +1,132 @@
+package fileproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+type testSource struct {
+	files     libipcamera.FileList
+	cameraURL string
+}
+
+func (s *testSource) GetFileList() (libipcamera.FileList, error) {
+	return s.files, nil
+}
+
+func (s *testSource) FileURL(path string) string {
+	return s.cameraURL + path
+}
+
+func get(t *testing.T, url string, rangeHeader string) (*http.Response, []byte) {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	if rangeHeader != "" {
+		request.Header.Set("Range", rangeHeader)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	return response, body
+}
+
+func TestServerCachesFiles(t *testing.T) {
+	content := map[string][]byte{
+		"/DCIM/MOVIE/A.MP4": []byte("0123456789"),
+		"/DCIM/MOVIE/B.MP4": []byte("abcdefghij"),
+		"/DCIM/MOVIE/C.MP4": []byte("ABCDEFGHIJ"),
+	}
+	var cameraRequests int32
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cameraRequests, 1)
+		http.ServeContent(w, r, "file", time.Now(), bytes.NewReader(content[r.URL.Path]))
+	}))
+	defer camera.Close()
+
+	source := &testSource{cameraURL: camera.URL}
+	for _, name := range []string{"/DCIM/MOVIE/A.MP4", "/DCIM/MOVIE/B.MP4", "/DCIM/MOVIE/C.MP4"} {
+		source.files = append(source.files, libipcamera.StoredFile{Path: name, Size: 10, Kind: libipcamera.KindVideo})
+	}
+
+	cache, err := NewCache(t.TempDir(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewServer(source, cache))
+	defer server.Close()
+
+	response, body := get(t, server.URL+"/DCIM/MOVIE/A.MP4", "bytes=2-5")
+	if response.StatusCode != http.StatusPartialContent || string(body) != "2345" || response.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("expected partial content 2345 (MISS), got %d %q (%s)", response.StatusCode, body, response.Header.Get("X-Cache"))
+	}
+	response, body = get(t, server.URL+"/DCIM/MOVIE/A.MP4", "bytes=7-")
+	if string(body) != "789" || response.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("expected partial content 789 (HIT), got %q (%s)", body, response.Header.Get("X-Cache"))
+	}
+	if atomic.LoadInt32(&cameraRequests) != 1 {
+		t.Errorf("expected a single request to the camera, got %d", cameraRequests)
+	}
+
+	// Fetching B and C evicts A, the least recently used file
+	get(t, server.URL+"/DCIM/MOVIE/B.MP4", "")
+	get(t, server.URL+"/DCIM/MOVIE/C.MP4", "")
+	if cache.Contains("/DCIM/MOVIE/A.MP4", 10) || !cache.Contains("/DCIM/MOVIE/B.MP4", 10) || !cache.Contains("/DCIM/MOVIE/C.MP4", 10) {
+		t.Error("expected A to be evicted from the cache")
+	}
+	if cache.Used() != 20 {
+		t.Errorf("expected 20 Bytes to be cached, got %d", cache.Used())
+	}
+
+	_, body = get(t, server.URL+"/", "")
+	listing := make([]listEntry, 0)
+	err = json.Unmarshal(body, &listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing) != 3 || listing[0].Cached || !listing[1].Cached || listing[1].URL != "/DCIM/MOVIE/B.MP4" || listing[1].Kind != "video" {
+		t.Errorf("unexpected listing: %+v", listing)
+	}
+
+	response, _ = get(t, server.URL+"/DCIM/MOVIE/D.MP4", "")
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected unknown files to be rejected, got %d", response.StatusCode)
+	}
+}
+
+func TestCacheReusesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer camera.Close()
+
+	cache, err := NewCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _, release, err := cache.Open(context.Background(), "/DCIM/A.MP4", camera.URL, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	release()
+
+	cache, err = NewCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cache.Contains("/DCIM/A.MP4", 10) {
+		t.Error("expected the cached file to be found after a restart")
+	}
+}
@@ -0,0 +1,159 @@
+package hls
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mp4"
+	"github.com/jonas-koeritz/actioncam/mpegts"
+)
+
+// defaultFrameDuration is assumed for frames without a successor at the same time
+const defaultFrameDuration = 33 * time.Millisecond
+
+// segment is a media segment of the playlist, fMP4 segments consist of parts
+// that are listed individually for low latency clients
+type segment struct {
+	sequence int
+	duration time.Duration
+	parts    []*part
+	data     []byte
+}
+
+// part is a partial segment, a single movie fragment
+type part struct {
+	data        []byte
+	duration    time.Duration
+	independent bool
+}
+
+// WriteFrame adds a frame of the preview stream, segmentation starts with the first key frame
+func (s *Server) WriteFrame(frame libipcamera.Frame) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.parameterSets.Update(frame)
+	keyFrame := frame.IsKeyFrame()
+
+	if s.current == nil {
+		if !keyFrame || !s.parameterSets.Complete() {
+			return nil
+		}
+		err := s.start(frame)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The duration of a frame is known once its successor has been received
+	if s.pending != nil {
+		duration := frame.PTS - s.pending.PTS
+		if duration <= 0 {
+			duration = defaultFrameDuration
+		}
+		if s.Format == FormatFMP4 && s.partDuration > 0 && s.partDuration+duration > s.PartDuration {
+			s.finishPart()
+		}
+		s.addFrame(*s.pending, duration)
+	}
+
+	if keyFrame && s.current.duration+s.partDuration >= s.SegmentDuration {
+		s.finishPart()
+		s.finishSegment()
+	}
+
+	s.pending = &frame
+	return nil
+}
+
+// start initializes the segmenter with the first key frame
+func (s *Server) start(frame libipcamera.Frame) error {
+	sps, err := libipcamera.ParseSPS(s.parameterSets.SPS)
+	if err != nil {
+		return err
+	}
+	config := mp4.NewAVCDecoderConfiguration(s.parameterSets.SPS, s.parameterSets.PPS)
+	s.init = mp4.InitSegment(config, uint16(sps.Width), uint16(sps.Height))
+	s.muxer = mpegts.NewMuxer(&s.transportStream)
+	s.startTime = frame.PTS
+	s.current = &segment{sequence: 0}
+	return nil
+}
+
+// addFrame adds a frame to the current part (fMP4) or segment (MPEG-TS)
+func (s *Server) addFrame(frame libipcamera.Frame, duration time.Duration) {
+	keyFrame := frame.IsKeyFrame()
+	elapsed := uint64((frame.PTS - s.startTime).Milliseconds())
+
+	if s.Format == FormatTS {
+		s.muxer.WriteAccessUnit(s.parameterSets.Prepend(frame), elapsed*mpegts.ClockRate/1000, keyFrame)
+		s.current.duration += duration
+		return
+	}
+
+	nalUnits := make([][]byte, 0)
+	for _, nal := range frame.NALUnits() {
+		if nal.Type() != libipcamera.NALUnitAccessUnitDelimiter {
+			nalUnits = append(nalUnits, nal)
+		}
+	}
+	s.samples = append(s.samples, mp4.Sample{
+		Data:       mp4.SampleFromNALUnits(nalUnits...),
+		DecodeTime: elapsed * mp4.VideoTimescale / 1000,
+		Duration:   uint32(uint64(duration.Milliseconds()) * mp4.VideoTimescale / 1000),
+		Sync:       keyFrame,
+	})
+	s.partDuration += duration
+}
+
+// finishPart turns the buffered samples into a part of the current segment
+func (s *Server) finishPart() {
+	if len(s.samples) == 0 {
+		return
+	}
+	s.fragmentSequence++
+	s.current.parts = append(s.current.parts, &part{
+		data:        mp4.Fragment(s.fragmentSequence, s.samples),
+		duration:    s.partDuration,
+		independent: s.samples[0].Sync,
+	})
+	s.current.duration += s.partDuration
+	s.samples = nil
+	s.partDuration = 0
+	s.notify()
+}
+
+// finishSegment completes the current segment and removes segments that left the window
+func (s *Server) finishSegment() {
+	if s.current.duration == 0 {
+		return
+	}
+
+	if s.Format == FormatTS {
+		s.current.data = append([]byte(nil), s.transportStream.Bytes()...)
+		s.transportStream.Reset()
+	} else {
+		data := bytes.Buffer{}
+		for _, part := range s.current.parts {
+			data.Write(part.data)
+		}
+		s.current.data = data.Bytes()
+	}
+
+	s.segments = append(s.segments, s.current)
+	for len(s.segments) > s.WindowSize {
+		// Release the oldest segment right away
+		copy(s.segments, s.segments[1:])
+		s.segments[len(s.segments)-1] = nil
+		s.segments = s.segments[:len(s.segments)-1]
+	}
+	s.current = &segment{sequence: s.current.sequence + 1}
+	s.notify()
+}
+
+// notify wakes up all clients waiting for an update of the playlist
+func (s *Server) notify() {
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
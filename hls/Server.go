@@ -0,0 +1,329 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mp4"
+	"github.com/jonas-koeritz/actioncam/mpegts"
+)
+
+// Segment formats
+const (
+	// FormatFMP4 uses fragmented MP4 segments split into parts for low latency clients (LL-HLS)
+	FormatFMP4 = "fmp4"
+	// FormatTS uses MPEG transport stream segments
+	FormatTS = "ts"
+)
+
+// Defaults of the segmentation parameters
+const (
+	DefaultSegmentDuration = 2 * time.Second
+	DefaultPartDuration    = 500 * time.Millisecond
+	DefaultWindowSize      = 6
+)
+
+// lowLatencySegments is the number of completed segments whose parts are listed in the playlist
+const lowLatencySegments = 2
+
+// Server segments the preview stream and serves it via HTTP Live Streaming, it is a
+// libipcamera.FrameSink. Only the last WindowSize segments are kept in memory.
+type Server struct {
+	Format          string
+	SegmentDuration time.Duration
+	PartDuration    time.Duration
+	WindowSize      int
+
+	lock sync.Mutex
+	// updated is closed and replaced whenever a part or segment has been added
+	updated       chan struct{}
+	parameterSets libipcamera.ParameterSets
+	init          []byte
+	startTime     time.Duration
+	pending       *libipcamera.Frame
+	segments      []*segment
+	current       *segment
+
+	// fMP4 samples of the current part
+	samples          []mp4.Sample
+	partDuration     time.Duration
+	fragmentSequence uint32
+
+	// MPEG-TS of the current segment
+	muxer           *mpegts.Muxer
+	transportStream bytes.Buffer
+}
+
+// NewServer creates a Server using the given segment format and the default parameters
+func NewServer(format string) (*Server, error) {
+	if format != FormatFMP4 && format != FormatTS {
+		return nil, fmt.Errorf("Unknown segment format %s (fmp4, ts)", format)
+	}
+	return &Server{
+		Format:          format,
+		SegmentDuration: DefaultSegmentDuration,
+		PartDuration:    DefaultPartDuration,
+		WindowSize:      DefaultWindowSize,
+		updated:         make(chan struct{}),
+	}, nil
+}
+
+// segmentExtension returns the file extension of media segments
+func (s *Server) segmentExtension() string {
+	if s.Format == FormatTS {
+		return "ts"
+	}
+	return "m4s"
+}
+
+// ServeHTTP serves the player page, the playlist and the segments
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case name == "" || name == "index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(playerPage))
+	case name == "stream.m3u8":
+		s.servePlaylist(w, r)
+	case name == "init.mp4" && s.Format == FormatFMP4:
+		s.lock.Lock()
+		initSegment := s.init
+		s.lock.Unlock()
+		if initSegment == nil {
+			http.Error(w, "Stream not started", http.StatusServiceUnavailable)
+			return
+		}
+		serveMedia(w, "video/mp4", initSegment)
+	case strings.HasPrefix(name, "segment-"):
+		var sequence int
+		_, err := fmt.Sscanf(name, "segment-%d."+s.segmentExtension(), &sequence)
+		data, found := s.segment(sequence)
+		if err != nil || !found {
+			http.NotFound(w, r)
+			return
+		}
+		serveMedia(w, s.contentType(), data)
+	case strings.HasPrefix(name, "part-") && s.Format == FormatFMP4:
+		var sequence, index int
+		_, err := fmt.Sscanf(name, "part-%d.%d.m4s", &sequence, &index)
+		data, found := s.part(sequence, index)
+		if err != nil || !found {
+			http.NotFound(w, r)
+			return
+		}
+		serveMedia(w, s.contentType(), data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) contentType() string {
+	if s.Format == FormatTS {
+		return "video/mp2t"
+	}
+	return "video/iso.segment"
+}
+
+func serveMedia(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Write(data)
+}
+
+// segment returns the data of a completed segment in the window
+func (s *Server) segment(sequence int) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, segment := range s.segments {
+		if segment.sequence == sequence {
+			return segment.data, true
+		}
+	}
+	return nil, false
+}
+
+// part returns the data of a part of a completed segment in the window or of the current segment
+func (s *Server) part(sequence, index int) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	candidates := s.segments
+	if s.current != nil {
+		candidates = append(candidates[:len(candidates):len(candidates)], s.current)
+	}
+	for _, segment := range candidates {
+		if segment.sequence == sequence && index >= 0 && index < len(segment.parts) {
+			return segment.parts[index].data, true
+		}
+	}
+	return nil, false
+}
+
+// servePlaylist serves the media playlist, requests for future segments or parts
+// (_HLS_msn and _HLS_part) are blocked until they are available
+func (s *Server) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	msn, part := -1, -1
+	if value := r.URL.Query().Get("_HLS_msn"); value != "" {
+		var err error
+		msn, err = strconv.Atoi(value)
+		if err != nil || msn < 0 {
+			http.Error(w, "Invalid _HLS_msn", http.StatusBadRequest)
+			return
+		}
+		if value := r.URL.Query().Get("_HLS_part"); value != "" {
+			part, err = strconv.Atoi(value)
+			if err != nil || part < 0 {
+				http.Error(w, "Invalid _HLS_part", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	timeout := time.NewTimer(3 * s.SegmentDuration)
+	defer timeout.Stop()
+	for {
+		s.lock.Lock()
+		ready, valid := s.available(msn, part)
+		if !valid {
+			s.lock.Unlock()
+			http.Error(w, "Requested segment is too far in the future", http.StatusBadRequest)
+			return
+		}
+		if ready {
+			playlist := s.playlist()
+			s.lock.Unlock()
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte(playlist))
+			return
+		}
+		updated := s.updated
+		s.lock.Unlock()
+
+		select {
+		case <-updated:
+		case <-timeout.C:
+			http.Error(w, "Stream not available", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// available returns true if the playlist contains the requested segment and part,
+// valid is false if the request is too far in the future. The lock must be held.
+func (s *Server) available(msn, part int) (ready bool, valid bool) {
+	if len(s.segments) == 0 {
+		return false, true
+	}
+	if msn < 0 {
+		return true, true
+	}
+	switch {
+	case msn < s.current.sequence:
+		return true, true
+	case msn == s.current.sequence:
+		return part >= 0 && part < len(s.current.parts), true
+	case msn == s.current.sequence+1:
+		return false, true
+	}
+	return false, false
+}
+
+// playlist returns the media playlist of the current window, the lock must be held
+func (s *Server) playlist() string {
+	lowLatency := s.Format == FormatFMP4
+	extension := s.segmentExtension()
+
+	targetDuration := s.SegmentDuration
+	for _, segment := range s.segments {
+		if segment.duration > targetDuration {
+			targetDuration = segment.duration
+		}
+	}
+
+	playlist := &strings.Builder{}
+	fmt.Fprintf(playlist, "#EXTM3U\n")
+	if lowLatency {
+		fmt.Fprintf(playlist, "#EXT-X-VERSION:9\n")
+	} else {
+		fmt.Fprintf(playlist, "#EXT-X-VERSION:3\n")
+	}
+	fmt.Fprintf(playlist, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration.Seconds())))
+	if lowLatency {
+		fmt.Fprintf(playlist, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*s.PartDuration.Seconds())
+		fmt.Fprintf(playlist, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", s.PartDuration.Seconds())
+	}
+	fmt.Fprintf(playlist, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.segments[0].sequence)
+	if lowLatency {
+		fmt.Fprintf(playlist, "#EXT-X-MAP:URI=\"init.mp4\"\n")
+	}
+
+	writeParts := func(segment *segment) {
+		for i, part := range segment.parts {
+			independent := ""
+			if part.independent {
+				independent = ",INDEPENDENT=YES"
+			}
+			fmt.Fprintf(playlist, "#EXT-X-PART:DURATION=%.3f,URI=\"part-%d.%d.m4s\"%s\n", part.duration.Seconds(), segment.sequence, i, independent)
+		}
+	}
+
+	for i, segment := range s.segments {
+		if lowLatency && i >= len(s.segments)-lowLatencySegments {
+			writeParts(segment)
+		}
+		fmt.Fprintf(playlist, "#EXTINF:%.3f,\nsegment-%d.%s\n", segment.duration.Seconds(), segment.sequence, extension)
+	}
+	if lowLatency {
+		writeParts(s.current)
+	}
+	return playlist.String()
+}
+
+// playerPage plays the stream using the native HLS support of the browser or hls.js, hls.js
+// is loaded from a CDN and is only available if the browser has internet access
+const playerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>actioncam preview</title>
+<style>
+body { margin: 0; background: #000; }
+video { width: 100vw; height: 100vh; }
+</style>
+<script src="https://cdn.jsdelivr.net/npm/hls.js@1"></script>
+</head>
+<body>
+<video id="preview" controls autoplay muted playsinline></video>
+<script>
+var video = document.getElementById("preview");
+if (video.canPlayType("application/vnd.apple.mpegurl")) {
+	video.src = "stream.m3u8";
+} else if (window.Hls && Hls.isSupported()) {
+	var hls = new Hls({ lowLatencyMode: true });
+	hls.loadSource("stream.m3u8");
+	hls.attachMedia(video);
+} else {
+	document.body.style.color = "#fff";
+	document.body.textContent = "This browser can not play HLS streams natively and hls.js could not be loaded, " +
+		"it requires internet access. Open stream.m3u8 in a player instead.";
+}
+</script>
+</body>
+</html>
+`
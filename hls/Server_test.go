@@ -0,0 +1,158 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// testSPS describes a 640x480 Baseline stream
+var testSPS = []byte{0x67, 0x42, 0x00, 0x1F, 0xDA, 0x02, 0x80, 0xF6, 0x40}
+
+// testFrame returns frame i of a 30 fps stream with a key frame every second
+func testFrame(i int) libipcamera.Frame {
+	data := []byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9A, byte(i)}
+	if i%30 == 0 {
+		data = append(append(append([]byte{0x00, 0x00, 0x00, 0x01}, testSPS...), 0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x3C, 0x80), 0x00, 0x00, 0x00, 0x01, 0x65, 0x88, byte(i))
+	}
+	return libipcamera.Frame{Data: data, PTS: time.Duration(i) * time.Second / 30}
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response.StatusCode, body
+}
+
+func TestServerFMP4(t *testing.T) {
+	server, err := NewServer(FormatFMP4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.WindowSize = 3
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// 10 seconds of video result in 5 completed segments of 2 seconds
+	for i := 0; i <= 300; i++ {
+		server.WriteFrame(testFrame(i))
+	}
+
+	status, body := get(t, httpServer.URL+"/stream.m3u8")
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	playlist := string(body)
+	for _, expected := range []string{
+		"#EXT-X-TARGETDURATION:2\n",
+		"#EXT-X-MEDIA-SEQUENCE:2\n",
+		"#EXT-X-MAP:URI=\"init.mp4\"\n",
+		"#EXT-X-PART-INF:PART-TARGET=0.500\n",
+		"#EXTINF:2.000,\nsegment-3.m4s\n",
+		"#EXT-X-PART:DURATION=0.500,URI=\"part-3.0.m4s\",INDEPENDENT=YES\n",
+		"URI=\"part-4.3.m4s\"",
+	} {
+		if !strings.Contains(playlist, expected) {
+			t.Errorf("expected %q in playlist:\n%s", expected, playlist)
+		}
+	}
+	// Only the window of 3 segments is kept
+	if strings.Contains(playlist, "segment-1.m4s") || strings.Contains(playlist, "part-2.0.m4s") {
+		t.Errorf("playlist contains segments outside of the window:\n%s", playlist)
+	}
+	if status, _ := get(t, httpServer.URL+"/segment-1.m4s"); status != http.StatusNotFound {
+		t.Errorf("expected segment 1 to be removed, got status %d", status)
+	}
+
+	_, init := get(t, httpServer.URL+"/init.mp4")
+	file, err := mp4.Open(bytes.NewReader(init), int64(len(init)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track, found := file.VideoTrack(); !found || track.Width != 640 || track.Height != 480 {
+		t.Errorf("unexpected init segment %+v", file.Tracks)
+	}
+
+	status, segment := get(t, httpServer.URL+"/segment-3.m4s")
+	if status != http.StatusOK || string(segment[4:8]) != "moof" {
+		t.Errorf("unexpected segment (%d) %X", status, segment[:8])
+	}
+	_, part := get(t, httpServer.URL+"/part-3.0.m4s")
+	if !bytes.HasPrefix(segment, part) {
+		t.Error("segment does not start with its first part")
+	}
+
+	// Blocking playlist reload returns once the requested part is available
+	done := make(chan string)
+	go func() {
+		response, err := http.Get(httpServer.URL + "/stream.m3u8?_HLS_msn=5&_HLS_part=0")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		done <- string(body)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	for i := 301; i <= 361; i++ {
+		server.WriteFrame(testFrame(i))
+	}
+	select {
+	case playlist := <-done:
+		if !strings.Contains(playlist, "part-5.0.m4s") {
+			t.Errorf("expected part 5.0 in playlist:\n%s", playlist)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking playlist request did not return")
+	}
+
+	if status, _ := get(t, httpServer.URL+"/stream.m3u8?_HLS_msn=10"); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a segment far in the future, got %d", status)
+	}
+}
+
+func TestServerTS(t *testing.T) {
+	server, err := NewServer(FormatTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	for i := 0; i <= 120; i++ {
+		server.WriteFrame(testFrame(i))
+	}
+
+	_, body := get(t, httpServer.URL+"/stream.m3u8")
+	playlist := string(body)
+	if strings.Contains(playlist, "#EXT-X-PART") || strings.Contains(playlist, "#EXT-X-MAP") {
+		t.Errorf("unexpected low latency tags in MPEG-TS playlist:\n%s", playlist)
+	}
+	for i := 0; i < 2; i++ {
+		if !strings.Contains(playlist, fmt.Sprintf("#EXTINF:2.000,\nsegment-%d.ts\n", i)) {
+			t.Errorf("expected segment %d in playlist:\n%s", i, playlist)
+		}
+	}
+
+	status, segment := get(t, httpServer.URL+"/segment-1.ts")
+	if status != http.StatusOK || len(segment)%188 != 0 || segment[0] != 0x47 {
+		t.Errorf("unexpected segment (%d, %d Bytes)", status, len(segment))
+	}
+
+	if _, err := NewServer("mkv"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
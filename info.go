@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// handlerNames are readable names of MP4 media handlers
+var handlerNames = map[string]string{
+	"vide": "video",
+	"soun": "audio",
+	"meta": "metadata",
+	"text": "text",
+	"sbtl": "subtitles",
+}
+
+// printMediaInfo writes a summary of the metadata of an MP4 file to w
+func printMediaInfo(w io.Writer, name string, size int64, file *mp4.File) error {
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(out, "File:\t%s\n", name)
+	fmt.Fprintf(out, "Size:\t%d Bytes\n", size)
+	if file.Brand != "" {
+		fmt.Fprintf(out, "Container:\t%s (%s)\n", strings.TrimSpace(file.Brand), strings.Join(file.CompatibleBrands, ", "))
+	}
+	if !file.CreationTime.IsZero() {
+		// Cameras write their local time without a time zone
+		fmt.Fprintf(out, "Created:\t%s\n", file.CreationTime.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Fprintf(out, "Duration:\t%s\n", file.Duration())
+	if location, found := file.Location(); found {
+		fmt.Fprintf(out, "Location:\t%s\n", location)
+	}
+
+	for _, track := range file.Tracks {
+		handler, known := handlerNames[track.Handler]
+		if !known {
+			handler = track.Handler
+		}
+
+		details := []string{fmt.Sprintf("%s %s", handler, strings.TrimSpace(track.Codec))}
+		if track.AVCConfig != nil {
+			details = append(details, track.AVCConfig.ProfileName())
+		}
+		if track.Handler == "vide" {
+			details = append(details, fmt.Sprintf("%dx%d", track.Width, track.Height), fmt.Sprintf("%.2f fps", track.FrameRate()))
+		}
+		if track.Handler == "soun" {
+			details = append(details, fmt.Sprintf("%d Hz", track.Timescale))
+		}
+		details = append(details, track.MediaDuration().String(), fmt.Sprintf("%d samples", track.SampleCount()))
+		fmt.Fprintf(out, "Track %d:\t%s\n", track.ID, strings.Join(details, ", "))
+	}
+
+	for i, userData := range file.UserData {
+		label := ""
+		if i == 0 {
+			label = "User data:"
+		}
+		if text, ok := userData.Text(); ok {
+			fmt.Fprintf(out, "%s\t%s: %s\n", label, userData.Type, text)
+		} else {
+			fmt.Fprintf(out, "%s\t%s: (%d Bytes)\n", label, userData.Type, userData.Size)
+		}
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,35 @@
+package libipcamera
+
+import (
+	"io"
+	"time"
+)
+
+// AnnexBRecorder is a FrameSink writing the raw H.264 elementary stream in Annex-B format,
+// frames received before the first key frame are skipped. The parameter sets are repeated
+// before every key frame so decoders can start at any key frame.
+type AnnexBRecorder struct {
+	recorder
+	w io.Writer
+}
+
+// NewAnnexBRecorder creates a recorder writing to w, every frame is written with a single call to w.Write
+func NewAnnexBRecorder(w io.Writer) *AnnexBRecorder {
+	r := &AnnexBRecorder{w: w}
+	r.container = r
+	return r
+}
+
+func (r *AnnexBRecorder) begin(parameterSets *ParameterSets) error {
+	return nil
+}
+
+func (r *AnnexBRecorder) writeAccessUnit(frame Frame, elapsed time.Duration, parameterSets *ParameterSets) error {
+	_, err := r.w.Write(parameterSets.Prepend(frame))
+	return err
+}
+
+// finish does nothing, the elementary stream needs no finalization
+func (r *AnnexBRecorder) finish() error {
+	return nil
+}
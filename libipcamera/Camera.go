@@ -7,25 +7,36 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/url"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
 // Camera contains all information and features on a single IP Camera
 type Camera struct {
-	ipAddress       net.IP
-	port            int
-	username        string
-	password        string
+	ipAddress net.IP
+	port      int
+	username  string
+	password  string
+	verbose   bool
+	profile   *DeviceProfile
+
+	// lock guards the connection state and the message handlers, they are shared with
+	// the goroutine handling the incoming messages
+	lock            sync.Mutex
 	connected       bool
 	disconnect      bool
-	verbose         bool
 	connection      net.Conn
 	isLoggedIn      bool
 	messageHandlers map[uint32][]MessageHandler
+	// done is closed when the goroutine handling the current connection exits
+	done chan struct{}
 }
 
+// dialTimeout limits the time to establish the control connection
+const dialTimeout = 10 * time.Second
+
 // MessageHandler is used to process incoming messages from the camera
 type MessageHandler func(camera *Camera, message *Message) (bool, error)
 
@@ -54,12 +65,6 @@ const (
 	KeepHandler = false
 )
 
-// StoredFile is a file stored on the cameras sd-card
-type StoredFile struct {
-	Path string
-	Size uint64
-}
-
 // CreateCamera creates a new Camera instance
 func CreateCamera(ipAddress net.IP, port int, username, password string) (*Camera, error) {
 	if ipAddress == nil {
@@ -72,30 +77,153 @@ func CreateCamera(ipAddress net.IP, port int, username, password string) (*Camer
 		password:        password,
 		messageHandlers: make(map[uint32][]MessageHandler, 0),
 		verbose:         true,
+		profile:         GenericProfile,
 	}
 	return camera, nil
 }
 
+// IPAddress returns the IP-Address of the camera
+func (c *Camera) IPAddress() net.IP {
+	return c.ipAddress
+}
+
+// PreviewAddress returns the local address the preview stream of the camera is received on
+func (c *Camera) PreviewAddress() string {
+	return net.JoinHostPort("", strconv.Itoa(c.profile.PreviewPort))
+}
+
+// FileURL returns the URL to download a file stored on the cameras SD-Card from its HTTP server
+func (c *Camera) FileURL(path string) string {
+	host := c.ipAddress.String()
+	if c.profile.HTTPPort != 80 {
+		host = net.JoinHostPort(host, strconv.Itoa(c.profile.HTTPPort))
+	} else if c.ipAddress.To4() == nil {
+		host = "[" + host + "]"
+	}
+	return (&url.URL{Scheme: "http", Host: host, Path: path}).String()
+}
+
+// Profile returns the device profile used for this camera
+func (c *Camera) Profile() *DeviceProfile {
+	return c.profile
+}
+
+// SetProfile changes the device profile used for this camera
+func (c *Camera) SetProfile(profile *DeviceProfile) {
+	if profile == nil {
+		profile = GenericProfile
+	}
+	c.profile = profile
+}
+
+// DetectProfile selects the device profile matching the cameras firmware information
+func (c *Camera) DetectProfile() (*DeviceProfile, error) {
+	firmware, err := c.GetFirmwareInfo()
+	if err != nil {
+		return c.profile, err
+	}
+	c.profile = ProfileForFirmware(firmware)
+	c.Log("Using device profile %s", c.profile)
+	return c.profile, nil
+}
+
+// requireCommand checks that the camera is logged in and supports the given command
+func (c *Camera) requireCommand(command uint32) error {
+	c.lock.Lock()
+	isLoggedIn := c.isLoggedIn
+	c.lock.Unlock()
+	if !isLoggedIn {
+		return errors.New("Camera Login required")
+	}
+	return c.checkSupported(command)
+}
+
+// checkSupported fails fast if the cameras device profile does not support the given command
+func (c *Camera) checkSupported(command uint32) error {
+	if !c.profile.Supports(command) {
+		return fmt.Errorf("%w: 0x%04X is not supported by profile %s", ErrUnsupportedCommand, command, c.profile.Name)
+	}
+	return nil
+}
+
 // Connect to the camera and start responding to keepalive packets
 func (c *Camera) Connect() {
 	if c.verbose {
 		log.Printf("Connecting to %s:%d using username=%s, password=%s\n", c.ipAddress, c.port, c.username, c.password)
 	}
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", c.ipAddress, c.port))
+	err := c.dial()
 	if err != nil {
 		log.Printf("ERROR: %s\n", err)
-		return
 	}
+}
+
+// Reconnect closes the connection to the camera and logs in again using a new connection,
+// handlers waiting for responses on the old connection are discarded
+func (c *Camera) Reconnect() error {
+	done := c.closeConnection()
+	// The old connection must not run handlers while the state is reset
+	if done != nil {
+		<-done
+	}
+
+	c.lock.Lock()
+	c.isLoggedIn = false
+	c.messageHandlers = make(map[uint32][]MessageHandler, 0)
+	c.lock.Unlock()
+
+	c.Log("Reconnecting to %s:%d", c.ipAddress, c.port)
+	err := c.dial()
+	if err != nil {
+		return err
+	}
+	return c.Login()
+}
+
+// dial opens the control connection and starts handling the incoming messages
+func (c *Camera) dial() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.ipAddress.String(), strconv.Itoa(c.port)), dialTimeout)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	c.lock.Lock()
 	c.connection = conn
+	c.disconnect = false
+	c.connected = true
+	c.done = done
+	c.lock.Unlock()
 
 	c.HandleFirst(ALIVE_REQUEST, aliveRequestHandler)
 
-	go c.handleConnection()
+	go c.handleConnection(conn, done)
+	return nil
+}
+
+// closeConnection marks the camera as disconnected and closes the connection, the returned
+// channel is closed once the goroutine handling the connection has exited
+func (c *Camera) closeConnection() <-chan struct{} {
+	c.lock.Lock()
+	c.disconnect = true
+	c.connected = false
+	conn, done := c.connection, c.done
+	c.lock.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	return done
+}
+
+// disconnecting returns true if the connection has been closed deliberately
+func (c *Camera) disconnecting() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.disconnect
 }
 
 // Login will try to login to the camera control service
 func (c *Camera) Login() error {
-	loginAccept := make(chan bool, 0)
+	loginAccept := make(chan bool, 1)
 
 	c.Handle(LOGIN_ACCEPT, func(c *Camera, m *Message) (bool, error) {
 		_, err := loginResultHandler(c, m)
@@ -119,22 +247,25 @@ func (c *Camera) Login() error {
 
 // IsConnected returns true if the camera connection has not been disconnected
 func (c *Camera) IsConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	return c.connected
 }
 
-func (c *Camera) handleConnection() {
+func (c *Camera) handleConnection(conn net.Conn, done chan struct{}) {
+	defer close(done)
 	header := Header{}
 	var payload []byte
 
 	for {
-		if c.disconnect {
+		if c.disconnecting() {
 			break
 		}
 
 		// Read the header from the wire
-		err := binary.Read(c.connection, binary.BigEndian, &header)
+		err := binary.Read(conn, binary.BigEndian, &header)
 		if err != nil {
-			if !c.disconnect {
+			if !c.disconnecting() {
 				log.Printf("ERROR Reading from Camera: %s\n", err)
 			}
 			break
@@ -149,7 +280,7 @@ func (c *Camera) handleConnection() {
 		// Read the payload from the wire (if any)
 		if header.Length > 0 {
 			payload = make([]byte, header.Length)
-			bytesRead, err := io.ReadFull(c.connection, payload)
+			bytesRead, err := io.ReadFull(conn, payload)
 			if err != nil || (uint16(bytesRead) != header.Length) {
 				log.Printf("ERROR Reading Payload from Camera: %s, expected %d Bytes, got %d\n", err, header.Length, bytesRead)
 				break
@@ -163,15 +294,21 @@ func (c *Camera) handleConnection() {
 			Payload: payload,
 		}
 
+		// Take the handlers of this message type, handlers added while they run are kept
+		c.lock.Lock()
+		messageHandlers := c.messageHandlers[header.MessageType]
+		c.messageHandlers[header.MessageType] = nil
+		c.lock.Unlock()
+
 		// If there is not registered handler, dump the message
-		if len(c.messageHandlers[header.MessageType]) == 0 {
+		if len(messageHandlers) == 0 {
 			log.Printf("Received Unknown Message (no handler registered):\n%s\n", message)
 			continue
 		}
 
 		// Run all registered handlers for this message type
 		remainingMessageHandlers := make([]MessageHandler, 0)
-		for _, handler := range c.messageHandlers[header.MessageType] {
+		for _, handler := range messageHandlers {
 			remove, err := handler(c, message)
 			if remove == KeepHandler {
 				remainingMessageHandlers = append(remainingMessageHandlers, handler)
@@ -183,10 +320,15 @@ func (c *Camera) handleConnection() {
 			}
 		}
 		// replace handlers with all but the one-shot handlers
-		c.messageHandlers[header.MessageType] = remainingMessageHandlers
+		c.lock.Lock()
+		c.messageHandlers[header.MessageType] = append(remainingMessageHandlers, c.messageHandlers[header.MessageType]...)
+		c.lock.Unlock()
 	}
-	c.Log("Disconnected")
+
+	c.lock.Lock()
 	c.connected = false
+	c.lock.Unlock()
+	c.Log("Disconnected")
 }
 
 // Handle adds a new message handler to the list of message handlers for a given message type
@@ -201,6 +343,8 @@ func (c *Camera) HandleFirst(messageType uint32, handleFunc MessageHandler) {
 }
 
 func (c *Camera) addHandler(messageType uint32, handleFunc MessageHandler, prepend bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	if c.messageHandlers[messageType] == nil {
 		c.messageHandlers[messageType] = make([]MessageHandler, 0)
 	}
@@ -216,24 +360,32 @@ func (c *Camera) addHandler(messageType uint32, handleFunc MessageHandler, prepe
 func (c *Camera) Log(format string, data ...interface{}) {
 	if c.verbose {
 		if data != nil {
-			log.Printf(format+"\n", data)
+			log.Printf(format+"\n", data...)
 		} else {
 			log.Printf(format + "\n")
 		}
 	}
 }
 
-// GetFileList retrieves a list of files stored on the cameras SD-Card
-func (c *Camera) GetFileList() ([]StoredFile, error) {
-	fileListComplete := make(chan []StoredFile, 1)
+// GetFileList retrieves a list of files stored on the cameras SD-Card, if the list contains
+// malformed entries the valid entries are returned together with a *FileListError
+func (c *Camera) GetFileList() (FileList, error) {
+	if err := c.checkSupported(REQUEST_FILE_LIST); err != nil {
+		return nil, err
+	}
+
+	fileListComplete := make(chan string, 1)
 	fileListData := ""
 
 	c.Handle(FILE_LIST_CONTENT, func(c *Camera, m *Message) (bool, error) {
+		if len(m.Payload) < 8 {
+			return KeepHandler, errors.New("Received truncated file list message")
+		}
 		numParts := binary.LittleEndian.Uint32(m.Payload[:4])
 		currentPart := binary.LittleEndian.Uint32(m.Payload[4:8])
 		fileListData += string(m.Payload[8:])
 		if currentPart+1 >= numParts {
-			fileListComplete <- parseFileList(fileListData)
+			fileListComplete <- fileListData
 			return RemoveHandler, nil
 		}
 		return KeepHandler, nil
@@ -246,35 +398,16 @@ func (c *Camera) GetFileList() ([]StoredFile, error) {
 
 	select {
 	case result := <-fileListComplete:
-		return result, nil
+		return parseFileList(result)
 	case <-time.After(10 * time.Second):
 		return nil, errors.New("Timed out while loading file list")
 	}
 }
 
-func parseFileList(input string) []StoredFile {
-	files := strings.Split(input, ";")
-	stored := make([]StoredFile, len(files)-1)
-	for i, file := range files {
-		parts := strings.Split(file, ":")
-		if len(parts) == 2 {
-			size, err := strconv.ParseUint(parts[1], 10, 64)
-
-			if err == nil && size > 0 && len(parts[0]) > 0 {
-				stored[i] = StoredFile{
-					Path: parts[0],
-					Size: size,
-				}
-			}
-		}
-	}
-	return stored
-}
-
 // GetFirmwareInfo will request firmware information from the camera
 func (c *Camera) GetFirmwareInfo() (string, error) {
-	if !c.isLoggedIn {
-		return "", errors.New("Camera Login required")
+	if err := c.requireCommand(REQUEST_FIRMWARE_INFO); err != nil {
+		return "", err
 	}
 
 	firmwareInfo := make(chan string, 1)
@@ -297,14 +430,20 @@ func (c *Camera) GetFirmwareInfo() (string, error) {
 
 // SendPacket sends a raw packet to the camera
 func (c *Camera) SendPacket(packet []byte) error {
-	_, err := c.connection.Write(packet)
+	c.lock.Lock()
+	conn := c.connection
+	c.lock.Unlock()
+	if conn == nil {
+		return errors.New("Camera is not connected")
+	}
+	_, err := conn.Write(packet)
 	return err
 }
 
 // TakePicture instructs the camera to take a still image
 func (c *Camera) TakePicture() error {
-	if !c.isLoggedIn {
-		return errors.New("Camera Login required")
+	if err := c.requireCommand(TAKE_PICTURE); err != nil {
+		return err
 	}
 
 	pictureTaken := make(chan bool, 1)
@@ -329,8 +468,8 @@ func (c *Camera) TakePicture() error {
 
 // StartPreviewStream starts streaming video to this host
 func (c *Camera) StartPreviewStream() error {
-	if !c.isLoggedIn {
-		return errors.New("Camera Login required")
+	if err := c.requireCommand(START_PREVIEW); err != nil {
+		return err
 	}
 	c.Log("Starting Preview Stream")
 	return c.SendPacket(CreateCommandPacket(START_PREVIEW))
@@ -338,8 +477,8 @@ func (c *Camera) StartPreviewStream() error {
 
 // StartRecording starts recording video to SD-Card
 func (c *Camera) StartRecording() error {
-	if !c.isLoggedIn {
-		return errors.New("Camera Login required")
+	if err := c.requireCommand(CONTROL_RECORDING); err != nil {
+		return err
 	}
 
 	recordCommandAccept := make(chan bool, 1)
@@ -366,8 +505,8 @@ func (c *Camera) StartRecording() error {
 
 // StopRecording stops recording video to SD-Card
 func (c *Camera) StopRecording() error {
-	if !c.isLoggedIn {
-		return errors.New("Camera Login required")
+	if err := c.requireCommand(CONTROL_RECORDING); err != nil {
+		return err
 	}
 
 	recordCommandAccept := make(chan bool, 1)
@@ -394,9 +533,7 @@ func (c *Camera) StopRecording() error {
 
 // Disconnect from the camera
 func (c *Camera) Disconnect() {
-	c.disconnect = true
-	c.connected = false
-	c.connection.Close()
+	c.closeConnection()
 }
 
 // SetVerbose changes the verbosity setting of this camera object
@@ -419,7 +556,9 @@ func firmwareInfoHandler(camera *Camera, message *Message) (bool, error) {
 
 func loginResultHandler(camera *Camera, message *Message) (bool, error) {
 	if message.Header.MessageType == 0x0111 {
+		camera.lock.Lock()
 		camera.isLoggedIn = true
+		camera.lock.Unlock()
 		camera.Log("Login accepted")
 	} else if message.Header.MessageType == 0x1234 { // TODO: RE error code
 		camera.Log("Login failed")
@@ -1,15 +1,27 @@
 package libipcamera
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
 )
 
 func ExampleCreateCamera() {
 	cameraIP := net.ParseIP("192.168.0.1")
 
 	// Create a camera
-	camera := CreateCamera(cameraIP, 6666, "admin", "12345")
+	camera, err := CreateCamera(cameraIP, 6666, "admin", "12345")
+	if err != nil {
+		fmt.Printf("Failed to create camera: %s\n", err)
+		return
+	}
 	defer camera.Disconnect()
 
 	// Enable verbose output for debugging
@@ -19,7 +31,7 @@ func ExampleCreateCamera() {
 	camera.Connect()
 
 	// Send a login packet to enable camera control
-	err := camera.Login()
+	err = camera.Login()
 	if err != nil {
 		fmt.Printf("Failed to Login: %s\n", err)
 	}
@@ -43,3 +55,120 @@ func ExampleCreatePacket() {
 
 	// Output: Packet Data: ABCD00000000A038
 }
+
+// fakeCamera accepts control connections, answers logins and keeps sending keepalive requests
+type fakeCamera struct {
+	listener    net.Listener
+	connections chan net.Conn
+	responses   chan struct{}
+}
+
+func newFakeCamera(t *testing.T) *fakeCamera {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeCamera{
+		listener:    listener,
+		connections: make(chan net.Conn, 10),
+		responses:   make(chan struct{}, 1000),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.connections <- conn
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeCamera) serve(conn net.Conn) {
+	go func() {
+		for {
+			if _, err := conn.Write(CreateCommandPacket(ALIVE_REQUEST)); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	header := Header{}
+	for {
+		if err := binary.Read(conn, binary.BigEndian, &header); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, header.Length)); err != nil {
+			return
+		}
+		switch header.MessageType {
+		case LOGIN:
+			conn.Write(CreateCommandPacket(LOGIN_ACCEPT))
+		case ALIVE_RESPONSE:
+			select {
+			case f.responses <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func TestCameraReconnect(t *testing.T) {
+	fake := newFakeCamera(t)
+	defer fake.listener.Close()
+	address := fake.listener.Addr().(*net.TCPAddr)
+
+	camera, err := CreateCamera(address.IP, address.Port, "admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	camera.SetVerbose(false)
+	defer camera.Disconnect()
+
+	camera.Connect()
+	if err := camera.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if !camera.IsConnected() {
+		t.Fatal("camera is not connected after login")
+	}
+
+	// The camera drops the connection
+	(<-fake.connections).Close()
+	for deadline := time.Now().Add(time.Second); camera.IsConnected(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("lost connection has not been detected")
+		}
+	}
+	if err := camera.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reconnecting while the old connection is busy handling keepalives does not log read errors
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+	for i := 0; i < 5; i++ {
+		if err := camera.Reconnect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Contains(output.String(), "ERROR") {
+		t.Errorf("unexpected errors logged while reconnecting:\n%s", output)
+	}
+
+	if !camera.IsConnected() || camera.requireCommand(START_PREVIEW) != nil {
+		t.Error("camera is not logged in after reconnecting")
+	}
+	for len(fake.responses) > 0 {
+		<-fake.responses
+	}
+	select {
+	case <-fake.responses:
+	case <-time.After(time.Second):
+		t.Error("keepalive requests are not answered after reconnecting")
+	}
+}
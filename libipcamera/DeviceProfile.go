@@ -0,0 +1,154 @@
+package libipcamera
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedCommand is returned when a command is not supported by the cameras device profile
+var ErrUnsupportedCommand = errors.New("Command not supported by camera")
+
+// DeviceProfile describes the capabilities and quirks of a camera model
+type DeviceProfile struct {
+	// Name is a short identifier used to select the profile
+	Name string
+	// Description is a human readable name of the camera model
+	Description string
+	// FirmwarePatterns are matched against the firmware information reported by the camera
+	FirmwarePatterns []string
+	// DiscoveryPorts are the UDP ports the camera answers discovery broadcasts on
+	DiscoveryPorts []int
+	// ControlPort is the TCP port of the cameras control service
+	ControlPort int
+	// PreviewPort is the local UDP port the camera sends the preview stream to
+	PreviewPort int
+	// HTTPPort is the TCP port of the cameras HTTP file server
+	HTTPPort int
+	// Username is the default login username
+	Username string
+	// Password is the default login password
+	Password string
+	// Commands lists the commands accepted by the camera, nil means that the camera
+	// accepts every command known to this library
+	Commands []uint32
+}
+
+// GenericProfile is used for cameras that could not be identified
+var GenericProfile = &DeviceProfile{
+	Name:           "generic",
+	Description:    "Generic IP action camera",
+	DiscoveryPorts: []int{22600, 21600},
+	ControlPort:    6666,
+	PreviewPort:    6669,
+	HTTPPort:       80,
+	Username:       "admin",
+	Password:       "12345",
+}
+
+// Profiles contains all known device profiles, the GenericProfile is always the last entry
+// The ACT76 and the XPro2 accept all known commands, their Commands are therefore not restricted
+var Profiles = []*DeviceProfile{
+	{
+		Name:             "act76",
+		Description:      "Campark ACT76 (Xtreme 2)",
+		FirmwarePatterns: []string{"ACT76"},
+		DiscoveryPorts:   []int{22600},
+		ControlPort:      6666,
+		PreviewPort:      6669,
+		HTTPPort:         80,
+		Username:         "admin",
+		Password:         "12345",
+	},
+	{
+		Name:             "xpro2",
+		Description:      "TecTecTec XPro2",
+		FirmwarePatterns: []string{"XPRO2"},
+		DiscoveryPorts:   []int{21600},
+		ControlPort:      6666,
+		PreviewPort:      6669,
+		HTTPPort:         80,
+		Username:         "admin",
+		Password:         "12345",
+	},
+	GenericProfile,
+}
+
+// Supports returns true if the given command is supported by this profile
+func (p *DeviceProfile) Supports(command uint32) bool {
+	if p.Commands == nil {
+		return true
+	}
+	for _, supported := range p.Commands {
+		if supported == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *DeviceProfile) String() string {
+	return fmt.Sprintf("%s (%s)", p.Name, p.Description)
+}
+
+// ProfileByName returns the device profile with the given name
+func ProfileByName(name string) (*DeviceProfile, error) {
+	for _, profile := range Profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown device profile %q", name)
+}
+
+// ProfileForFirmware returns the device profile matching the firmware information
+// reported by a camera or the GenericProfile if no profile matches
+func ProfileForFirmware(firmware string) *DeviceProfile {
+	firmware = strings.ToUpper(firmware)
+	for _, profile := range Profiles {
+		for _, pattern := range profile.FirmwarePatterns {
+			if strings.Contains(firmware, strings.ToUpper(pattern)) {
+				return profile
+			}
+		}
+	}
+	return GenericProfile
+}
+
+// ProfileForDiscoveryPort returns the device profile of cameras answering discovery
+// broadcasts on the given port, if the port is ambiguous the GenericProfile is returned
+func ProfileForDiscoveryPort(port int) *DeviceProfile {
+	var match *DeviceProfile
+	for _, profile := range Profiles {
+		if profile == GenericProfile {
+			continue
+		}
+		for _, discoveryPort := range profile.DiscoveryPorts {
+			if discoveryPort == port {
+				if match != nil {
+					return GenericProfile
+				}
+				match = profile
+			}
+		}
+	}
+	if match == nil {
+		return GenericProfile
+	}
+	return match
+}
+
+// discoveryPorts returns all UDP ports used for discovery by any known profile
+func discoveryPorts() []int {
+	ports := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, profile := range Profiles {
+		for _, port := range profile.DiscoveryPorts {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
@@ -0,0 +1,86 @@
+package libipcamera
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestProfileForDiscoveryPort(t *testing.T) {
+	for port, expected := range map[int]string{
+		22600: "act76",
+		21600: "xpro2",
+		12345: "generic",
+	} {
+		if profile := ProfileForDiscoveryPort(port); profile.Name != expected {
+			t.Errorf("expected profile %s for port %d, got %s", expected, port, profile.Name)
+		}
+	}
+
+	// A port shared by several models does not identify the camera
+	defer func(profiles []*DeviceProfile) { Profiles = profiles }(Profiles)
+	Profiles = append([]*DeviceProfile{{Name: "clone", DiscoveryPorts: []int{22600}}}, Profiles...)
+	if profile := ProfileForDiscoveryPort(22600); profile != GenericProfile {
+		t.Errorf("expected the generic profile for an ambiguous port, got %s", profile.Name)
+	}
+}
+
+func TestProfileForFirmware(t *testing.T) {
+	for firmware, expected := range map[string]string{
+		"ACT76_V1.0_RC5": "act76",
+		"act76 v1.0 rc5": "act76",
+		"XPro2-20190412": "xpro2",
+		"SOMECAM_V2.1":   "generic",
+		"":               "generic",
+	} {
+		if profile := ProfileForFirmware(firmware); profile.Name != expected {
+			t.Errorf("expected profile %s for firmware %q, got %s", expected, firmware, profile.Name)
+		}
+	}
+}
+
+func TestProfileByName(t *testing.T) {
+	if profile, err := ProfileByName("XPRO2"); err != nil || profile.Name != "xpro2" {
+		t.Errorf("expected the xpro2 profile, got %v (%v)", profile, err)
+	}
+	if _, err := ProfileByName("gopro"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestProfileSupports(t *testing.T) {
+	for _, profile := range Profiles {
+		if !profile.Supports(TAKE_PICTURE) || !profile.Supports(START_PREVIEW) {
+			t.Errorf("expected profile %s to support all commands", profile.Name)
+		}
+	}
+
+	restricted := &DeviceProfile{Name: "preview-only", Commands: []uint32{START_PREVIEW}}
+	if !restricted.Supports(START_PREVIEW) || restricted.Supports(TAKE_PICTURE) {
+		t.Error("expected only the listed commands to be supported")
+	}
+}
+
+func TestRequireCommand(t *testing.T) {
+	camera, err := CreateCamera(net.ParseIP("192.168.1.1"), 6666, "admin", "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	camera.SetProfile(&DeviceProfile{Name: "preview-only", Commands: []uint32{START_PREVIEW}})
+
+	if err := camera.requireCommand(START_PREVIEW); err == nil || errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("expected a login error, got %v", err)
+	}
+
+	camera.isLoggedIn = true
+	if err := camera.requireCommand(START_PREVIEW); err != nil {
+		t.Errorf("expected START_PREVIEW to be allowed, got %v", err)
+	}
+	// Unsupported commands fail without sending anything to the camera
+	if err := camera.TakePicture(); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("expected ErrUnsupportedCommand, got %v", err)
+	}
+	if _, err := camera.GetFileList(); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Errorf("expected ErrUnsupportedCommand, got %v", err)
+	}
+}
@@ -7,20 +7,23 @@ import (
 	"time"
 )
 
-// Ports to try discovery on
-var targetPorts = []int{22600, 21600}
-
 // AutodiscoverCamera will try to find a camera using UDP Broadcasts
 func AutodiscoverCamera(verbose bool) (net.IP, error) {
-	conn, err := net.ListenPacket("udp", ":22601")
-	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ip, _, err := DiscoverCamera(verbose)
+	return ip, err
+}
 
+// DiscoverCamera will try to find a camera using UDP Broadcasts and returns its
+// IP-Address together with the device profile matching the discovery port it answered on
+func DiscoverCamera(verbose bool) (net.IP, *DeviceProfile, error) {
+	conn, err := net.ListenPacket("udp", ":22601")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
 
-	for _, port := range targetPorts {
+	for _, port := range discoveryPorts() {
 		go sendDiscoveryBroadcasts(conn, port, 5, verbose)
 	}
 
@@ -28,11 +31,11 @@ func AutodiscoverCamera(verbose bool) (net.IP, error) {
 	_, remoteAddr, err := conn.ReadFrom(buffer)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	udpAddr := remoteAddr.(*net.UDPAddr)
-	return udpAddr.IP, nil
+	return udpAddr.IP, ProfileForDiscoveryPort(udpAddr.Port), nil
 }
 
 func sendDiscoveryBroadcasts(localConn net.PacketConn, port, count int, verbose bool) {
@@ -41,7 +44,7 @@ func sendDiscoveryBroadcasts(localConn net.PacketConn, port, count int, verbose
 		return
 	}
 
-	broadcastPacket := CreateCommandPacket(0x0114)
+	broadcastPacket := CreateCommandPacket(DISCOVERY_REQUEST)
 
 	if verbose {
 		log.Printf("Trying Autodiscovery using UDP Port %d\n", port)
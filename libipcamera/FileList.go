@@ -0,0 +1,253 @@
+package libipcamera
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileKind describes the type of content of a stored file
+type FileKind int
+
+const (
+	// KindUnknown is used for files that could not be classified
+	KindUnknown FileKind = iota
+	// KindVideo is a video recording
+	KindVideo
+	// KindPhoto is a still image
+	KindPhoto
+	// KindThumbnail is a preview image generated by the camera
+	KindThumbnail
+)
+
+func (k FileKind) String() string {
+	switch k {
+	case KindVideo:
+		return "video"
+	case KindPhoto:
+		return "photo"
+	case KindThumbnail:
+		return "thumbnail"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFileKind returns the FileKind with the given name
+func ParseFileKind(name string) (FileKind, error) {
+	for _, kind := range []FileKind{KindVideo, KindPhoto, KindThumbnail, KindUnknown} {
+		if strings.EqualFold(kind.String(), name) {
+			return kind, nil
+		}
+	}
+	return KindUnknown, fmt.Errorf("Unknown file kind %q", name)
+}
+
+// StoredFile is a file stored on the cameras sd-card
+type StoredFile struct {
+	Path string
+	Size uint64
+	// Directory is the directory containing the file
+	Directory string
+	// Kind is derived from the files extension and location
+	Kind FileKind
+	// CaptureTime is parsed from the cameras file naming scheme, it is the zero time if the name contains no timestamp
+	CaptureTime time.Time
+	// Locked is true if the camera marked the file as protected from being overwritten
+	Locked bool
+}
+
+// Name returns the file name without the directory
+func (f StoredFile) Name() string {
+	return path.Base(f.Path)
+}
+
+// contentTypes complements the mime types known to the system for files created by cameras
+var contentTypes = map[string]string{
+	".mp4": "video/mp4",
+	".mov": "video/quicktime",
+	".avi": "video/x-msvideo",
+	".ts":  "video/mp2t",
+	".jpg": "image/jpeg",
+	".thm": "image/jpeg",
+}
+
+// ContentType returns the mime type of the file based on its extension
+func (f StoredFile) ContentType() string {
+	extension := strings.ToLower(path.Ext(f.Path))
+	if contentType, known := contentTypes[extension]; known {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(extension); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// FileList is a list of files stored on the cameras sd-card
+type FileList []StoredFile
+
+// FilterByKind returns all files of the given kind
+func (l FileList) FilterByKind(kind FileKind) FileList {
+	return l.Filter(func(file StoredFile) bool {
+		return file.Kind == kind
+	})
+}
+
+// Since returns all files captured at or after t, files without a capture time are omitted
+func (l FileList) Since(t time.Time) FileList {
+	return l.Filter(func(file StoredFile) bool {
+		return !file.CaptureTime.IsZero() && !file.CaptureTime.Before(t)
+	})
+}
+
+// Until returns all files captured before t, files without a capture time are omitted
+func (l FileList) Until(t time.Time) FileList {
+	return l.Filter(func(file StoredFile) bool {
+		return !file.CaptureTime.IsZero() && file.CaptureTime.Before(t)
+	})
+}
+
+// Filter returns all files for which keep returns true
+func (l FileList) Filter(keep func(file StoredFile) bool) FileList {
+	filtered := make(FileList, 0, len(l))
+	for _, file := range l {
+		if keep(file) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// FileListError is returned together with all valid entries if the file list
+// received from the camera contained malformed entries
+type FileListError struct {
+	Entries []string
+}
+
+func (e *FileListError) Error() string {
+	return fmt.Sprintf("File list contains %d malformed entries: %q", len(e.Entries), e.Entries)
+}
+
+var (
+	videoExtensions     = []string{".mp4", ".mov", ".avi", ".ts"}
+	photoExtensions     = []string{".jpg", ".jpeg", ".png"}
+	thumbnailExtensions = []string{".thm"}
+	lockedDirectories   = []string{"ro", "lock", "locked", "event", "emr"}
+	lockedPrefixes      = []string{"lock", "emr"}
+
+	// Matches timestamps like 2019_0412_153001, 20190412_153001 or 20190412153001
+	captureTimePattern = regexp.MustCompile(`(\d{4})[_-]?(\d{2})[_-]?(\d{2})[_-]?(\d{2})[_-]?(\d{2})[_-]?(\d{2})`)
+)
+
+func parseFileList(input string) (FileList, error) {
+	entries := strings.Split(input, ";")
+	stored := make(FileList, 0, len(entries))
+	malformed := make([]string, 0)
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		file, ok := parseFileListEntry(entry)
+		if !ok {
+			malformed = append(malformed, entry)
+			continue
+		}
+		stored = append(stored, file)
+	}
+
+	if len(malformed) > 0 {
+		return stored, &FileListError{Entries: malformed}
+	}
+	return stored, nil
+}
+
+func parseFileListEntry(entry string) (StoredFile, bool) {
+	separator := strings.LastIndex(entry, ":")
+	if separator <= 0 {
+		return StoredFile{}, false
+	}
+
+	size, err := strconv.ParseUint(entry[separator+1:], 10, 64)
+	if err != nil {
+		return StoredFile{}, false
+	}
+
+	filePath := entry[:separator]
+	directory := path.Dir(filePath)
+	name := path.Base(filePath)
+
+	return StoredFile{
+		Path:        filePath,
+		Size:        size,
+		Directory:   directory,
+		Kind:        fileKind(directory, name),
+		CaptureTime: captureTime(name),
+		Locked:      isLocked(directory, name),
+	}, true
+}
+
+func fileKind(directory, name string) FileKind {
+	extension := strings.ToLower(path.Ext(name))
+	switch {
+	case containsString(thumbnailExtensions, extension):
+		return KindThumbnail
+	case containsString(photoExtensions, extension):
+		if strings.Contains(strings.ToLower(directory), "thumb") {
+			return KindThumbnail
+		}
+		return KindPhoto
+	case containsString(videoExtensions, extension):
+		return KindVideo
+	default:
+		return KindUnknown
+	}
+}
+
+func captureTime(name string) time.Time {
+	match := captureTimePattern.FindStringSubmatch(name)
+	if match == nil {
+		return time.Time{}
+	}
+
+	fields := make([]int, 6)
+	for i := range fields {
+		fields[i], _ = strconv.Atoi(match[i+1])
+	}
+
+	t := time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, time.Local)
+	// Reject timestamps that have been normalized by time.Date (e.g. month 13)
+	if t.Month() != time.Month(fields[1]) || t.Day() != fields[2] || t.Hour() != fields[3] || t.Minute() != fields[4] {
+		return time.Time{}
+	}
+	return t
+}
+
+func isLocked(directory, name string) bool {
+	if containsString(lockedDirectories, strings.ToLower(path.Base(directory))) {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, prefix := range lockedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package libipcamera
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseFileList(t *testing.T) {
+	input := "/mnt/DCIM/MOVIE/2019_0412_153001_001.MP4:104857600;" +
+		"/mnt/DCIM/PHOTO/20190412_153500.JPG:2097152;" +
+		"/mnt/DCIM/MOVIE/RO/2019_0412_160000_002.MOV:52428800;" +
+		"/mnt/DCIM/THUMB/2019_0412_153001_001.JPG:8192;" +
+		"broken-entry;" +
+		"/mnt/DCIM/MOVIE/FILE0001.MP4:notasize;"
+
+	files, err := parseFileList(input)
+
+	var listErr *FileListError
+	if !errors.As(err, &listErr) {
+		t.Fatalf("expected a *FileListError, got %v", err)
+	}
+	if len(listErr.Entries) != 2 {
+		t.Errorf("expected 2 malformed entries, got %q", listErr.Entries)
+	}
+
+	expected := []StoredFile{
+		{
+			Path:        "/mnt/DCIM/MOVIE/2019_0412_153001_001.MP4",
+			Size:        104857600,
+			Directory:   "/mnt/DCIM/MOVIE",
+			Kind:        KindVideo,
+			CaptureTime: time.Date(2019, 4, 12, 15, 30, 1, 0, time.Local),
+		},
+		{
+			Path:        "/mnt/DCIM/PHOTO/20190412_153500.JPG",
+			Size:        2097152,
+			Directory:   "/mnt/DCIM/PHOTO",
+			Kind:        KindPhoto,
+			CaptureTime: time.Date(2019, 4, 12, 15, 35, 0, 0, time.Local),
+		},
+		{
+			Path:        "/mnt/DCIM/MOVIE/RO/2019_0412_160000_002.MOV",
+			Size:        52428800,
+			Directory:   "/mnt/DCIM/MOVIE/RO",
+			Kind:        KindVideo,
+			CaptureTime: time.Date(2019, 4, 12, 16, 0, 0, 0, time.Local),
+			Locked:      true,
+		},
+		{
+			Path:        "/mnt/DCIM/THUMB/2019_0412_153001_001.JPG",
+			Size:        8192,
+			Directory:   "/mnt/DCIM/THUMB",
+			Kind:        KindThumbnail,
+			CaptureTime: time.Date(2019, 4, 12, 15, 30, 1, 0, time.Local),
+		},
+	}
+
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(files))
+	}
+	for i, file := range files {
+		if file != expected[i] {
+			t.Errorf("file %d: expected %+v, got %+v", i, expected[i], file)
+		}
+	}
+}
+
+func TestFileListFilters(t *testing.T) {
+	files, err := parseFileList("/DCIM/2019_0101_100000.MP4:1;/DCIM/2019_0102_100000.MP4:1;/DCIM/2019_0103_100000.JPG:1;/DCIM/FILE0001.MP4:1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if videos := files.FilterByKind(KindVideo); len(videos) != 3 {
+		t.Errorf("expected 3 videos, got %d", len(videos))
+	}
+
+	since := files.Since(time.Date(2019, 1, 2, 0, 0, 0, 0, time.Local))
+	if len(since) != 2 || since[0].Name() != "2019_0102_100000.MP4" {
+		t.Errorf("unexpected result of Since: %+v", since)
+	}
+
+	until := files.Until(time.Date(2019, 1, 2, 0, 0, 0, 0, time.Local))
+	if len(until) != 1 || until[0].Name() != "2019_0101_100000.MP4" {
+		t.Errorf("unexpected result of Until: %+v", until)
+	}
+}
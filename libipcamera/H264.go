@@ -0,0 +1,326 @@
+package libipcamera
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/icza/bitio"
+	"github.com/jonas-koeritz/actioncam/rtp"
+)
+
+// NAL unit types of H.264 (ITU-T H.264 Table 7-1)
+const (
+	NALUnitSlice               = 1
+	NALUnitIDR                 = 5
+	NALUnitSEI                 = 6
+	NALUnitSPS                 = 7
+	NALUnitPPS                 = 8
+	NALUnitAccessUnitDelimiter = 9
+	NALUnitEndOfSequence       = 10
+	NALUnitEndOfStream         = 11
+	NALUnitFiller              = 12
+	NALUnitSPSExtension        = 13
+	NALUnitAuxiliarySlice      = 19
+)
+
+// nalUnitTypeMask selects the nal_unit_type from the first Byte of a NAL unit
+const nalUnitTypeMask = 0x1F
+
+// nalUnitTypeNames are readable names of the NAL unit types
+var nalUnitTypeNames = map[uint8]string{
+	NALUnitSlice:               "non-IDR slice",
+	NALUnitIDR:                 "IDR slice",
+	NALUnitSEI:                 "SEI",
+	NALUnitSPS:                 "SPS",
+	NALUnitPPS:                 "PPS",
+	NALUnitAccessUnitDelimiter: "access unit delimiter",
+	NALUnitEndOfSequence:       "end of sequence",
+	NALUnitEndOfStream:         "end of stream",
+	NALUnitFiller:              "filler data",
+	NALUnitSPSExtension:        "SPS extension",
+	NALUnitAuxiliarySlice:      "auxiliary slice",
+}
+
+// ErrInvalidSPS is returned if a sequence parameter set can not be decoded
+var ErrInvalidSPS = errors.New("Invalid sequence parameter set")
+
+// NALUnit is a single H.264 NAL unit without start code
+type NALUnit []byte
+
+// Type returns the nal_unit_type
+func (n NALUnit) Type() uint8 {
+	if len(n) == 0 {
+		return 0
+	}
+	return n[0] & nalUnitTypeMask
+}
+
+// ReferenceIndicator returns the nal_ref_idc, 0 for NAL units that are not used for reference
+func (n NALUnit) ReferenceIndicator() uint8 {
+	if len(n) == 0 {
+		return 0
+	}
+	return n[0] >> 5 & 0x03
+}
+
+// TypeName returns a readable name of the NAL unit type
+func (n NALUnit) TypeName() string {
+	name, known := nalUnitTypeNames[n.Type()]
+	if !known {
+		return fmt.Sprintf("type %d", n.Type())
+	}
+	return name
+}
+
+// IsSlice returns true for NAL units carrying coded picture data
+func (n NALUnit) IsSlice() bool {
+	return n.Type() == NALUnitSlice || n.Type() == NALUnitIDR
+}
+
+// ParseNALUnits splits an Annex-B byte stream into its NAL units
+func ParseNALUnits(annexB []byte) []NALUnit {
+	nalUnits := make([]NALUnit, 0)
+	for _, nal := range rtp.SplitAnnexB(annexB) {
+		if len(nal) > 0 {
+			nalUnits = append(nalUnits, NALUnit(nal))
+		}
+	}
+	return nalUnits
+}
+
+// NALUnits returns the NAL units of the frame
+func (f Frame) NALUnits() []NALUnit {
+	return ParseNALUnits(f.Data)
+}
+
+// IsKeyFrame returns true if the frame contains an IDR slice
+func (f Frame) IsKeyFrame() bool {
+	for _, nal := range f.NALUnits() {
+		if nal.Type() == NALUnitIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// SequenceParameterSet contains the stream parameters decoded from an SPS
+type SequenceParameterSet struct {
+	Profile uint8
+	// Constraints are the constraint_set flags, constraint_set0_flag is the most significant bit
+	Constraints uint8
+	// Level is the level_idc, 10 times the level number (e.g. 31 for level 3.1)
+	Level        uint8
+	ID           uint
+	ChromaFormat uint
+	BitDepth     uint
+	// MaxReferenceFrames is the maximum number of reference frames used by the stream
+	MaxReferenceFrames uint
+	// Interlaced is true if the stream may contain field pictures
+	Interlaced bool
+	// Width and Height of the decoded pictures in pixels after cropping
+	Width  int
+	Height int
+	// FrameRate is taken from the VUI timing information, it is 0 if the SPS does not contain any
+	FrameRate      float64
+	FixedFrameRate bool
+}
+
+// profilesWithChromaInfo are the profiles that signal chroma format and bit depth in the SPS
+var profilesWithChromaInfo = map[uint8]bool{
+	100: true, 110: true, 122: true, 244: true, 44: true,
+	83: true, 86: true, 118: true, 128: true, 138: true, 139: true, 134: true, 135: true,
+}
+
+// ParseSPS decodes a sequence parameter set NAL unit (ITU-T H.264 7.3.2.1.1)
+func ParseSPS(nal NALUnit) (*SequenceParameterSet, error) {
+	if len(nal) < 4 || nal.Type() != NALUnitSPS {
+		return nil, ErrInvalidSPS
+	}
+
+	r := expGolombReader{bitio.NewReader(bytes.NewReader(unescapeRBSP(nal[1:])))}
+	sps := &SequenceParameterSet{
+		Profile:      uint8(r.TryReadBits(8)),
+		Constraints:  uint8(r.TryReadBits(8)),
+		Level:        uint8(r.TryReadBits(8)),
+		ID:           r.ue(),
+		ChromaFormat: 1,
+		BitDepth:     8,
+	}
+
+	if profilesWithChromaInfo[sps.Profile] {
+		sps.ChromaFormat = r.ue()
+		if sps.ChromaFormat == 3 {
+			r.TryReadBool() // separate_colour_plane_flag
+		}
+		sps.BitDepth = r.ue() + 8
+		r.ue()               // bit_depth_chroma_minus8
+		r.TryReadBool()      // qpprime_y_zero_transform_bypass_flag
+		if r.TryReadBool() { // seq_scaling_matrix_present_flag
+			lists := 8
+			if sps.ChromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.TryReadBool() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				r.skipScalingList(size)
+			}
+		}
+	}
+
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.TryReadBool() // delta_pic_order_always_zero_flag
+		r.se()          // offset_for_non_ref_pic
+		r.se()          // offset_for_top_to_bottom_field
+		cycle := r.ue()
+		for i := uint(0); i < cycle && r.TryError == nil; i++ {
+			r.se() // offset_for_ref_frame
+		}
+	}
+
+	sps.MaxReferenceFrames = r.ue()
+	r.TryReadBool() // gaps_in_frame_num_value_allowed_flag
+	widthInMacroblocks := int(r.ue()) + 1
+	heightInMapUnits := int(r.ue()) + 1
+	frameMacroblocksOnly := r.TryReadBool()
+	if !frameMacroblocksOnly {
+		r.TryReadBool() // mb_adaptive_frame_field_flag
+	}
+	sps.Interlaced = !frameMacroblocksOnly
+	r.TryReadBool() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.TryReadBool() { // frame_cropping_flag
+		cropLeft, cropRight, cropTop, cropBottom = int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+	}
+
+	fieldFactor := 1
+	if !frameMacroblocksOnly {
+		fieldFactor = 2
+	}
+	// Cropping is given in chroma samples (ITU-T H.264 Table 6-1)
+	cropUnitX, cropUnitY := 1, fieldFactor
+	switch sps.ChromaFormat {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*fieldFactor
+	case 2:
+		cropUnitX = 2
+	}
+	sps.Width = widthInMacroblocks*16 - cropUnitX*(cropLeft+cropRight)
+	sps.Height = fieldFactor*heightInMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+
+	if r.TryError != nil {
+		return nil, ErrInvalidSPS
+	}
+
+	if r.TryReadBool() { // vui_parameters_present_flag
+		r.parseTiming(sps)
+	}
+	// A truncated VUI still leaves the picture parameters usable
+	return sps, nil
+}
+
+// parseTiming reads the VUI parameters up to the timing information
+func (r expGolombReader) parseTiming(sps *SequenceParameterSet) {
+	if r.TryReadBool() { // aspect_ratio_info_present_flag
+		if r.TryReadBits(8) == 255 { // Extended_SAR
+			r.TryReadBits(32) // sar_width, sar_height
+		}
+	}
+	if r.TryReadBool() { // overscan_info_present_flag
+		r.TryReadBool() // overscan_appropriate_flag
+	}
+	if r.TryReadBool() { // video_signal_type_present_flag
+		r.TryReadBits(4)     // video_format, video_full_range_flag
+		if r.TryReadBool() { // colour_description_present_flag
+			r.TryReadBits(24) // colour_primaries, transfer_characteristics, matrix_coefficients
+		}
+	}
+	if r.TryReadBool() { // chroma_loc_info_present_flag
+		r.ue()
+		r.ue()
+	}
+	if !r.TryReadBool() { // timing_info_present_flag
+		return
+	}
+	unitsInTick := r.TryReadBits(32)
+	timeScale := r.TryReadBits(32)
+	fixed := r.TryReadBool()
+	if r.TryError != nil || unitsInTick == 0 {
+		return
+	}
+	// A frame consists of two fields, each lasting one tick
+	sps.FrameRate = float64(timeScale) / float64(2*unitsInTick)
+	sps.FixedFrameRate = fixed
+}
+
+// expGolombReader reads the Exp-Golomb coded syntax elements of H.264, errors are collected in TryError
+type expGolombReader struct {
+	*bitio.Reader
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (r expGolombReader) ue() uint {
+	leadingZeros := uint8(0)
+	for !r.TryReadBool() {
+		if r.TryError != nil {
+			return 0
+		}
+		if leadingZeros++; leadingZeros > 32 {
+			r.TryError = ErrInvalidSPS
+			return 0
+		}
+	}
+	return uint(1<<leadingZeros - 1 + r.TryReadBits(leadingZeros))
+}
+
+// se reads a signed Exp-Golomb code
+func (r expGolombReader) se() int {
+	value := r.ue()
+	if value%2 == 0 {
+		return -int(value / 2)
+	}
+	return int(value+1) / 2
+}
+
+// skipScalingList skips a scaling_list() of the given size
+func (r expGolombReader) skipScalingList(size int) {
+	last, next := 8, 8
+	for i := 0; i < size && r.TryError == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// unescapeRBSP removes the emulation prevention Bytes (0x000003) from the payload of a NAL unit
+func unescapeRBSP(data []byte) []byte {
+	rbsp := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
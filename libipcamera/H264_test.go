@@ -0,0 +1,132 @@
+package libipcamera
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+// spsWriter builds sequence parameter sets for tests
+type spsWriter struct {
+	*bitio.Writer
+}
+
+func (w spsWriter) ue(value uint) {
+	value++
+	length := uint8(0)
+	for v := value; v > 1; v >>= 1 {
+		length++
+	}
+	w.WriteBits(0, length)
+	w.WriteBits(uint64(value), length+1)
+}
+
+func buildSPS(profile uint8, widthInMacroblocks, heightInMacroblocks, cropBottom uint, unitsInTick, timeScale uint32) NALUnit {
+	buffer := &bytes.Buffer{}
+	w := spsWriter{bitio.NewWriter(buffer)}
+	w.WriteByte(0x67)
+	w.WriteByte(profile)
+	w.WriteByte(0x00)
+	w.WriteByte(31)
+	w.ue(0) // seq_parameter_set_id
+	if profile == 100 {
+		w.ue(1)            // chroma_format_idc
+		w.ue(0)            // bit_depth_luma_minus8
+		w.ue(0)            // bit_depth_chroma_minus8
+		w.WriteBool(false) // qpprime_y_zero_transform_bypass_flag
+		w.WriteBool(false) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0)            // log2_max_frame_num_minus4
+	w.ue(2)            // pic_order_cnt_type
+	w.ue(1)            // max_num_ref_frames
+	w.WriteBool(false) // gaps_in_frame_num_value_allowed_flag
+	w.ue(widthInMacroblocks - 1)
+	w.ue(heightInMacroblocks - 1)
+	w.WriteBool(true) // frame_mbs_only_flag
+	w.WriteBool(true) // direct_8x8_inference_flag
+	w.WriteBool(cropBottom > 0)
+	if cropBottom > 0 {
+		w.ue(0)
+		w.ue(0)
+		w.ue(0)
+		w.ue(cropBottom)
+	}
+	w.WriteBool(timeScale > 0) // vui_parameters_present_flag
+	if timeScale > 0 {
+		w.WriteBool(false) // aspect_ratio_info_present_flag
+		w.WriteBool(false) // overscan_info_present_flag
+		w.WriteBool(false) // video_signal_type_present_flag
+		w.WriteBool(false) // chroma_loc_info_present_flag
+		w.WriteBool(true)  // timing_info_present_flag
+		w.WriteBits(uint64(unitsInTick), 32)
+		w.WriteBits(uint64(timeScale), 32)
+		w.WriteBool(true) // fixed_frame_rate_flag
+	}
+	w.WriteBool(true) // rbsp_stop_one_bit
+	w.Close()
+	return NALUnit(buffer.Bytes())
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(buildSPS(100, 120, 68, 4, 1, 60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Profile != 100 || sps.Level != 31 || sps.ChromaFormat != 1 || sps.MaxReferenceFrames != 1 {
+		t.Errorf("unexpected SPS %+v", sps)
+	}
+	if sps.Width != 1920 || sps.Height != 1080 {
+		t.Errorf("expected 1920x1080, got %dx%d", sps.Width, sps.Height)
+	}
+	if sps.FrameRate != 30 || !sps.FixedFrameRate {
+		t.Errorf("expected a fixed frame rate of 30 fps, got %f", sps.FrameRate)
+	}
+
+	sps, err = ParseSPS(buildSPS(66, 80, 45, 0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.Width != 1280 || sps.Height != 720 || sps.FrameRate != 0 {
+		t.Errorf("unexpected Baseline SPS %+v", sps)
+	}
+
+	if _, err := ParseSPS(NALUnit{0x67, 0x42, 0x00}); err != ErrInvalidSPS {
+		t.Errorf("expected truncated SPS to be rejected, got %v", err)
+	}
+	if _, err := ParseSPS(NALUnit{0x68, 0xCE, 0x38, 0x80}); err != ErrInvalidSPS {
+		t.Errorf("expected PPS to be rejected, got %v", err)
+	}
+}
+
+func TestParseNALUnits(t *testing.T) {
+	frame := Frame{Data: []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x1F,
+		0x00, 0x00, 0x01, 0x68, 0xCE,
+		0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+	}}
+
+	nalUnits := frame.NALUnits()
+	expected := []uint8{NALUnitSPS, NALUnitPPS, NALUnitIDR}
+	if len(nalUnits) != len(expected) {
+		t.Fatalf("expected %d NAL units, got %d", len(expected), len(nalUnits))
+	}
+	for i, nal := range nalUnits {
+		if nal.Type() != expected[i] {
+			t.Errorf("NAL unit %d: expected type %d, got %s", i, expected[i], nal.TypeName())
+		}
+	}
+	if !frame.IsKeyFrame() || !nalUnits[2].IsSlice() || nalUnits[2].ReferenceIndicator() != 3 {
+		t.Error("expected an IDR key frame")
+	}
+	if (Frame{Data: []byte{0x00, 0x00, 0x01, 0x41, 0x9A}}).IsKeyFrame() {
+		t.Error("non-IDR frame reported as key frame")
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	rbsp := unescapeRBSP([]byte{0x01, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00})
+	if !bytes.Equal(rbsp, []byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}) {
+		t.Errorf("unexpected RBSP %X", rbsp)
+	}
+}
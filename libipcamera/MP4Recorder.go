@@ -0,0 +1,51 @@
+package libipcamera
+
+import (
+	"io"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// MP4Recorder is a FrameSink writing the stream as fragmented MP4, frames received before
+// the first key frame with its parameter sets are skipped
+type MP4Recorder struct {
+	recorder
+	w      io.Writer
+	writer *mp4.FragmentedWriter
+}
+
+// NewMP4Recorder creates a recorder writing to w, the caller has to call Close to write the last fragment
+func NewMP4Recorder(w io.Writer) *MP4Recorder {
+	r := &MP4Recorder{w: w}
+	r.container = r
+	return r
+}
+
+// begin writes the init segment, the track is described by the first parameter sets
+func (r *MP4Recorder) begin(parameterSets *ParameterSets) error {
+	sps, err := ParseSPS(parameterSets.SPS)
+	if err != nil {
+		return err
+	}
+	config := mp4.NewAVCDecoderConfiguration(parameterSets.SPS, parameterSets.PPS)
+	r.writer, err = mp4.NewFragmentedWriter(r.w, config, uint16(sps.Width), uint16(sps.Height))
+	return err
+}
+
+func (r *MP4Recorder) writeAccessUnit(frame Frame, elapsed time.Duration, parameterSets *ParameterSets) error {
+	nalUnits := make([][]byte, 0)
+	for _, nal := range frame.NALUnits() {
+		// Access unit delimiters are not allowed in MP4 samples
+		if nal.Type() != NALUnitAccessUnitDelimiter {
+			nalUnits = append(nalUnits, nal)
+		}
+	}
+	decodeTime := uint64(elapsed.Milliseconds()) * mp4.VideoTimescale / 1000
+	return r.writer.WriteSample(mp4.SampleFromNALUnits(nalUnits...), decodeTime, frame.IsKeyFrame())
+}
+
+// finish writes the last fragment
+func (r *MP4Recorder) finish() error {
+	return r.writer.Close()
+}
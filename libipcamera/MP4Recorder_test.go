@@ -0,0 +1,60 @@
+package libipcamera
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// annexB joins NAL units to an Annex-B byte stream
+func annexB(nalUnits ...[]byte) []byte {
+	data := make([]byte, 0)
+	for _, nal := range nalUnits {
+		data = append(data, 0x00, 0x00, 0x00, 0x01)
+		data = append(data, nal...)
+	}
+	return data
+}
+
+func TestMP4Recorder(t *testing.T) {
+	buffer := bytes.Buffer{}
+	recorder := NewMP4Recorder(&buffer)
+
+	sps := buildSPS(100, 40, 23, 4, 0, 0)
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	frames := []Frame{
+		// Frames before the first key frame can not be decoded
+		{Data: annexB([]byte{0x41, 0x9A}), PTS: 0},
+		{Data: annexB([]byte{0x09, 0xF0}, sps, pps, []byte{0x65, 0x88, 0x84}), PTS: 33 * time.Millisecond},
+		{Data: annexB([]byte{0x41, 0x9A}), PTS: 66 * time.Millisecond},
+	}
+	for _, frame := range frames {
+		err := recorder.WriteFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Frames() != 2 || recorder.Duration() != 33*time.Millisecond {
+		t.Errorf("expected 2 frames in 33ms, got %d in %s", recorder.Frames(), recorder.Duration())
+	}
+	if err := recorder.WriteFrame(frames[2]); err != nil || recorder.Frames() != 2 {
+		t.Errorf("expected frames after Close to be discarded, got %v", err)
+	}
+
+	file, err := mp4.Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, found := file.VideoTrack()
+	if !found || track.Width != 640 || track.Height != 360 {
+		t.Fatalf("unexpected video track %+v", track)
+	}
+	if !bytes.Equal(track.AVCConfig.SPS[0], sps) || !bytes.Equal(track.AVCConfig.PPS[0], pps) {
+		t.Errorf("unexpected decoder configuration %+v", track.AVCConfig)
+	}
+}
@@ -0,0 +1,37 @@
+package libipcamera
+
+import (
+	"io"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/mpegts"
+)
+
+// MPEGTSRecorder is a FrameSink writing the stream as MPEG transport stream, frames received
+// before the first key frame are skipped. The parameter sets are repeated before every key
+// frame so receivers can join the stream at any key frame.
+type MPEGTSRecorder struct {
+	recorder
+	muxer *mpegts.Muxer
+}
+
+// NewMPEGTSRecorder creates a recorder writing to w, every frame is written with a single call to w.Write
+func NewMPEGTSRecorder(w io.Writer) *MPEGTSRecorder {
+	r := &MPEGTSRecorder{muxer: mpegts.NewMuxer(w)}
+	r.container = r
+	return r
+}
+
+func (r *MPEGTSRecorder) begin(parameterSets *ParameterSets) error {
+	return nil
+}
+
+func (r *MPEGTSRecorder) writeAccessUnit(frame Frame, elapsed time.Duration, parameterSets *ParameterSets) error {
+	timestamp := uint64(elapsed.Milliseconds()) * mpegts.ClockRate / 1000
+	return r.muxer.WriteAccessUnit(parameterSets.Prepend(frame), timestamp, frame.IsKeyFrame())
+}
+
+// finish does nothing, the transport stream needs no finalization
+func (r *MPEGTSRecorder) finish() error {
+	return nil
+}
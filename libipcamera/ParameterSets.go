@@ -0,0 +1,82 @@
+package libipcamera
+
+import (
+	"net"
+
+	"github.com/jonas-koeritz/actioncam/rtp"
+)
+
+// startCode separates the NAL units of an Annex-B byte stream
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// ParameterSets are the SPS and PPS a decoder needs to decode the stream
+type ParameterSets struct {
+	SPS NALUnit
+	PPS NALUnit
+}
+
+// Complete returns true if both parameter sets are known
+func (p ParameterSets) Complete() bool {
+	return len(p.SPS) > 0 && len(p.PPS) > 0
+}
+
+// Update takes the latest parameter sets contained in a frame
+func (p *ParameterSets) Update(frame Frame) {
+	for _, nal := range frame.NALUnits() {
+		switch nal.Type() {
+		case NALUnitSPS:
+			p.SPS = append(NALUnit(nil), nal...)
+		case NALUnitPPS:
+			p.PPS = append(NALUnit(nil), nal...)
+		}
+	}
+}
+
+// Prepend returns the Annex-B data of a frame, the parameter sets are inserted in front of the
+// slices of key frames that do not contain them so decoders can start at every key frame
+func (p ParameterSets) Prepend(frame Frame) []byte {
+	nalUnits := frame.NALUnits()
+	hasSPS, hasPPS, keyFrame := false, false, false
+	for _, nal := range nalUnits {
+		switch nal.Type() {
+		case NALUnitSPS:
+			hasSPS = true
+		case NALUnitPPS:
+			hasPPS = true
+		case NALUnitIDR:
+			keyFrame = true
+		}
+	}
+	if !keyFrame || !p.Complete() || (hasSPS && hasPPS) {
+		return frame.Data
+	}
+
+	data := make([]byte, 0, len(frame.Data)+len(p.SPS)+len(p.PPS)+8)
+	inserted := false
+	for _, nal := range nalUnits {
+		// Parameter sets follow an access unit delimiter but precede everything else
+		if !inserted && nal.Type() != NALUnitAccessUnitDelimiter {
+			data = append(append(data, startCode...), p.SPS...)
+			data = append(append(data, startCode...), p.PPS...)
+			inserted = true
+		}
+		if nal.Type() == NALUnitSPS || nal.Type() == NALUnitPPS {
+			continue
+		}
+		data = append(append(data, startCode...), nal...)
+	}
+	return data
+}
+
+// SessionDescription returns an SDP describing the RTP stream sent to address:port,
+// a nil address and port 0 let the client choose the destination (RTSP)
+func (p ParameterSets) SessionDescription(address net.IP, port int) string {
+	return rtp.SessionDescription{
+		SessionName: "ActionCamera",
+		Address:     address,
+		Port:        port,
+		PayloadType: rtp.H264PayloadType,
+		SPS:         p.SPS,
+		PPS:         p.PPS,
+	}.Marshal()
+}
@@ -0,0 +1,50 @@
+package libipcamera
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParameterSetsPrepend(t *testing.T) {
+	parameterSets := ParameterSets{SPS: NALUnit{0x67, 0x42, 0x00, 0x1F}, PPS: NALUnit{0x68, 0xCE}}
+
+	keyFrame := Frame{Data: annexB([]byte{0x09, 0xF0}, []byte{0x65, 0x88})}
+	expected := annexB([]byte{0x09, 0xF0}, parameterSets.SPS, parameterSets.PPS, []byte{0x65, 0x88})
+	if data := parameterSets.Prepend(keyFrame); !bytes.Equal(data, expected) {
+		t.Errorf("expected %X, got %X", expected, data)
+	}
+
+	// Frames that are no key frames or contain the parameter sets are not changed
+	for _, frame := range []Frame{
+		{Data: annexB([]byte{0x41, 0x9A})},
+		{Data: annexB(parameterSets.SPS, parameterSets.PPS, []byte{0x65, 0x88})},
+	} {
+		if data := parameterSets.Prepend(frame); !bytes.Equal(data, frame.Data) {
+			t.Errorf("frame %X was changed to %X", frame.Data, data)
+		}
+	}
+}
+
+func TestAnnexBRecorder(t *testing.T) {
+	buffer := bytes.Buffer{}
+	recorder := NewAnnexBRecorder(&buffer)
+
+	sps, pps := NALUnit{0x67, 0x42, 0x00, 0x1F}, NALUnit{0x68, 0xCE}
+	frames := []Frame{
+		{Data: annexB([]byte{0x41, 0x9A})},
+		{Data: annexB(sps, pps, []byte{0x65, 0x88})},
+		{Data: annexB([]byte{0x41, 0x9B})},
+		{Data: annexB([]byte{0x65, 0x89})},
+	}
+	for _, frame := range frames {
+		if err := recorder.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The stream starts at the first key frame and every key frame carries the parameter sets
+	expected := annexB(sps, pps, []byte{0x65, 0x88}, []byte{0x41, 0x9B}, sps, pps, []byte{0x65, 0x89})
+	if !bytes.Equal(buffer.Bytes(), expected) || recorder.Frames() != 3 {
+		t.Errorf("expected %X, got %X", expected, buffer.Bytes())
+	}
+}
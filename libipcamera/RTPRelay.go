@@ -1,146 +1,255 @@
 package libipcamera
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"encoding/hex"
-	"io"
+	"errors"
 	"log"
 	"net"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/jonas-koeritz/actioncam/rtp"
 )
 
-// RTPRelay holds information on the relaying stream listener
-type RTPRelay struct {
-	close      bool
-	targetIP   net.IP
-	targetPort int
-	listener   net.PacketConn
-	context    context.Context
+// senderReportInterval is the time between two RTCP sender reports
+const senderReportInterval = 5 * time.Second
+
+// RTPOutput sends the frames of a StreamIngest as an RTP stream, it implements FrameSink.
+// RTCP sender reports are sent to the port following the RTP port, receiver reports
+// arriving on the RTCP socket are logged.
+type RTPOutput struct {
+	conn       *net.UDPConn
+	rtcpConn   *net.UDPConn
+	target     *net.UDPAddr
+	rtcpTarget *net.UDPAddr
+	packetizer *rtp.H264Packetizer
+	cname      string
+	// initialSequenceNumber is the sequence number of the first RTP packet
+	initialSequenceNumber uint16
+
+	lock          sync.Mutex
+	packetCount   uint32
+	octetCount    uint32
+	lastTimestamp uint32
+	lastSent      time.Time
+	closed        chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
 }
 
-var close bool
+// CreateRTPOutput creates an RTP sender streaming to targetAddress:targetPort
+func CreateRTPOutput(targetAddress net.IP, targetPort int) (*RTPOutput, error) {
+	conn, rtcpConn, err := listenPortPair()
+	if err != nil {
+		return nil, err
+	}
 
-// CreateRTPRelay creates a UDP listener that handles live data
-// from the camera and forwards it as an RTP stream
-func CreateRTPRelay(ctx context.Context, targetAddress net.IP, targetPort int) *RTPRelay {
-	conn, err := net.ListenPacket("udp", ":6669")
+	hostname, _ := os.Hostname()
+	output := &RTPOutput{
+		conn:       conn,
+		rtcpConn:   rtcpConn,
+		target:     &net.UDPAddr{IP: targetAddress, Port: targetPort},
+		rtcpTarget: &net.UDPAddr{IP: targetAddress, Port: targetPort + 1},
+		packetizer: rtp.NewH264Packetizer(rtp.H264PayloadType, rtp.DefaultMTU),
+		cname:      "actioncam@" + hostname,
+		closed:     make(chan struct{}),
+	}
+	output.initialSequenceNumber = output.packetizer.SequenceNumber()
 
-	if err != nil {
-		log.Printf("ERROR: %s\n", err)
+	go output.sendReports()
+	go output.receiveReports()
+
+	return output, nil
+}
+
+// listenPortPair opens the UDP sockets for RTP and RTCP on an even and the following odd port
+func listenPortPair() (*net.UDPConn, *net.UDPConn, error) {
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		var conn *net.UDPConn
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			conn.Close()
+			continue
+		}
+
+		var rtcpConn *net.UDPConn
+		rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, rtcpConn, nil
 	}
-	
-	close = false
-	relay := RTPRelay{
-		close: false,
-		targetIP:   targetAddress,
-		targetPort: targetPort,
-		listener:   conn,
-		context:    ctx,
+	if err == nil {
+		err = errors.New("No free pair of UDP ports found")
 	}
-	if err != nil {
-		log.Printf("ERROR: %s\n", err)
+	return nil, nil, err
+}
+
+// WriteFrame sends a frame as RTP packets
+func (o *RTPOutput) WriteFrame(frame Frame) error {
+	packets := o.packetizer.Packetize(frame.Data, frame.Timestamp)
+	for _, packet := range packets {
+		_, err := o.conn.WriteToUDP(packet, o.target)
+		if err != nil {
+			return err
+		}
 	}
 
-	go handleCameraStream(relay, conn)
+	o.lock.Lock()
+	first := o.packetCount == 0
+	o.packetCount += uint32(len(packets))
+	for _, packet := range packets {
+		o.octetCount += uint32(len(packet) - rtp.HeaderSize)
+	}
+	o.lastTimestamp = frame.Timestamp
+	o.lastSent = time.Now()
+	o.lock.Unlock()
 
-	return &relay
+	if first {
+		// Receivers can synchronize as soon as the first report arrives
+		o.sendSenderReport()
+	}
+	return nil
 }
 
-func handleCameraStream(relay RTPRelay, conn net.PacketConn) {
-	buffer := make([]byte, 2048)
-	packetReader := bytes.NewReader(buffer)
-
-	header := streamHeader{}
-	var payload []byte
+// LocalPorts returns the local RTP and RTCP ports
+func (o *RTPOutput) LocalPorts() (int, int) {
+	return o.conn.LocalAddr().(*net.UDPAddr).Port, o.rtcpConn.LocalAddr().(*net.UDPAddr).Port
+}
 
-	rtpTarget := net.UDPAddr{
-		IP:   relay.targetIP,
-		Port: relay.targetPort,
+// sendSenderReport sends an RTCP sender report mapping the current time to the RTP clock
+func (o *RTPOutput) sendSenderReport() {
+	o.lock.Lock()
+	if o.packetCount == 0 {
+		o.lock.Unlock()
+		return
 	}
-	rtpSource, _ := net.ResolveUDPAddr("udp", "127.0.0.1")
-	rtpConn, err := net.DialUDP("udp", rtpSource, &rtpTarget)
-	if err != nil {
-		log.Printf("ERROR creating RTP sender: %s\n", err)
+	now := time.Now()
+	report := rtp.SenderReport{
+		SSRC:    o.packetizer.SSRC,
+		NTPTime: now,
+		// Extrapolate the timestamp of the last frame to the current time
+		RTPTime:     o.lastTimestamp + uint32(now.Sub(o.lastSent)*RTPClockRate/time.Second),
+		PacketCount: o.packetCount,
+		OctetCount:  o.octetCount,
+	}
+	o.lock.Unlock()
+
+	o.rtcpConn.WriteToUDP(report.Marshal(o.cname), o.rtcpTarget)
+}
+
+func (o *RTPOutput) sendReports() {
+	ticker := time.NewTicker(senderReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			o.sendSenderReport()
+		case <-o.closed:
+			return
+		}
 	}
+}
 
-	var sequenceNumber uint16
-	var elapsed uint32
-
-	frameBuffer := bytes.Buffer{}
-	packetBuffer := bytes.Buffer{}
-	T:
-		for {
-			conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-			
-			select {
-			case <-relay.context.Done():
-				log.Println("Context Done")
-				rtpConn.Close()
-				relay.listener.Close()
-				break T
-			default:
-				if close {
-					rtpConn.Close()
-					relay.listener.Close()
-					break T
-				}
-				
-				conn.ReadFrom(buffer)
-				packetReader.Reset(buffer)
-
-				binary.Read(packetReader, binary.BigEndian, &header)
-
-				if header.Magic != 0xBCDE {
-					log.Printf("Received message with invalid magic (%x).", header.Magic)
-					break
-				}
-
-				if header.Length > 0 {
-					payload = make([]byte, header.Length)
-					_, err := io.ReadFull(packetReader, payload)
-					if err != nil {
-						log.Printf("Read Error: %s\n", err)
-						break
-					}
-				} else {
-					payload = []byte{}
-				}
-
-				switch header.MessageType {
-				case 0x0001: // H.264 Data
-					frameBuffer.Write(payload)
-				case 0x0002: // Time
-					// Append the Framebuffer
-					packetBuffer.Write(frameBuffer.Bytes())
-
-					// Send out the packet
-					rtpConn.Write(packetBuffer.Bytes())
-
-					// Prepare the next packet
-					packetBuffer.Reset()
-					packetBuffer.Write([]byte{0x80, 0x63})
-					binary.Write(&packetBuffer, binary.BigEndian, sequenceNumber+1)
-					binary.Write(&packetBuffer, binary.BigEndian, (uint32)(elapsed)*90)
-					binary.Write(&packetBuffer, binary.BigEndian, (uint64(0)))
-
-					// Reset the Framebuffer
-					frameBuffer.Reset()
-					sequenceNumber++
-
-					elapsed = binary.LittleEndian.Uint32(payload[12:])
-				default:
-					log.Printf("Received Unknown Message: %+v\n", header)
-					log.Printf("Payload:\n%s\n", hex.Dump(payload))
-				}
+// receiveReports logs the reception reports of receivers for diagnostics
+func (o *RTPOutput) receiveReports() {
+	buffer := make([]byte, 1500)
+	for {
+		n, sender, err := o.rtcpConn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		reports, err := rtp.ParseReceptionReports(buffer[:n])
+		if err != nil {
+			log.Printf("Received invalid RTCP packet from %s: %s\n", sender, err)
+			continue
+		}
+		for _, report := range reports {
+			if report.SSRC != o.packetizer.SSRC {
+				continue
 			}
+			log.Printf("Receiver report from %s: %.1f%% lost (%d total), jitter %.1f ms\n",
+				sender, report.LossPercentage(), report.CumulativeLost, float64(report.Jitter)*1000/RTPClockRate)
 		}
+	}
+}
+
+// SSRC returns the synchronization source identifier of the RTP stream
+func (o *RTPOutput) SSRC() uint32 {
+	return o.packetizer.SSRC
+}
+
+// InitialSequenceNumber returns the sequence number of the first RTP packet of the stream
+func (o *RTPOutput) InitialSequenceNumber() uint16 {
+	return o.initialSequenceNumber
+}
+
+// Close stops sending and announces the end of the stream with an RTCP BYE, further calls
+// return the result of the first call
+func (o *RTPOutput) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.closed)
+		o.rtcpConn.WriteToUDP(rtp.Goodbye(o.packetizer.SSRC), o.rtcpTarget)
+		o.rtcpConn.Close()
+		o.closeErr = o.conn.Close()
+	})
+	return o.closeErr
+}
+
+// RTPRelay receives the preview stream of the camera and forwards it as an RTP stream,
+// further outputs can be attached to its Ingest
+type RTPRelay struct {
+	ingest      *StreamIngest
+	output      *RTPOutput
+	unsubscribe func()
+}
+
+// CreateRTPRelay creates a UDP listener on listenAddress that handles live data
+// from the camera and forwards it as an RTP stream
+func CreateRTPRelay(ctx context.Context, listenAddress string, targetAddress net.IP, targetPort int) (*RTPRelay, error) {
+	ingest, err := CreateStreamIngest(ctx, listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := CreateRTPOutput(targetAddress, targetPort)
+	if err != nil {
+		ingest.Stop()
+		return nil, err
+	}
+
+	return &RTPRelay{
+		ingest:      ingest,
+		output:      output,
+		unsubscribe: ingest.Subscribe(output),
+	}, nil
+}
+
+// Ingest returns the stream the relay receives from the camera
+func (r *RTPRelay) Ingest() *StreamIngest {
+	return r.ingest
+}
+
+// Output returns the RTP sender of the relay
+func (r *RTPRelay) Output() *RTPOutput {
+	return r.output
+}
+
+// Stats returns the counters of the stream received from the camera
+func (r *RTPRelay) Stats() StreamStats {
+	return r.ingest.Stats()
 }
 
 // Stop stops listening for packets
 func (r *RTPRelay) Stop() {
-	close = true
-	r.close = true
-	r.listener.Close()
+	r.unsubscribe()
+	r.ingest.Stop()
+	r.output.Close()
 }
@@ -0,0 +1,92 @@
+package libipcamera
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/rtp"
+)
+
+func TestRTPOutputSendsSenderReports(t *testing.T) {
+	receiver, rtcpReceiver, err := listenPortPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	defer rtcpReceiver.Close()
+
+	output, err := CreateRTPOutput(net.ParseIP("127.0.0.1"), receiver.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	err = output.WriteFrame(Frame{Data: []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}, Timestamp: 9000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 1500)
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := receiver.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != rtp.HeaderSize+3 || binary.BigEndian.Uint32(buffer[8:]) != output.SSRC() {
+		t.Errorf("unexpected RTP packet %X", buffer[:n])
+	}
+
+	rtcpReceiver.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err = rtcpReceiver.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer[1] != rtp.TypeSenderReport || binary.BigEndian.Uint32(buffer[4:]) != output.SSRC() {
+		t.Fatalf("expected a sender report, got %X", buffer[:n])
+	}
+	if packets, octets := binary.BigEndian.Uint32(buffer[20:]), binary.BigEndian.Uint32(buffer[24:]); packets != 1 || octets != 3 {
+		t.Errorf("expected 1 packet and 3 octets, got %d and %d", packets, octets)
+	}
+	if rtpTime := binary.BigEndian.Uint32(buffer[16:]); rtpTime < 9000 || rtpTime > 9000+RTPClockRate {
+		t.Errorf("RTP time %d does not match the sent frame", rtpTime)
+	}
+}
+
+func TestRTPOutputClose(t *testing.T) {
+	receiver, rtcpReceiver, err := listenPortPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	defer rtcpReceiver.Close()
+
+	output, err := CreateRTPOutput(net.ParseIP("127.0.0.1"), receiver.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Closing twice must not panic or send a second BYE
+	if err := output.Close(); err != nil {
+		t.Errorf("expected the result of the first call, got %v", err)
+	}
+
+	buffer := make([]byte, 1500)
+	goodbyes := 0
+	for {
+		rtcpReceiver.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := rtcpReceiver.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+		if n > 1 && buffer[1] == rtp.TypeGoodbye {
+			goodbyes++
+		}
+	}
+	if goodbyes != 1 {
+		t.Errorf("expected a single BYE, got %d", goodbyes)
+	}
+}
@@ -0,0 +1,91 @@
+package libipcamera
+
+import (
+	"sync"
+	"time"
+)
+
+// containerWriter writes the access units of a recording in a container format
+type containerWriter interface {
+	// begin is called with the parameter sets of the first recorded key frame
+	begin(parameterSets *ParameterSets) error
+	// writeAccessUnit writes a frame, elapsed is the time since the first recorded frame
+	writeAccessUnit(frame Frame, elapsed time.Duration, parameterSets *ParameterSets) error
+	// finish is called when the recorder is closed after the recording has begun
+	finish() error
+}
+
+// recorder is the FrameSink shared by the recorders of all formats. Recording starts at the
+// first key frame with its parameter sets, the frames are then passed on to the container.
+type recorder struct {
+	container containerWriter
+
+	lock          sync.Mutex
+	parameterSets ParameterSets
+	started       bool
+	// start is the presentation time of the first recorded frame
+	start  time.Duration
+	last   time.Duration
+	frames int
+	closed bool
+}
+
+// WriteFrame adds a frame to the recording, frames written after Close are discarded
+func (r *recorder) WriteFrame(frame Frame) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	r.parameterSets.Update(frame)
+	if !r.started {
+		if !frame.IsKeyFrame() || !r.parameterSets.Complete() {
+			return nil
+		}
+		err := r.container.begin(&r.parameterSets)
+		if err != nil {
+			return err
+		}
+		r.started = true
+		r.start = frame.PTS
+	}
+
+	err := r.container.writeAccessUnit(frame, frame.PTS-r.start, &r.parameterSets)
+	if err != nil {
+		return err
+	}
+	r.frames++
+	r.last = frame.PTS
+	return nil
+}
+
+// Frames returns the number of recorded frames
+func (r *recorder) Frames() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.frames
+}
+
+// Duration returns the time between the first and the last recorded frame
+func (r *recorder) Duration() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.last - r.start
+}
+
+// Close stops the recording and finalizes the container, it does not close the underlying writer
+func (r *recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if !r.started {
+		return nil
+	}
+	return r.container.finish()
+}
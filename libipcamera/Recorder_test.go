@@ -0,0 +1,69 @@
+package libipcamera
+
+import (
+	"testing"
+	"time"
+)
+
+type testContainer struct {
+	begun    int
+	elapsed  []time.Duration
+	finished int
+}
+
+func (c *testContainer) begin(parameterSets *ParameterSets) error {
+	c.begun++
+	return nil
+}
+
+func (c *testContainer) writeAccessUnit(frame Frame, elapsed time.Duration, parameterSets *ParameterSets) error {
+	c.elapsed = append(c.elapsed, elapsed)
+	return nil
+}
+
+func (c *testContainer) finish() error {
+	c.finished++
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	container := &testContainer{}
+	r := &recorder{container: container}
+
+	sps := buildSPS(100, 40, 23, 4, 0, 0)
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	frames := []Frame{
+		{Data: annexB([]byte{0x41, 0x9A}), PTS: 100 * time.Millisecond},
+		// A key frame without parameter sets can not be decoded
+		{Data: annexB([]byte{0x65, 0x88}), PTS: 133 * time.Millisecond},
+		{Data: annexB(sps, pps, []byte{0x65, 0x88}), PTS: 166 * time.Millisecond},
+		{Data: annexB([]byte{0x41, 0x9A}), PTS: 200 * time.Millisecond},
+	}
+	for _, frame := range frames {
+		if err := r.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if container.begun != 1 || len(container.elapsed) != 2 || container.elapsed[0] != 0 || container.elapsed[1] != 34*time.Millisecond {
+		t.Errorf("unexpected container calls %+v", container)
+	}
+	if r.Frames() != 2 || r.Duration() != 34*time.Millisecond {
+		t.Errorf("expected 2 frames in 34ms, got %d in %s", r.Frames(), r.Duration())
+	}
+
+	r.Close()
+	r.Close()
+	r.WriteFrame(frames[3])
+	if container.finished != 1 || r.Frames() != 2 {
+		t.Errorf("expected a single finish and no frames after closing, got %d finishes and %d frames", container.finished, r.Frames())
+	}
+
+	// Recordings that never began are not finalized
+	container = &testContainer{}
+	r = &recorder{container: container}
+	r.WriteFrame(frames[0])
+	r.Close()
+	if container.begun != 0 || container.finished != 0 {
+		t.Errorf("unexpected container calls %+v", container)
+	}
+}
@@ -0,0 +1,112 @@
+package libipcamera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// remoteBlockSize is the minimum number of Bytes requested at once, small reads
+// (e.g. of MP4 box headers) are served from the last block that has been read
+const remoteBlockSize = 64 * 1024
+
+var remoteFileClient = &http.Client{
+	Timeout: 60 * time.Second,
+}
+
+// RemoteFile provides random access to a file stored on the cameras SD-Card
+// using HTTP Range requests, it implements io.ReaderAt
+type RemoteFile struct {
+	ctx  context.Context
+	url  string
+	size int64
+
+	lock        sync.Mutex
+	block       []byte
+	blockOffset int64
+}
+
+// OpenFile returns a RemoteFile to read a file stored on the cameras SD-Card, pending
+// reads are canceled with ctx
+func (c *Camera) OpenFile(ctx context.Context, file StoredFile) *RemoteFile {
+	return &RemoteFile{
+		ctx:  ctx,
+		url:  c.FileURL(file.Path),
+		size: int64(file.Size),
+	}
+}
+
+// Size returns the size of the file
+func (f *RemoteFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) Bytes starting at offset off
+func (f *RemoteFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("Negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// Serve the read from the cached block if possible
+	if off >= f.blockOffset && off+int64(len(p)) <= f.blockOffset+int64(len(f.block)) {
+		return copy(p, f.block[off-f.blockOffset:]), nil
+	}
+
+	length := int64(len(p))
+	if length < remoteBlockSize {
+		length = remoteBlockSize
+	}
+	if off+length > f.size {
+		length = f.size - off
+	}
+
+	data, err := f.readRange(off, length)
+	if err != nil {
+		return 0, err
+	}
+	if len(p) < len(data) {
+		f.block = data
+		f.blockOffset = off
+	}
+
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *RemoteFile) readRange(off, length int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(f.ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+
+	response, err := remoteFileClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("Camera does not support Range requests (HTTP status: %s)", response.Status)
+	}
+
+	data := make([]byte, length)
+	n, err := io.ReadFull(response.Body, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return data[:n], nil
+}
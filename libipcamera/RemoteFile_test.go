@@ -0,0 +1,137 @@
+package libipcamera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// rangeServer serves data using Range requests and counts the requests
+func rangeServer(t *testing.T, data []byte) (*httptest.Server, func() int) {
+	lock := sync.Mutex{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		http.ServeContent(w, r, "file", time.Now(), bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+}
+
+func TestRemoteFileReadAt(t *testing.T) {
+	data := make([]byte, 3*remoteBlockSize+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	server, requests := rangeServer(t, data)
+	file := &RemoteFile{ctx: context.Background(), url: server.URL + "/DCIM/MOVIE/file.MP4", size: int64(len(data))}
+
+	// Small reads are served from the block read by the first request
+	header := make([]byte, 8)
+	for _, offset := range []int64{0, 8, 1000, remoteBlockSize - 8} {
+		n, err := file.ReadAt(header, offset)
+		if err != nil || n != 8 || !bytes.Equal(header, data[offset:offset+8]) {
+			t.Fatalf("unexpected read at %d: %X (%v)", offset, header[:n], err)
+		}
+	}
+	if requests() != 1 {
+		t.Errorf("expected small reads to share one request, got %d requests", requests())
+	}
+
+	// Large reads are requested as a whole
+	large := make([]byte, 2*remoteBlockSize)
+	if n, err := file.ReadAt(large, 50); err != nil || n != len(large) || !bytes.Equal(large, data[50:50+len(large)]) {
+		t.Errorf("unexpected large read of %d Bytes (%v)", n, err)
+	}
+
+	// Reads beyond the end return the remaining data and io.EOF
+	tail := make([]byte, 200)
+	n, err := file.ReadAt(tail, int64(len(data)-100))
+	if n != 100 || err != io.EOF || !bytes.Equal(tail[:n], data[len(data)-100:]) {
+		t.Errorf("expected 100 Bytes and io.EOF, got %d Bytes (%v)", n, err)
+	}
+	if _, err := file.ReadAt(tail, int64(len(data))); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the file, got %v", err)
+	}
+	if _, err := file.ReadAt(tail, -1); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+}
+
+func TestRemoteFileWithoutRangeSupport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1000))
+	}))
+	defer server.Close()
+
+	file := &RemoteFile{ctx: context.Background(), url: server.URL, size: 1000}
+	if _, err := file.ReadAt(make([]byte, 10), 0); err == nil {
+		t.Error("expected an error if the server ignores the Range header")
+	}
+}
+
+func TestRemoteFileMP4(t *testing.T) {
+	sps := buildSPS(100, 40, 23, 4, 0, 0)
+	buffer := bytes.Buffer{}
+	err := mp4.WriteStill(&buffer, mp4.NewAVCDecoderConfiguration(sps, []byte{0x68, 0xCE, 0x3C, 0x80}), 640, 360, mp4.SampleFromNALUnits([]byte{0x65, 0x88, 0x84}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := rangeServer(t, buffer.Bytes())
+
+	file := &RemoteFile{ctx: context.Background(), url: server.URL, size: int64(buffer.Len())}
+	movie, err := mp4.Open(file, file.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, found := movie.VideoTrack()
+	if !found || track.Width != 640 || track.SampleCount() != 1 {
+		t.Fatalf("unexpected video track %+v", track)
+	}
+	if sample, err := track.ReadSample(0); err != nil || !bytes.Equal(sample, mp4.SampleFromNALUnits([]byte{0x65, 0x88, 0x84})) {
+		t.Errorf("unexpected sample %X (%v)", sample, err)
+	}
+}
+
+func TestRemoteFileCanceled(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		// A camera that does not respond
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	file := &RemoteFile{ctx: ctx, url: server.URL, size: 1000}
+	result := make(chan error, 1)
+	go func() {
+		_, err := file.ReadAt(make([]byte, 10), 0)
+		result <- err
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the read was not canceled")
+	}
+}
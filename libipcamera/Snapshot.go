@@ -0,0 +1,64 @@
+package libipcamera
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// ErrMissingParameterSets is returned if a key frame does not contain its SPS and PPS
+var ErrMissingParameterSets = errors.New("Frame does not contain the parameter sets")
+
+// Snapshot waits for the next key frame of the stream and returns it as self-contained
+// access unit, the SPS and PPS are inserted in front of the IDR slices if necessary
+func (i *StreamIngest) Snapshot(ctx context.Context) (Frame, error) {
+	frames, unsubscribe := i.Frames()
+	defer unsubscribe()
+
+	i.lock.Lock()
+	parameterSets := i.parameterSets
+	i.lock.Unlock()
+
+	for {
+		select {
+		case frame := <-frames:
+			parameterSets.Update(frame)
+			if frame.IsKeyFrame() && parameterSets.Complete() {
+				frame.Data = parameterSets.Prepend(frame)
+				return frame, nil
+			}
+		case <-ctx.Done():
+			return Frame{}, ctx.Err()
+		case <-i.context.Done():
+			return Frame{}, i.context.Err()
+		}
+	}
+}
+
+// WriteSnapshotMP4 writes a key frame containing its parameter sets (see Snapshot) as
+// MP4 file with a single sample
+func WriteSnapshotMP4(w io.Writer, frame Frame) error {
+	parameterSets := ParameterSets{}
+	parameterSets.Update(frame)
+	if !frame.IsKeyFrame() || !parameterSets.Complete() {
+		return ErrMissingParameterSets
+	}
+	sps, err := ParseSPS(parameterSets.SPS)
+	if err != nil {
+		return err
+	}
+
+	nalUnits := make([][]byte, 0)
+	for _, nal := range frame.NALUnits() {
+		switch nal.Type() {
+		case NALUnitAccessUnitDelimiter, NALUnitSPS, NALUnitPPS:
+			// The parameter sets are part of the decoder configuration
+		default:
+			nalUnits = append(nalUnits, nal)
+		}
+	}
+	config := mp4.NewAVCDecoderConfiguration(parameterSets.SPS, parameterSets.PPS)
+	return mp4.WriteStill(w, config, uint16(sps.Width), uint16(sps.Height), mp4.SampleFromNALUnits(nalUnits...))
+}
@@ -0,0 +1,75 @@
+package libipcamera
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+func TestStreamIngestSnapshot(t *testing.T) {
+	ingest := &StreamIngest{subscribers: make(map[*subscriber]struct{}), parameterSetsReceived: make(chan struct{})}
+	ingest.context, ingest.cancel = context.WithCancel(context.Background())
+	defer ingest.cancel()
+
+	sps := buildSPS(100, 40, 23, 4, 0, 0)
+	pps := []byte{0x68, 0xCE, 0x3C, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	// The parameter sets are only sent with the first key frame
+	ingest.publish(Frame{Data: annexB(sps, pps, idr)})
+
+	received := make(chan Frame, 1)
+	go func() {
+		frame, err := ingest.Snapshot(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		received <- frame
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ingest.publish(Frame{Data: annexB([]byte{0x41, 0x9A}), PTS: 33 * time.Millisecond})
+	ingest.publish(Frame{Data: annexB([]byte{0x09, 0xF0}, idr), PTS: 66 * time.Millisecond})
+
+	var frame Frame
+	select {
+	case frame = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("no snapshot received")
+	}
+	expected := annexB([]byte{0x09, 0xF0}, sps, pps, idr)
+	if frame.PTS != 66*time.Millisecond || !bytes.Equal(frame.Data, expected) {
+		t.Errorf("unexpected snapshot %s: %X", frame.PTS, frame.Data)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := WriteSnapshotMP4(&buffer, frame); err != nil {
+		t.Fatal(err)
+	}
+	file, err := mp4.Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, found := file.VideoTrack()
+	if !found || track.Width != 640 || track.Height != 360 || track.SampleCount() != 1 {
+		t.Fatalf("unexpected video track %+v", track)
+	}
+	// The parameter sets are only stored in the decoder configuration
+	sample, err := track.ReadSample(0)
+	if err != nil || !bytes.Equal(sample, mp4.SampleFromNALUnits(idr)) {
+		t.Errorf("unexpected sample %X (%v)", sample, err)
+	}
+
+	if err := WriteSnapshotMP4(&buffer, Frame{Data: annexB(idr)}); err != ErrMissingParameterSets {
+		t.Errorf("expected ErrMissingParameterSets, got %v", err)
+	}
+
+	// Waiting is canceled with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ingest.Snapshot(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package libipcamera
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+)
+
+// The preview stream (UDP, 0xBCDE headers) consists of two message types:
+//
+//	0x0001 carries a chunk of the H.264 elementary stream in Annex-B format. A frame
+//	       is split into as many messages as needed, chunks do not align with NAL units.
+//	0x0002 follows the last chunk of every frame and terminates it. Its payload is 16 Bytes
+//	       long, the last 4 Bytes are a little endian millisecond counter that starts when
+//	       the preview is started. The meaning of Bytes 0-11 is unknown, they are ignored.
+//
+// The counter advances by the frame interval (33/34 ms at 30 fps) from one time message
+// to the next, it is therefore used as the capture time of the frame the message terminates
+// (not of the frame that follows it).
+//
+// The counter is 32 bit wide and wraps after ~49.7 days, it restarts at a small value
+// if the preview is restarted while the stream is being received.
+const (
+	streamMessageH264 = 0x0001
+	streamMessageTime = 0x0002
+)
+
+// timeMessageSize is the minimum payload size of a time message
+const timeMessageSize = 16
+
+// RTPClockRate is the clock rate of RTP timestamps for video streams
+const RTPClockRate = 90000
+
+// parseTimeMessage returns the millisecond counter of a time message
+func parseTimeMessage(payload []byte) (uint32, bool) {
+	if len(payload) < timeMessageSize {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(payload[12:]), true
+}
+
+// streamClock converts the cameras millisecond counter into a monotonic presentation time
+type streamClock struct {
+	started bool
+	last    uint32
+	// current is the presentation time in ms, extended to 64 bit
+	current uint64
+	// interval is the last frame interval, used to bridge discontinuities
+	interval uint64
+}
+
+// maxClockJump is the largest forward step of the counter that is accepted as regular
+const maxClockJump = 10 * 1000
+
+// update advances the clock to the counter value of a time message and returns the presentation time in ms
+func (c *streamClock) update(counter uint32) uint64 {
+	if !c.started {
+		c.started = true
+		c.last = counter
+		c.current = uint64(counter)
+		c.interval = 33
+		return c.current
+	}
+
+	// Unsigned arithmetic handles the wrap-around of the 32 bit counter
+	delta := counter - c.last
+	c.last = counter
+
+	if delta == 0 || delta > maxClockJump {
+		// The counter went backwards or jumped (e.g. the preview was restarted), continue
+		// with the previous frame interval to keep the presentation time monotonic
+		log.Printf("WARNING: Stream clock discontinuity (%d ms), continuing at %d ms intervals\n", int32(delta), c.interval)
+		c.current += c.interval
+		return c.current
+	}
+
+	c.interval = uint64(delta)
+	c.current += uint64(delta)
+	return c.current
+}
+
+// rtpTimestamp converts a presentation time in ms to a 90 kHz RTP timestamp, the value wraps around as required by RTP
+func rtpTimestamp(milliseconds uint64) uint32 {
+	return uint32(milliseconds * (RTPClockRate / 1000))
+}
+
+// presentationTime converts a presentation time in ms to a time.Duration
+func presentationTime(milliseconds uint64) time.Duration {
+	return time.Duration(milliseconds) * time.Millisecond
+}
@@ -0,0 +1,37 @@
+package libipcamera
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestStreamClock(t *testing.T) {
+	clock := streamClock{}
+
+	counters := []uint32{0xFFFFFFD0, 0xFFFFFFF1, 0x00000012, 0x00000033, 0x00000010, 0x00000031}
+	expected := []uint64{0xFFFFFFD0, 0xFFFFFFF1, 0x100000012, 0x100000033, 0x100000054, 0x100000075}
+
+	for i, counter := range counters {
+		milliseconds := clock.update(counter)
+		if milliseconds != expected[i] {
+			t.Errorf("counter %08X: expected %d ms, got %d ms", counter, expected[i], milliseconds)
+		}
+	}
+
+	if timestamp := rtpTimestamp(expected[2]); timestamp != uint32(expected[2]*90) {
+		t.Errorf("unexpected RTP timestamp %d", timestamp)
+	}
+}
+
+func TestParseTimeMessage(t *testing.T) {
+	payload := make([]byte, 16)
+	binary.LittleEndian.PutUint32(payload[12:], 1234)
+
+	elapsed, valid := parseTimeMessage(payload)
+	if !valid || elapsed != 1234 {
+		t.Errorf("expected 1234 ms, got %d (valid: %t)", elapsed, valid)
+	}
+	if _, valid := parseTimeMessage(payload[:12]); valid {
+		t.Error("expected short time message to be rejected")
+	}
+}
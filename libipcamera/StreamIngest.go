@@ -0,0 +1,282 @@
+package libipcamera
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// frameQueueSize is the number of frames buffered for each subscriber of a StreamIngest
+const frameQueueSize = 64
+
+// Frame is a H.264 access unit received from the cameras preview stream
+type Frame struct {
+	// Data contains the NAL units of the frame in Annex-B format
+	Data []byte
+	// Elapsed is the raw millisecond counter of the time message (0x0002) terminating the frame
+	Elapsed uint32
+	// PTS is the monotonic presentation time of the frame derived from Elapsed
+	PTS time.Duration
+	// Timestamp is the presentation time on a 90 kHz clock, it wraps around like RTP timestamps
+	Timestamp uint32
+	// Received is the local time the frame was completed
+	Received time.Time
+}
+
+// FrameSink consumes the frames of a StreamIngest
+type FrameSink interface {
+	WriteFrame(frame Frame) error
+}
+
+// FrameSinkFunc allows to use a function as a FrameSink
+type FrameSinkFunc func(frame Frame) error
+
+// WriteFrame calls f(frame)
+func (f FrameSinkFunc) WriteFrame(frame Frame) error {
+	return f(frame)
+}
+
+// StreamIngest receives the preview stream of the camera and distributes the
+// H.264 frames to any number of subscribed outputs
+type StreamIngest struct {
+	listener net.PacketConn
+	context  context.Context
+	cancel   context.CancelFunc
+
+	lock        sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// parameterSets are the latest SPS and PPS of the stream, parameterSetsReceived
+	// is closed once both have been received
+	parameterSets         ParameterSets
+	parameterSetsReceived chan struct{}
+
+	stats streamStatistics
+}
+
+// subscriber delivers frames to a FrameSink from its own goroutine so a slow
+// output does not delay the others
+type subscriber struct {
+	sink    FrameSink
+	frames  chan Frame
+	dropped int
+}
+
+// CreateStreamIngest creates a UDP listener on listenAddress (e.g. ":6669") that receives the live data of the camera
+func CreateStreamIngest(ctx context.Context, listenAddress string) (*StreamIngest, error) {
+	conn, err := net.ListenPacket("udp", listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	ingest := &StreamIngest{
+		listener:              conn,
+		subscribers:           make(map[*subscriber]struct{}),
+		parameterSetsReceived: make(chan struct{}),
+	}
+	ingest.context, ingest.cancel = context.WithCancel(ctx)
+
+	go ingest.receive()
+
+	return ingest, nil
+}
+
+// Addr returns the local address the stream is received on
+func (i *StreamIngest) Addr() net.Addr {
+	return i.listener.LocalAddr()
+}
+
+// subscribe registers a new subscriber, unsubscribe removes it and closes its channel
+func (i *StreamIngest) subscribe(sink FrameSink) (s *subscriber, unsubscribe func()) {
+	s = &subscriber{
+		sink:   sink,
+		frames: make(chan Frame, frameQueueSize),
+	}
+
+	i.lock.Lock()
+	i.subscribers[s] = struct{}{}
+	i.lock.Unlock()
+
+	var once sync.Once
+	unsubscribe = func() {
+		once.Do(func() {
+			i.lock.Lock()
+			delete(i.subscribers, s)
+			i.lock.Unlock()
+			close(s.frames)
+		})
+	}
+	return s, unsubscribe
+}
+
+// Subscribe registers a FrameSink that is called for every received frame until unsubscribe is called.
+// Frames are dropped if the sink can not keep up, a sink returning an error is unsubscribed.
+func (i *StreamIngest) Subscribe(sink FrameSink) (unsubscribe func()) {
+	s, unsubscribe := i.subscribe(sink)
+
+	go func() {
+		for frame := range s.frames {
+			err := s.sink.WriteFrame(frame)
+			if err != nil {
+				log.Printf("ERROR writing frame, removing output: %s\n", err)
+				go unsubscribe()
+				// Drain the queue until unsubscribe closed it
+				for range s.frames {
+				}
+				return
+			}
+		}
+	}()
+
+	return unsubscribe
+}
+
+// Frames returns a channel receiving all frames, it is closed when unsubscribe is called.
+// Frames are dropped if the channel is not read fast enough.
+func (i *StreamIngest) Frames() (frames <-chan Frame, unsubscribe func()) {
+	s, unsubscribe := i.subscribe(nil)
+	return s.frames, unsubscribe
+}
+
+// ParameterSets waits until the SPS and PPS of the stream have been received and returns the latest ones
+func (i *StreamIngest) ParameterSets(ctx context.Context) (ParameterSets, error) {
+	select {
+	case <-i.parameterSetsReceived:
+	case <-ctx.Done():
+		return ParameterSets{}, ctx.Err()
+	case <-i.context.Done():
+		return ParameterSets{}, i.context.Err()
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.parameterSets, nil
+}
+
+// publish hands a frame to all subscribers
+func (i *StreamIngest) publish(frame Frame) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.parameterSets.Update(frame)
+	select {
+	case <-i.parameterSetsReceived:
+	default:
+		if i.parameterSets.Complete() {
+			close(i.parameterSetsReceived)
+		}
+	}
+
+	for s := range i.subscribers {
+		select {
+		case s.frames <- frame:
+		default:
+			s.dropped++
+			if s.dropped == 1 || s.dropped%100 == 0 {
+				log.Printf("WARNING: Output can not keep up with the stream, %d frames dropped\n", s.dropped)
+			}
+		}
+	}
+}
+
+func (i *StreamIngest) receive() {
+	buffer := make([]byte, 2048)
+	packetReader := bytes.NewReader(buffer)
+
+	header := streamHeader{}
+	var payload []byte
+	clock := streamClock{}
+
+	frameBuffer := bytes.Buffer{}
+	for {
+		if i.context.Err() != nil {
+			i.listener.Close()
+			return
+		}
+
+		i.listener.SetReadDeadline(time.Now().Add(10 * time.Second))
+		n, _, err := i.listener.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			if i.context.Err() == nil {
+				log.Printf("ERROR receiving stream: %s\n", err)
+			}
+			return
+		}
+		packetReader.Reset(buffer[:n])
+
+		err = binary.Read(packetReader, binary.BigEndian, &header)
+		if err != nil {
+			i.stats.invalid()
+			continue
+		}
+
+		if header.Magic != 0xBCDE {
+			log.Printf("Received message with invalid magic (%x).", header.Magic)
+			i.stats.invalid()
+			continue
+		}
+		i.stats.packet(header.SequenceNumber, time.Now())
+
+		if header.Length > 0 {
+			payload = make([]byte, header.Length)
+			_, err := io.ReadFull(packetReader, payload)
+			if err != nil {
+				log.Printf("Read Error: %s\n", err)
+				i.stats.invalid()
+				continue
+			}
+		} else {
+			payload = []byte{}
+		}
+
+		switch header.MessageType {
+		case streamMessageH264:
+			frameBuffer.Write(payload)
+		case streamMessageTime:
+			elapsed, valid := parseTimeMessage(payload)
+			if !valid {
+				log.Printf("Received invalid time message (%d Bytes), dropping frame\n", len(payload))
+				i.stats.invalid()
+			} else if frameBuffer.Len() > 0 {
+				milliseconds := clock.update(elapsed)
+				frame := Frame{
+					Data:      append([]byte(nil), frameBuffer.Bytes()...),
+					Elapsed:   elapsed,
+					PTS:       presentationTime(milliseconds),
+					Timestamp: rtpTimestamp(milliseconds),
+					Received:  time.Now(),
+				}
+				i.stats.frame(frame)
+				i.publish(frame)
+			}
+
+			// Reset the Framebuffer
+			frameBuffer.Reset()
+		default:
+			// Unknown messages are only counted, see Stats
+			if i.stats.unknown(header.MessageType) {
+				log.Printf("Received unknown message type 0x%04X (%d Bytes)\n", header.MessageType, len(payload))
+			}
+		}
+	}
+}
+
+// Stats returns the counters of the received stream
+func (i *StreamIngest) Stats() StreamStats {
+	return i.stats.snapshot(time.Now())
+}
+
+// Stop stops listening for the stream
+func (i *StreamIngest) Stop() {
+	i.cancel()
+	i.listener.Close()
+}
@@ -0,0 +1,147 @@
+package libipcamera
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamIngestDistributesFrames(t *testing.T) {
+	ingest := &StreamIngest{subscribers: make(map[*subscriber]struct{}), parameterSetsReceived: make(chan struct{})}
+
+	received := make(chan Frame, 1)
+	unsubscribe := ingest.Subscribe(FrameSinkFunc(func(frame Frame) error {
+		received <- frame
+		return nil
+	}))
+	defer unsubscribe()
+
+	frames, stopFrames := ingest.Frames()
+
+	failing := ingest.Subscribe(FrameSinkFunc(func(frame Frame) error {
+		return errors.New("output closed")
+	}))
+	defer failing()
+
+	frame := Frame{Data: []byte{0x00, 0x00, 0x00, 0x01, 0x65}, Elapsed: 40}
+	ingest.publish(frame)
+
+	for _, channel := range []<-chan Frame{received, frames} {
+		select {
+		case got := <-channel:
+			if !bytes.Equal(got.Data, frame.Data) || got.Elapsed != frame.Elapsed {
+				t.Errorf("expected frame %+v, got %+v", frame, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("frame was not delivered to all subscribers")
+		}
+	}
+
+	stopFrames()
+	if _, open := <-frames; open {
+		t.Error("expected the frame channel to be closed")
+	}
+
+	// The failing output removes itself from the ingest
+	deadline := time.Now().Add(time.Second)
+	for {
+		ingest.lock.Lock()
+		count := len(ingest.subscribers)
+		ingest.lock.Unlock()
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 1 remaining subscriber, got %d", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func streamPacket(messageType uint16, payload []byte) []byte {
+	packet := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(packet, 0xBCDE)
+	binary.BigEndian.PutUint16(packet[2:], uint16(len(payload)))
+	binary.BigEndian.PutUint16(packet[6:], messageType)
+	return append(packet, payload...)
+}
+
+func TestStreamIngestReceivesFrames(t *testing.T) {
+	ingest, err := CreateStreamIngest(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ingest.Stop()
+
+	// A second ingest can not use the same address
+	if second, err := CreateStreamIngest(context.Background(), ingest.Addr().String()); err == nil {
+		second.Stop()
+		t.Error("expected an error binding the same address twice")
+	}
+
+	frames, unsubscribe := ingest.Frames()
+	defer unsubscribe()
+
+	camera, err := net.Dial("udp", ingest.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer camera.Close()
+
+	timeMessage := make([]byte, 16)
+	binary.LittleEndian.PutUint32(timeMessage[12:], 1000)
+	camera.Write(streamPacket(streamMessageH264, []byte{0x00, 0x00, 0x00, 0x01, 0x65}))
+	camera.Write(streamPacket(streamMessageH264, []byte{0x88, 0x84}))
+	camera.Write(streamPacket(streamMessageTime, timeMessage))
+
+	select {
+	case frame := <-frames:
+		if !bytes.Equal(frame.Data, []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84}) {
+			t.Errorf("unexpected frame data %X", frame.Data)
+		}
+		if frame.Elapsed != 1000 || frame.PTS != time.Second || frame.Timestamp != 90000 {
+			t.Errorf("unexpected frame timing %+v", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+}
+
+func TestStreamIngestParameterSets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ingest := &StreamIngest{subscribers: make(map[*subscriber]struct{}), parameterSetsReceived: make(chan struct{})}
+	ingest.context, ingest.cancel = context.WithCancel(context.Background())
+	defer ingest.cancel()
+
+	received := make(chan ParameterSets, 1)
+	go func() {
+		parameterSets, err := ingest.ParameterSets(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- parameterSets
+	}()
+
+	ingest.publish(Frame{Data: []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x1F}})
+	ingest.publish(Frame{Data: []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88}})
+
+	select {
+	case parameterSets := <-received:
+		if !bytes.Equal(parameterSets.SPS, []byte{0x67, 0x42, 0x00, 0x1F}) || !bytes.Equal(parameterSets.PPS, []byte{0x68, 0xCE}) {
+			t.Errorf("unexpected parameter sets %X %X", parameterSets.SPS, parameterSets.PPS)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("parameter sets were not reported")
+	}
+
+	// Waiting is canceled with the context
+	cancel()
+	other := &StreamIngest{subscribers: make(map[*subscriber]struct{}), parameterSetsReceived: make(chan struct{}), context: context.Background()}
+	if _, err := other.ParameterSets(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package libipcamera
+
+import (
+	"sync"
+	"time"
+)
+
+// statsWindow is the time frame rate and bitrate are averaged over
+const statsWindow = 2 * time.Second
+
+// maxSequenceGap is the largest gap in the sequence numbers of the preview stream that is
+// counted as lost packets, larger steps are caused by a restart of the preview
+const maxSequenceGap = 1000
+
+// StreamStats are the counters of a received preview stream
+type StreamStats struct {
+	// Started is the local time the first packet has been received
+	Started time.Time
+	// Packets is the number of 0xBCDE packets received
+	Packets uint64
+	// LostPackets is the number of packets missing from the sequence numbers of the packet headers
+	LostPackets uint64
+	// InvalidPackets have been dropped because of a wrong magic, a truncated payload or an
+	// invalid time message
+	InvalidPackets uint64
+	// UnknownMessages counts the messages of unknown type by their type
+	UnknownMessages map[uint16]uint64
+	// Frames and KeyFrames are the numbers of frames published
+	Frames    uint64
+	KeyFrames uint64
+	// Bytes is the size of the H.264 data of all frames
+	Bytes uint64
+	// FrameRate and Bitrate (in bits/s) are averaged over the last two seconds
+	FrameRate float64
+	Bitrate   float64
+	// MaxFrameGap is the longest time between the reception of two consecutive frames
+	MaxFrameGap time.Duration
+	// LastFrame is the local time the last frame has been received
+	LastFrame time.Time
+}
+
+// UnknownMessageCount returns the number of messages of all unknown types
+func (s StreamStats) UnknownMessageCount() uint64 {
+	count := uint64(0)
+	for _, messages := range s.UnknownMessages {
+		count += messages
+	}
+	return count
+}
+
+// streamStatistics maintains the StreamStats of a StreamIngest
+type streamStatistics struct {
+	lock  sync.Mutex
+	stats StreamStats
+	// lastSequence is the sequence number of the last packet, valid if sequenceStarted is set
+	lastSequence    uint16
+	sequenceStarted bool
+	// recent are the frames received within the last statsWindow
+	recent []frameArrival
+}
+
+// frameArrival is the reception time and size of a frame
+type frameArrival struct {
+	received time.Time
+	size     int
+}
+
+// packet counts a received packet, gaps in the sequence numbers are counted as lost
+// packets. The camera is assumed to increment the sequence number with every packet,
+// small backward steps are caused by reordered packets and are ignored.
+func (s *streamStatistics) packet(sequenceNumber uint16, received time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stats.Packets == 0 {
+		s.stats.Started = received
+	}
+	s.stats.Packets++
+
+	if s.sequenceStarted {
+		gap := sequenceNumber - s.lastSequence
+		if gap == 0 {
+			return
+		}
+		if gap <= maxSequenceGap {
+			s.stats.LostPackets += uint64(gap - 1)
+		} else if s.lastSequence-sequenceNumber <= maxSequenceGap {
+			// Late and duplicated packets must not move the sequence backwards, the
+			// following packets would be counted as lost again
+			return
+		}
+	}
+	s.lastSequence = sequenceNumber
+	s.sequenceStarted = true
+}
+
+// invalid counts a packet that has been dropped
+func (s *streamStatistics) invalid() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats.InvalidPackets++
+}
+
+// unknown counts a message of unknown type and returns true for the first message of a type
+func (s *streamStatistics) unknown(messageType uint16) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stats.UnknownMessages == nil {
+		s.stats.UnknownMessages = make(map[uint16]uint64)
+	}
+	s.stats.UnknownMessages[messageType]++
+	return s.stats.UnknownMessages[messageType] == 1
+}
+
+// frame counts a published frame
+func (s *streamStatistics) frame(frame Frame) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stats.Frames > 0 {
+		if gap := frame.Received.Sub(s.stats.LastFrame); gap > s.stats.MaxFrameGap {
+			s.stats.MaxFrameGap = gap
+		}
+	}
+	s.stats.Frames++
+	if frame.IsKeyFrame() {
+		s.stats.KeyFrames++
+	}
+	s.stats.Bytes += uint64(len(frame.Data))
+	s.stats.LastFrame = frame.Received
+
+	s.recent = append(s.recent, frameArrival{received: frame.Received, size: len(frame.Data)})
+	s.expire(frame.Received)
+}
+
+// expire removes the frames received before now - statsWindow
+func (s *streamStatistics) expire(now time.Time) {
+	expired := 0
+	for expired < len(s.recent) && now.Sub(s.recent[expired].received) > statsWindow {
+		expired++
+	}
+	s.recent = append(s.recent[:0], s.recent[expired:]...)
+}
+
+// snapshot returns a copy of the counters, the rates are calculated at the given time
+func (s *streamStatistics) snapshot(now time.Time) StreamStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expire(now)
+	stats := s.stats
+	stats.UnknownMessages = make(map[uint16]uint64, len(s.stats.UnknownMessages))
+	for messageType, count := range s.stats.UnknownMessages {
+		stats.UnknownMessages[messageType] = count
+	}
+
+	// Average over the time since the start until a full window has passed
+	window := statsWindow
+	if elapsed := now.Sub(s.stats.Started); elapsed < window {
+		window = elapsed
+	}
+	if window > 0 {
+		size := 0
+		for _, arrival := range s.recent {
+			size += arrival.size
+		}
+		stats.FrameRate = float64(len(s.recent)) / window.Seconds()
+		stats.Bitrate = float64(size*8) / window.Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,107 @@
+package libipcamera
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamStatistics(t *testing.T) {
+	start := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+	statistics := streamStatistics{}
+
+	// Packets 3 and 4 are lost, the late packet 4 does not move the sequence backwards and
+	// the restarts of the preview are not counted
+	for i, sequenceNumber := range []uint16{1, 2, 5, 5, 6, 4, 7, 60000, 60001, 0} {
+		statistics.packet(sequenceNumber, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	statistics.invalid()
+	if !statistics.unknown(0x0003) || statistics.unknown(0x0003) || !statistics.unknown(0x0010) {
+		t.Error("expected only the first message of each type to be reported")
+	}
+
+	// 4 seconds at 10 fps with one gap of 500ms
+	received := start
+	for i := 0; i < 40; i++ {
+		data := []byte{0x00, 0x00, 0x00, 0x01, 0x41, 0x9A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		if i%10 == 0 {
+			data = []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		}
+		if i == 5 {
+			received = received.Add(400 * time.Millisecond)
+		}
+		statistics.frame(Frame{Data: data, Received: received})
+		received = received.Add(100 * time.Millisecond)
+	}
+
+	stats := statistics.snapshot(received)
+	if stats.Packets != 10 || stats.LostPackets != 2 || stats.InvalidPackets != 1 || !stats.Started.Equal(start) {
+		t.Errorf("unexpected packet counters %+v", stats)
+	}
+	if stats.UnknownMessageCount() != 3 || stats.UnknownMessages[0x0003] != 2 {
+		t.Errorf("unexpected unknown messages %v", stats.UnknownMessages)
+	}
+	if stats.Frames != 40 || stats.KeyFrames != 4 || stats.Bytes != 40*16 {
+		t.Errorf("unexpected frame counters %+v", stats)
+	}
+	if stats.MaxFrameGap != 500*time.Millisecond {
+		t.Errorf("expected a maximum gap of 500ms, got %s", stats.MaxFrameGap)
+	}
+	if stats.FrameRate != 10 || stats.Bitrate != 10*16*8 {
+		t.Errorf("expected 10 fps at 1280 bit/s, got %.1f fps at %.1f bit/s", stats.FrameRate, stats.Bitrate)
+	}
+
+	// The returned map is a copy
+	stats.UnknownMessages[0x0003] = 0
+	if statistics.snapshot(received).UnknownMessages[0x0003] != 2 {
+		t.Error("modifying the returned stats changed the counters")
+	}
+
+	// Rates drop to zero when the stream stops
+	stats = statistics.snapshot(received.Add(time.Minute))
+	if stats.FrameRate != 0 || stats.Bitrate != 0 {
+		t.Errorf("expected no frames within the window, got %.1f fps", stats.FrameRate)
+	}
+}
+
+func TestStreamIngestStats(t *testing.T) {
+	ingest, err := CreateStreamIngest(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ingest.Stop()
+	frames, unsubscribe := ingest.Frames()
+	defer unsubscribe()
+
+	camera, err := net.Dial("udp", ingest.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer camera.Close()
+
+	send := func(sequenceNumber uint16, messageType uint16, payload []byte) {
+		packet := streamPacket(messageType, payload)
+		binary.BigEndian.PutUint16(packet[4:], sequenceNumber)
+		camera.Write(packet)
+	}
+	send(1, streamMessageH264, []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88})
+	send(2, 0x0007, []byte{0x01, 0x02})
+	camera.Write([]byte{0xAB, 0xCD, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	send(4, streamMessageTime, make([]byte, 16))
+
+	select {
+	case <-frames:
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+
+	stats := ingest.Stats()
+	if stats.Packets != 3 || stats.LostPackets != 1 || stats.InvalidPackets != 1 {
+		t.Errorf("unexpected packet counters %+v", stats)
+	}
+	if stats.Frames != 1 || stats.KeyFrames != 1 || stats.UnknownMessages[0x0007] != 1 {
+		t.Errorf("unexpected frame counters %+v", stats)
+	}
+}
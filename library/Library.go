@@ -0,0 +1,180 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// StateFileName is the name of the file recording the synchronization state inside a library
+const StateFileName = ".actioncam-sync.json"
+
+// undatedDirectory contains files without a capture time in their name
+const undatedDirectory = "undated"
+
+// Entry records a file that has been synchronized from the camera
+type Entry struct {
+	// Path of the file on the cameras SD-Card
+	Path string `json:"path"`
+	// Size reported by the camera
+	Size uint64 `json:"size"`
+	// LocalPath of the file relative to the library directory
+	LocalPath string `json:"localPath"`
+	// Completed is the time the download has been completed
+	Completed time.Time `json:"completed"`
+}
+
+type state struct {
+	Files map[string]Entry `json:"files"`
+}
+
+// Library is a local directory files from the cameras SD-Card are synchronized into,
+// files are organized into date-based folders using their capture time
+type Library struct {
+	dir   string
+	lock  sync.Mutex
+	state state
+	// reserved holds local paths assigned to pending files
+	reserved map[string]string
+}
+
+// Open opens (and creates if necessary) the library in dir
+func Open(dir string) (*Library, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	library := &Library{
+		dir:      dir,
+		state:    state{Files: make(map[string]Entry)},
+		reserved: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, StateFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &library.state)
+		if err != nil {
+			return nil, err
+		}
+		if library.state.Files == nil {
+			library.state.Files = make(map[string]Entry)
+		}
+	}
+	return library, nil
+}
+
+// Dir returns the directory of the library
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Entries returns all files that have been synchronized
+func (l *Library) Entries() []Entry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entries := make([]Entry, 0, len(l.state.Files))
+	for _, entry := range l.state.Files {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Pending returns all files that are new or have changed since they have been synchronized
+func (l *Library) Pending(files libipcamera.FileList) libipcamera.FileList {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return files.Filter(func(file libipcamera.StoredFile) bool {
+		entry, ok := l.state.Files[file.Path]
+		if !ok || entry.Size != file.Size {
+			return true
+		}
+		info, err := os.Stat(filepath.Join(l.dir, filepath.FromSlash(entry.LocalPath)))
+		return err != nil || uint64(info.Size()) != file.Size
+	})
+}
+
+// LocalPath returns the absolute destination of a file inside the library
+func (l *Library) LocalPath(file libipcamera.StoredFile) string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return filepath.Join(l.dir, filepath.FromSlash(l.localPath(file)))
+}
+
+// localPath returns the destination of a file relative to the library directory
+func (l *Library) localPath(file libipcamera.StoredFile) string {
+	if entry, ok := l.state.Files[file.Path]; ok {
+		return entry.LocalPath
+	}
+	if reserved, ok := l.reserved[file.Path]; ok {
+		return reserved
+	}
+
+	directory := undatedDirectory
+	if !file.CaptureTime.IsZero() {
+		directory = path.Join(file.CaptureTime.Format("2006"), file.CaptureTime.Format("2006-01-02"))
+	}
+
+	localPath := path.Join(directory, file.Name())
+	if l.isUsed(localPath) {
+		// Files with the same name in different directories on the camera (e.g. thumbnails)
+		localPath = path.Join(directory, path.Base(file.Directory)+"_"+file.Name())
+	}
+	l.reserved[file.Path] = localPath
+	return localPath
+}
+
+func (l *Library) isUsed(localPath string) bool {
+	for _, entry := range l.state.Files {
+		if entry.LocalPath == localPath {
+			return true
+		}
+	}
+	for _, reserved := range l.reserved {
+		if reserved == localPath {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkComplete records a file as synchronized and saves the state of the library
+func (l *Library) MarkComplete(file libipcamera.StoredFile) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.state.Files[file.Path] = Entry{
+		Path:      file.Path,
+		Size:      file.Size,
+		LocalPath: l.localPath(file),
+		Completed: time.Now(),
+	}
+	delete(l.reserved, file.Path)
+	return l.save()
+}
+
+// save writes the state file atomically
+func (l *Library) save() error {
+	data, err := json.MarshalIndent(l.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	statePath := filepath.Join(l.dir, StateFileName)
+	err = os.WriteFile(statePath+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(statePath+".tmp", statePath)
+}
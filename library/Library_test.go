@@ -0,0 +1,74 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+func TestLibraryPendingAndLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video := libipcamera.StoredFile{
+		Path:        "/DCIM/MOVIE/2019_0412_153001.MP4",
+		Size:        4,
+		Directory:   "/DCIM/MOVIE",
+		CaptureTime: time.Date(2019, 4, 12, 15, 30, 1, 0, time.Local),
+	}
+	thumbnail := libipcamera.StoredFile{
+		Path:        "/DCIM/THUMB/2019_0412_153001.MP4",
+		Size:        2,
+		Directory:   "/DCIM/THUMB",
+		CaptureTime: video.CaptureTime,
+	}
+	undated := libipcamera.StoredFile{
+		Path:      "/DCIM/MOVIE/FILE0001.MP4",
+		Size:      8,
+		Directory: "/DCIM/MOVIE",
+	}
+	files := libipcamera.FileList{video, thumbnail, undated}
+
+	if pending := lib.Pending(files); len(pending) != 3 {
+		t.Fatalf("expected 3 pending files, got %d", len(pending))
+	}
+
+	expected := map[string]string{
+		video.Path:     filepath.Join(dir, "2019", "2019-04-12", "2019_0412_153001.MP4"),
+		thumbnail.Path: filepath.Join(dir, "2019", "2019-04-12", "THUMB_2019_0412_153001.MP4"),
+		undated.Path:   filepath.Join(dir, "undated", "FILE0001.MP4"),
+	}
+	for _, file := range files {
+		if localPath := lib.LocalPath(file); localPath != expected[file.Path] {
+			t.Errorf("expected %s to be stored at %s, got %s", file.Path, expected[file.Path], localPath)
+		}
+	}
+
+	// Simulate a completed download of the video
+	os.MkdirAll(filepath.Dir(lib.LocalPath(video)), 0755)
+	os.WriteFile(lib.LocalPath(video), []byte("data"), 0644)
+	if err := lib.MarkComplete(video); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the library to check that the state has been persisted
+	lib, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := lib.Pending(files); len(pending) != 2 {
+		t.Errorf("expected 2 pending files, got %d", len(pending))
+	}
+
+	// A changed size marks the file as pending again
+	video.Size = 5
+	if pending := lib.Pending(libipcamera.FileList{video}); len(pending) != 1 {
+		t.Error("expected the changed file to be pending")
+	}
+}
@@ -0,0 +1,135 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidBox is returned if a box header is malformed or exceeds its parent
+var ErrInvalidBox = errors.New("Invalid MP4 box")
+
+// BoxHeader describes a box (atom) of an ISO base media file
+type BoxHeader struct {
+	Type string
+	// Offset of the box header
+	Offset int64
+	// Size of the box including its header
+	Size int64
+	// HeaderSize is the size of the box header
+	HeaderSize int64
+}
+
+// DataOffset returns the offset of the boxes content
+func (h BoxHeader) DataOffset() int64 {
+	return h.Offset + h.HeaderSize
+}
+
+// DataSize returns the size of the boxes content
+func (h BoxHeader) DataSize() int64 {
+	return h.Size - h.HeaderSize
+}
+
+// End returns the offset following the box
+func (h BoxHeader) End() int64 {
+	return h.Offset + h.Size
+}
+
+func (h BoxHeader) String() string {
+	return fmt.Sprintf("{ Box Type=%s, Offset=%d, Size=%d }", h.Type, h.Offset, h.Size)
+}
+
+// ReadBoxHeader reads the header of the box at offset, limit is the end of the enclosing box or file
+func ReadBoxHeader(r io.ReaderAt, offset, limit int64) (BoxHeader, error) {
+	buffer := make([]byte, 16)
+	if limit-offset < 8 {
+		return BoxHeader{}, ErrInvalidBox
+	}
+	_, err := r.ReadAt(buffer[:8], offset)
+	if err != nil {
+		return BoxHeader{}, err
+	}
+
+	header := BoxHeader{
+		Type:       string(buffer[4:8]),
+		Offset:     offset,
+		Size:       int64(binary.BigEndian.Uint32(buffer[:4])),
+		HeaderSize: 8,
+	}
+
+	switch header.Size {
+	case 0:
+		// The box extends to the end of the file
+		header.Size = limit - offset
+	case 1:
+		// 64 bit box size
+		if limit-offset < 16 {
+			return BoxHeader{}, ErrInvalidBox
+		}
+		_, err := r.ReadAt(buffer[8:16], offset+8)
+		if err != nil {
+			return BoxHeader{}, err
+		}
+		header.Size = int64(binary.BigEndian.Uint64(buffer[8:16]))
+		header.HeaderSize = 16
+	}
+
+	// Compared against the remaining space, Offset+Size can overflow for 64 bit sizes
+	if header.Size < header.HeaderSize || header.Size > limit-offset {
+		return BoxHeader{}, fmt.Errorf("%w: %s", ErrInvalidBox, header)
+	}
+	return header, nil
+}
+
+// ReadBoxes reads the headers of all boxes between start and end
+func ReadBoxes(r io.ReaderAt, start, end int64) ([]BoxHeader, error) {
+	boxes := make([]BoxHeader, 0)
+	for offset := start; offset < end; {
+		header, err := ReadBoxHeader(r, offset, end)
+		if err != nil {
+			return boxes, err
+		}
+		boxes = append(boxes, header)
+		offset = header.End()
+	}
+	return boxes, nil
+}
+
+// FindBox returns the first box of the given type between start and end, no box is
+// returned if any of the boxes is malformed
+func FindBox(r io.ReaderAt, start, end int64, boxType string) (BoxHeader, bool, error) {
+	boxes, err := ReadBoxes(r, start, end)
+	if err != nil {
+		return BoxHeader{}, false, err
+	}
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box, true, nil
+		}
+	}
+	return BoxHeader{}, false, nil
+}
+
+// findPath follows a path of box types starting at the children of parent
+func findPath(r io.ReaderAt, parent BoxHeader, path ...string) (BoxHeader, bool, error) {
+	current := parent
+	for _, boxType := range path {
+		box, found, err := FindBox(r, current.DataOffset(), current.End(), boxType)
+		if err != nil || !found {
+			return BoxHeader{}, false, err
+		}
+		current = box
+	}
+	return current, true, nil
+}
+
+// readBoxData reads the content of a box
+func readBoxData(r io.ReaderAt, box BoxHeader) ([]byte, error) {
+	data := make([]byte, box.DataSize())
+	n, err := r.ReadAt(data, box.DataOffset())
+	if n < len(data) {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,564 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxMovieBoxSize limits the size of the movie box that is read into memory
+const maxMovieBoxSize = 64 * 1024 * 1024
+
+// File is a parsed MP4/MOV file
+type File struct {
+	r    io.ReaderAt
+	size int64
+	// Boxes are the top-level boxes of the file
+	Boxes  []BoxHeader
+	Tracks []*Track
+
+	// Brand is the major brand of the file type box (e.g. isom, qt)
+	Brand            string
+	CompatibleBrands []string
+	CreationTime     time.Time
+	ModificationTime time.Time
+	Timescale        uint32
+	// MovieDuration in units of Timescale
+	MovieDuration uint64
+	// UserData are the boxes of the movies user data box
+	UserData []UserData
+}
+
+// Track is a single track (e.g. video or audio) of an MP4 file
+type Track struct {
+	file *File
+
+	ID uint32
+	// Handler is the media handler type (vide, soun, ...)
+	Handler string
+	// Codec is the type of the sample entry (avc1, mp4a, ...)
+	Codec     string
+	Timescale uint32
+	// Duration in units of Timescale
+	Duration uint64
+	Width    uint32
+	Height   uint32
+	// AVCConfig is the decoder configuration of H.264 tracks
+	AVCConfig *AVCDecoderConfiguration
+
+	// sampleSizes are the sizes of all samples, unless all samples have the same size
+	// constantSampleSize which is stored once
+	sampleSizes        []uint32
+	constantSampleSize uint32
+	sampleCount        int
+	chunkOffsets       []uint64
+	sampleToChunk      []sampleToChunkEntry
+	syncSamples        []uint32
+	timeToSample       []timeToSampleEntry
+}
+
+// AVCDecoderConfiguration holds the H.264 parameter sets of a track (avcC box)
+type AVCDecoderConfiguration struct {
+	Profile       uint8
+	Compatibility uint8
+	Level         uint8
+	// LengthSize is the number of Bytes used for the length prefix of NAL units in samples
+	LengthSize int
+	SPS        [][]byte
+	PPS        [][]byte
+}
+
+type sampleToChunkEntry struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+type timeToSampleEntry struct {
+	count uint32
+	delta uint32
+}
+
+// Open parses the structure of an MP4 file, only the movie box is read into memory
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	boxes, err := ReadBoxes(r, 0, size)
+	if err != nil && len(boxes) == 0 {
+		return nil, err
+	}
+
+	file := &File{
+		r:     r,
+		size:  size,
+		Boxes: boxes,
+	}
+
+	var moov *BoxHeader
+	for i := range boxes {
+		switch boxes[i].Type {
+		case "moov":
+			moov = &boxes[i]
+		case "ftyp":
+			if boxes[i].DataSize() <= 1024 {
+				data, err := readBoxData(r, boxes[i])
+				if err != nil {
+					return nil, err
+				}
+				file.parseFileType(data)
+			}
+		}
+	}
+	if moov == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("File contains no movie box")
+	}
+	if moov.Size > maxMovieBoxSize {
+		return nil, fmt.Errorf("Movie box is too large (%d Bytes)", moov.Size)
+	}
+
+	data := make([]byte, moov.Size)
+	n, err := r.ReadAt(data, moov.Offset)
+	if n < len(data) {
+		return nil, err
+	}
+
+	err = file.parseMovie(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// VideoTrack returns the first video track of the file
+func (f *File) VideoTrack() (*Track, bool) {
+	for _, track := range f.Tracks {
+		if track.Handler == "vide" {
+			return track, true
+		}
+	}
+	return nil, false
+}
+
+// parseMovie parses the movie box, moov contains the whole box including its header
+func (f *File) parseMovie(moov io.ReaderAt, size int64) error {
+	header, err := ReadBoxHeader(moov, 0, size)
+	if err != nil {
+		return err
+	}
+
+	children, err := ReadBoxes(moov, header.DataOffset(), header.End())
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		switch child.Type {
+		case "mvhd":
+			data, err := readBoxData(moov, child)
+			if err != nil {
+				return err
+			}
+			f.parseMovieHeader(data)
+		case "udta":
+			err := f.parseUserData(moov, child)
+			if err != nil {
+				return fmt.Errorf("Parsing user data: %w", err)
+			}
+		case "trak":
+			track, err := f.parseTrack(moov, child)
+			if err != nil {
+				return err
+			}
+			f.Tracks = append(f.Tracks, track)
+		}
+	}
+	return nil
+}
+
+func (f *File) parseTrack(moov io.ReaderAt, trak BoxHeader) (*Track, error) {
+	track := &Track{file: f}
+
+	tkhd, found, err := findPath(moov, trak, "tkhd")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		data, err := readBoxData(moov, tkhd)
+		if err != nil {
+			return nil, err
+		}
+		track.parseTrackHeader(data)
+	}
+
+	mdhd, found, err := findPath(moov, trak, "mdia", "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		data, err := readBoxData(moov, mdhd)
+		if err != nil {
+			return nil, err
+		}
+		track.parseMediaHeader(data)
+	}
+
+	hdlr, found, err := findPath(moov, trak, "mdia", "hdlr")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		data, err := readBoxData(moov, hdlr)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) >= 12 {
+			track.Handler = string(data[8:12])
+		}
+	}
+
+	stbl, found, err := findPath(moov, trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return track, nil
+	}
+
+	boxes, err := ReadBoxes(moov, stbl.DataOffset(), stbl.End())
+	if err != nil {
+		return nil, err
+	}
+	for _, box := range boxes {
+		data, err := readBoxData(moov, box)
+		if err != nil {
+			return nil, err
+		}
+		switch box.Type {
+		case "stsd":
+			err = track.parseSampleDescription(data)
+		case "stsz":
+			err = track.parseSampleSizes(data)
+		case "stco":
+			err = track.parseChunkOffsets(data, false)
+		case "co64":
+			err = track.parseChunkOffsets(data, true)
+		case "stsc":
+			err = track.parseSampleToChunk(data)
+		case "stss":
+			track.syncSamples, err = parseUint32Table(data, 1)
+		case "stts":
+			err = track.parseTimeToSample(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Parsing %s of track %d: %w", box.Type, track.ID, err)
+		}
+	}
+	return track, nil
+}
+
+func (t *Track) parseTrackHeader(data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	// Offsets of track_ID and width/height depend on the version (32 or 64 bit times)
+	idOffset, sizeOffset := 12, 76
+	if data[0] == 1 {
+		idOffset, sizeOffset = 20, 88
+	}
+	if len(data) >= idOffset+4 {
+		t.ID = binary.BigEndian.Uint32(data[idOffset:])
+	}
+	if len(data) >= sizeOffset+8 {
+		t.Width = binary.BigEndian.Uint32(data[sizeOffset:]) >> 16
+		t.Height = binary.BigEndian.Uint32(data[sizeOffset+4:]) >> 16
+	}
+}
+
+func (t *Track) parseMediaHeader(data []byte) {
+	if len(data) >= 32 && data[0] == 1 {
+		t.Timescale = binary.BigEndian.Uint32(data[20:])
+		t.Duration = binary.BigEndian.Uint64(data[24:])
+	} else if len(data) >= 20 {
+		t.Timescale = binary.BigEndian.Uint32(data[12:])
+		t.Duration = uint64(binary.BigEndian.Uint32(data[16:]))
+	}
+}
+
+func (t *Track) parseSampleDescription(data []byte) error {
+	if len(data) < 8 {
+		return ErrInvalidBox
+	}
+	entries := bytes.NewReader(data)
+	entry, err := ReadBoxHeader(entries, 8, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	t.Codec = entry.Type
+
+	if t.Handler != "vide" {
+		return nil
+	}
+
+	// Visual sample entries contain 78 Bytes of fixed fields before their child boxes
+	visualFields := entry.DataOffset() + 78
+	if visualFields > entry.End() {
+		return ErrInvalidBox
+	}
+	if t.Width == 0 || t.Height == 0 {
+		t.Width = uint32(binary.BigEndian.Uint16(data[entry.DataOffset()+24:]))
+		t.Height = uint32(binary.BigEndian.Uint16(data[entry.DataOffset()+26:]))
+	}
+
+	avcC, found, _ := FindBox(entries, visualFields, entry.End(), "avcC")
+	if !found {
+		return nil
+	}
+	config, err := ParseAVCDecoderConfiguration(data[avcC.DataOffset():avcC.End()])
+	if err != nil {
+		return err
+	}
+	t.AVCConfig = config
+	return nil
+}
+
+// ParseAVCDecoderConfiguration parses the content of an avcC box
+func ParseAVCDecoderConfiguration(data []byte) (*AVCDecoderConfiguration, error) {
+	if len(data) < 6 {
+		return nil, ErrInvalidBox
+	}
+	config := &AVCDecoderConfiguration{
+		Profile:       data[1],
+		Compatibility: data[2],
+		Level:         data[3],
+		LengthSize:    int(data[4]&0x03) + 1,
+	}
+
+	offset := 6
+	readParameterSets := func(count int) ([][]byte, error) {
+		sets := make([][]byte, 0, count)
+		for i := 0; i < count; i++ {
+			if offset+2 > len(data) {
+				return nil, ErrInvalidBox
+			}
+			length := int(binary.BigEndian.Uint16(data[offset:]))
+			offset += 2
+			if offset+length > len(data) {
+				return nil, ErrInvalidBox
+			}
+			sets = append(sets, data[offset:offset+length])
+			offset += length
+		}
+		return sets, nil
+	}
+
+	var err error
+	config.SPS, err = readParameterSets(int(data[5] & 0x1F))
+	if err != nil {
+		return nil, err
+	}
+	if offset >= len(data) {
+		return nil, ErrInvalidBox
+	}
+	numPPS := int(data[offset])
+	offset++
+	config.PPS, err = readParameterSets(numPPS)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (t *Track) parseSampleSizes(data []byte) error {
+	if len(data) < 12 {
+		return ErrInvalidBox
+	}
+	sampleSize := binary.BigEndian.Uint32(data[4:])
+	count := binary.BigEndian.Uint32(data[8:])
+	if sampleSize != 0 {
+		// All samples have to fit into the file
+		if uint64(count)*uint64(sampleSize) > uint64(t.file.size) {
+			return ErrInvalidBox
+		}
+		t.constantSampleSize = sampleSize
+		t.sampleCount = int(count)
+		return nil
+	}
+	if uint64(len(data)) < 12+uint64(count)*4 {
+		return ErrInvalidBox
+	}
+	t.sampleCount = int(count)
+	t.sampleSizes = make([]uint32, count)
+	for i := range t.sampleSizes {
+		t.sampleSizes[i] = binary.BigEndian.Uint32(data[12+i*4:])
+	}
+	return nil
+}
+
+func (t *Track) parseChunkOffsets(data []byte, wide bool) error {
+	if !wide {
+		offsets, err := parseUint32Table(data, 1)
+		if err != nil {
+			return err
+		}
+		t.chunkOffsets = make([]uint64, len(offsets))
+		for i, offset := range offsets {
+			t.chunkOffsets[i] = uint64(offset)
+		}
+		return nil
+	}
+
+	if len(data) < 8 {
+		return ErrInvalidBox
+	}
+	count := binary.BigEndian.Uint32(data[4:])
+	if uint64(len(data)) < 8+uint64(count)*8 {
+		return ErrInvalidBox
+	}
+	t.chunkOffsets = make([]uint64, count)
+	for i := range t.chunkOffsets {
+		t.chunkOffsets[i] = binary.BigEndian.Uint64(data[8+i*8:])
+	}
+	return nil
+}
+
+func (t *Track) parseSampleToChunk(data []byte) error {
+	values, err := parseUint32Table(data, 3)
+	if err != nil {
+		return err
+	}
+	t.sampleToChunk = make([]sampleToChunkEntry, len(values)/3)
+	for i := range t.sampleToChunk {
+		t.sampleToChunk[i] = sampleToChunkEntry{
+			firstChunk:      values[i*3],
+			samplesPerChunk: values[i*3+1],
+		}
+	}
+	return nil
+}
+
+func (t *Track) parseTimeToSample(data []byte) error {
+	values, err := parseUint32Table(data, 2)
+	if err != nil {
+		return err
+	}
+	t.timeToSample = make([]timeToSampleEntry, len(values)/2)
+	for i := range t.timeToSample {
+		t.timeToSample[i] = timeToSampleEntry{
+			count: values[i*2],
+			delta: values[i*2+1],
+		}
+	}
+	return nil
+}
+
+// parseUint32Table parses a full box containing an entry count followed by entries of fields 32 bit values
+func parseUint32Table(data []byte, fields int) ([]uint32, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidBox
+	}
+	count := uint64(binary.BigEndian.Uint32(data[4:])) * uint64(fields)
+	if uint64(len(data)) < 8+count*4 {
+		return nil, ErrInvalidBox
+	}
+	values := make([]uint32, count)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint32(data[8+i*4:])
+	}
+	return values, nil
+}
+
+// SampleCount returns the number of samples in the track
+func (t *Track) SampleCount() int {
+	return t.sampleCount
+}
+
+// sampleSize returns the size of a sample (starting at 0), sample has to be in range
+func (t *Track) sampleSize(sample int) uint32 {
+	if t.constantSampleSize != 0 {
+		return t.constantSampleSize
+	}
+	return t.sampleSizes[sample]
+}
+
+// IsSyncSample returns true if the sample (starting at 0) is a sync sample (key frame)
+func (t *Track) IsSyncSample(sample int) bool {
+	if t.syncSamples == nil {
+		// Without a sync sample table every sample is a sync sample
+		return true
+	}
+	for _, syncSample := range t.syncSamples {
+		if int(syncSample)-1 == sample {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstSyncSample returns the index of the first sync sample of the track
+func (t *Track) FirstSyncSample() (int, bool) {
+	if t.SampleCount() == 0 {
+		return 0, false
+	}
+	if t.syncSamples == nil {
+		return 0, true
+	}
+	if len(t.syncSamples) == 0 || t.syncSamples[0] == 0 {
+		return 0, false
+	}
+	return int(t.syncSamples[0]) - 1, true
+}
+
+// SampleLocation returns the file offset and size of a sample (starting at 0)
+func (t *Track) SampleLocation(sample int) (int64, uint32, error) {
+	if sample < 0 || sample >= t.sampleCount {
+		return 0, 0, fmt.Errorf("Sample %d out of range", sample)
+	}
+
+	first := 0
+	for i, entry := range t.sampleToChunk {
+		lastChunk := uint32(len(t.chunkOffsets))
+		if i+1 < len(t.sampleToChunk) {
+			lastChunk = t.sampleToChunk[i+1].firstChunk - 1
+		}
+		if entry.firstChunk == 0 || lastChunk < entry.firstChunk || entry.samplesPerChunk == 0 {
+			return 0, 0, ErrInvalidBox
+		}
+
+		chunks := int(lastChunk - entry.firstChunk + 1)
+		samples := chunks * int(entry.samplesPerChunk)
+		if sample >= first+samples {
+			first += samples
+			continue
+		}
+
+		chunk := int(entry.firstChunk) - 1 + (sample-first)/int(entry.samplesPerChunk)
+		if chunk >= len(t.chunkOffsets) {
+			return 0, 0, ErrInvalidBox
+		}
+		firstInChunk := sample - (sample-first)%int(entry.samplesPerChunk)
+
+		offset := t.chunkOffsets[chunk]
+		for i := firstInChunk; i < sample; i++ {
+			offset += uint64(t.sampleSize(i))
+		}
+		return int64(offset), t.sampleSize(sample), nil
+	}
+	return 0, 0, fmt.Errorf("Sample %d is not mapped to a chunk", sample)
+}
+
+// ReadSample reads the data of a sample (starting at 0)
+func (t *Track) ReadSample(sample int) ([]byte, error) {
+	offset, size, err := t.SampleLocation(sample)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	n, err := t.file.r.ReadAt(data, offset)
+	if n < len(data) {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,142 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+var (
+	testSPS = []byte{0x67, 0x64, 0x00, 0x1F, 0xAC, 0xD9, 0x40, 0x50, 0x05, 0xBB, 0x01, 0x10}
+	testPPS = []byte{0x68, 0xEB, 0xE3, 0xCB, 0x22, 0xC0}
+)
+
+func TestWriteStillRoundTrip(t *testing.T) {
+	sample := []byte{0x00, 0x00, 0x00, 0x05, 0x65, 0x88, 0x84, 0x00, 0x33}
+	config := NewAVCDecoderConfiguration(testSPS, testPPS)
+
+	buffer := bytes.Buffer{}
+	err := WriteStill(&buffer, config, 1280, 720, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, found := file.VideoTrack()
+	if !found {
+		t.Fatal("no video track found")
+	}
+	if track.Codec != "avc1" || track.Width != 1280 || track.Height != 720 || track.Timescale != VideoTimescale {
+		t.Errorf("unexpected track parameters: %+v", track)
+	}
+	if track.AVCConfig == nil || !bytes.Equal(track.AVCConfig.SPS[0], testSPS) || !bytes.Equal(track.AVCConfig.PPS[0], testPPS) {
+		t.Errorf("unexpected decoder configuration: %+v", track.AVCConfig)
+	}
+	if track.AVCConfig.Profile != 0x64 || track.AVCConfig.Level != 0x1F || track.AVCConfig.LengthSize != 4 {
+		t.Errorf("unexpected profile information: %+v", track.AVCConfig)
+	}
+
+	syncSample, found := track.FirstSyncSample()
+	if !found || syncSample != 0 {
+		t.Fatalf("expected sample 0 to be the first sync sample, got %d", syncSample)
+	}
+	data, err := track.ReadSample(syncSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, sample) {
+		t.Errorf("expected sample %X, got %X", sample, data)
+	}
+}
+
+func TestSampleLocation(t *testing.T) {
+	track := &Track{
+		sampleSizes:  []uint32{10, 20, 30, 40, 50},
+		sampleCount:  5,
+		chunkOffsets: []uint64{1000, 2000, 3000},
+		sampleToChunk: []sampleToChunkEntry{
+			{firstChunk: 1, samplesPerChunk: 2},
+			{firstChunk: 3, samplesPerChunk: 1},
+		},
+	}
+
+	expected := []struct {
+		offset int64
+		size   uint32
+	}{
+		{1000, 10}, {1010, 20}, {2000, 30}, {2030, 40}, {3000, 50},
+	}
+	for i, location := range expected {
+		offset, size, err := track.SampleLocation(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != location.offset || size != location.size {
+			t.Errorf("sample %d: expected %d/%d, got %d/%d", i, location.offset, location.size, offset, size)
+		}
+	}
+}
+
+func TestParseSampleSizes(t *testing.T) {
+	stsz := func(sampleSize, count uint32, sizes ...uint32) []byte {
+		data := make([]byte, 12+4*len(sizes))
+		binary.BigEndian.PutUint32(data[4:], sampleSize)
+		binary.BigEndian.PutUint32(data[8:], count)
+		for i, size := range sizes {
+			binary.BigEndian.PutUint32(data[12+4*i:], size)
+		}
+		return data
+	}
+	file := &File{size: 100000}
+
+	// A constant size is not expanded into a table
+	track := &Track{file: file}
+	if err := track.parseSampleSizes(stsz(1000, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if track.SampleCount() != 100 || track.sampleSizes != nil || track.sampleSize(99) != 1000 {
+		t.Errorf("unexpected sample sizes: %d samples", track.SampleCount())
+	}
+
+	for name, data := range map[string][]byte{
+		"samples exceeding the file": stsz(1000, 0xFFFFFFFF),
+		"truncated table":            stsz(0, 0xFFFFFFFF, 10, 20),
+		"truncated box":              stsz(0, 0)[:8],
+	} {
+		track := &Track{file: file}
+		if err := track.parseSampleSizes(data); err != ErrInvalidBox {
+			t.Errorf("%s: expected ErrInvalidBox, got %v", name, err)
+		}
+	}
+
+	track = &Track{file: file}
+	if err := track.parseSampleSizes(stsz(0, 2, 10, 20)); err != nil || track.SampleCount() != 2 || track.sampleSize(1) != 20 {
+		t.Errorf("unexpected sample sizes %v (%v)", track.sampleSizes, err)
+	}
+}
+
+func TestOpenMalformedBoxes(t *testing.T) {
+	// 64 bit size close to the maximum, Offset+Size overflows
+	oversized := make([]byte, 16)
+	binary.BigEndian.PutUint32(oversized, 1)
+	copy(oversized[4:], "tkhd")
+	binary.BigEndian.PutUint64(oversized[8:], 0x7FFFFFFFFFFFFFFC)
+
+	// Size exceeding the enclosing box
+	truncated := make([]byte, 20)
+	binary.BigEndian.PutUint32(truncated, 100)
+	copy(truncated[4:], "tkhd")
+
+	for name, tkhd := range map[string][]byte{"oversized": oversized, "truncated": truncated} {
+		data := box("moov", box("trak", tkhd))
+		_, err := Open(bytes.NewReader(data), int64(len(data)))
+		if !errors.Is(err, ErrInvalidBox) {
+			t.Errorf("%s: expected ErrInvalidBox, got %v", name, err)
+		}
+	}
+}
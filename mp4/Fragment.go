@@ -0,0 +1,197 @@
+package mp4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Sample flags of movie fragments (ISO/IEC 14496-12 8.8.3.1)
+const (
+	// syncSampleFlags marks a sample that does not depend on others
+	syncSampleFlags = 0x02000000
+	// nonSyncSampleFlags marks a sample that depends on others and is not a sync sample
+	nonSyncSampleFlags = 0x01010000
+)
+
+// maxFragmentDuration limits the length of a fragment if the stream contains no sync samples
+const maxFragmentDuration = 10 * VideoTimescale
+
+// ErrWriterClosed is returned when writing to a closed FragmentedWriter
+var ErrWriterClosed = errors.New("Writer has been closed")
+
+// Sample is an H.264 access unit written to a movie fragment
+type Sample struct {
+	// Data contains the NAL units of the access unit prefixed by their 4 Byte length
+	Data []byte
+	// DecodeTime in units of VideoTimescale
+	DecodeTime uint64
+	// Duration in units of VideoTimescale
+	Duration uint32
+	// Sync is true for samples that start a GOP (IDR frames)
+	Sync bool
+}
+
+// SampleFromNALUnits creates the data of a sample from NAL units without start codes
+func SampleFromNALUnits(nalUnits ...[]byte) []byte {
+	size := 0
+	for _, nal := range nalUnits {
+		size += 4 + len(nal)
+	}
+	data := make([]byte, 0, size)
+	for _, nal := range nalUnits {
+		data = append(data, u32(uint32(len(nal)))...)
+		data = append(data, nal...)
+	}
+	return data
+}
+
+// InitSegment returns the ftyp and moov boxes of a fragmented MP4 file containing a
+// single H.264 track, the samples follow in movie fragments
+func InitSegment(config *AVCDecoderConfiguration, width, height uint16) []byte {
+	ftyp := fileType("iso5", "iso5", "iso6", "avc1", "mp41")
+	moov := box("moov",
+		movieHeader(1000, 0, 2),
+		box("trak",
+			trackHeader(1, 0, width, height),
+			box("mdia",
+				mediaHeader(VideoTimescale, 0),
+				videoHandler(),
+				box("minf",
+					fullBox("vmhd", 0, 0x000001, zeros(8)),
+					dataInformation(),
+					box("stbl",
+						sampleDescription(config, width, height),
+						fullBox("stts", 0, 0, u32(0)),
+						fullBox("stsc", 0, 0, u32(0)),
+						fullBox("stsz", 0, 0, u32(0), u32(0)),
+						fullBox("stco", 0, 0, u32(0)),
+					),
+				),
+			),
+		),
+		box("mvex",
+			fullBox("trex", 0, 0,
+				u32(1), // track ID
+				u32(1), // default sample description index
+				u32(0), // default sample duration
+				u32(0), // default sample size
+				u32(0), // default sample flags
+			),
+		),
+	)
+	return append(ftyp, moov...)
+}
+
+// Fragment returns a movie fragment (moof and mdat) containing the samples of track 1,
+// the samples are presented in decoding order
+func Fragment(sequenceNumber uint32, samples []Sample) []byte {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	data := bytes.Buffer{}
+	for _, sample := range samples {
+		data.Write(sample.Data)
+	}
+
+	buildFragment := func(dataOffset uint32) []byte {
+		entries := make([][]byte, 0, 2+3*len(samples))
+		entries = append(entries, u32(uint32(len(samples))), u32(dataOffset))
+		for _, sample := range samples {
+			flags := uint32(nonSyncSampleFlags)
+			if sample.Sync {
+				flags = syncSampleFlags
+			}
+			entries = append(entries, u32(sample.Duration), u32(uint32(len(sample.Data))), u32(flags))
+		}
+
+		return box("moof",
+			fullBox("mfhd", 0, 0, u32(sequenceNumber)),
+			box("traf",
+				fullBox("tfhd", 0, 0x020000, u32(1)), // default-base-is-moof
+				fullBox("tfdt", 1, 0, u64(samples[0].DecodeTime)),
+				// data-offset, sample-duration, sample-size and sample-flags present
+				fullBox("trun", 0, 0x000701, entries...),
+			),
+		)
+	}
+
+	// The size of the fragment does not depend on the data offset
+	moofSize := len(buildFragment(0))
+	moof := buildFragment(uint32(moofSize + 8))
+	return append(moof, box("mdat", data.Bytes())...)
+}
+
+// FragmentedWriter writes an H.264 stream as fragmented MP4, every fragment is playable
+// once written so a recording that is interrupted only loses the current fragment
+type FragmentedWriter struct {
+	w              io.Writer
+	sequenceNumber uint32
+	samples        []Sample
+	// lastDuration is the duration of the last sample with a known successor
+	lastDuration uint32
+	closed       bool
+}
+
+// NewFragmentedWriter writes the init segment to w and returns a writer for the samples of the stream
+func NewFragmentedWriter(w io.Writer, config *AVCDecoderConfiguration, width, height uint16) (*FragmentedWriter, error) {
+	_, err := w.Write(InitSegment(config, width, height))
+	if err != nil {
+		return nil, err
+	}
+	return &FragmentedWriter{w: w}, nil
+}
+
+// WriteSample adds a sample to the current fragment, the duration of a sample is derived from the
+// decode time of the next one. A new fragment is started with every sync sample.
+func (f *FragmentedWriter) WriteSample(data []byte, decodeTime uint64, sync bool) error {
+	if f.closed {
+		return ErrWriterClosed
+	}
+
+	if len(f.samples) > 0 {
+		last := &f.samples[len(f.samples)-1]
+		if decodeTime > last.DecodeTime {
+			last.Duration = uint32(decodeTime - last.DecodeTime)
+			f.lastDuration = last.Duration
+		}
+		if sync || decodeTime >= f.samples[0].DecodeTime+maxFragmentDuration {
+			err := f.Flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	f.samples = append(f.samples, Sample{Data: data, DecodeTime: decodeTime, Sync: sync})
+	return nil
+}
+
+// Flush writes the buffered samples as a fragment, if the duration of the last sample is
+// not yet known it is assumed to be the same as the one of its predecessor
+func (f *FragmentedWriter) Flush() error {
+	if len(f.samples) == 0 {
+		return nil
+	}
+
+	last := &f.samples[len(f.samples)-1]
+	if last.Duration == 0 {
+		last.Duration = f.lastDuration
+	}
+
+	f.sequenceNumber++
+	_, err := f.w.Write(Fragment(f.sequenceNumber, f.samples))
+	f.samples = f.samples[:0]
+	return err
+}
+
+// Close writes the remaining samples, it does not close the underlying writer
+func (f *FragmentedWriter) Close() error {
+	if f.closed {
+		return nil
+	}
+	err := f.Flush()
+	f.closed = true
+	return err
+}
@@ -0,0 +1,80 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestFragmentedWriter(t *testing.T) {
+	buffer := bytes.Buffer{}
+	writer, err := NewFragmentedWriter(&buffer, NewAVCDecoderConfiguration(testSPS, testPPS), 1280, 720)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idr := SampleFromNALUnits([]byte{0x65, 0x88, 0x84})
+	slice := SampleFromNALUnits([]byte{0x41, 0x9A}, []byte{0x41, 0x9B})
+	if !bytes.Equal(slice, []byte{0, 0, 0, 2, 0x41, 0x9A, 0, 0, 0, 2, 0x41, 0x9B}) {
+		t.Errorf("unexpected sample data %X", slice)
+	}
+
+	for _, sample := range []Sample{{idr, 0, 0, true}, {slice, 3000, 0, false}, {idr, 6003, 0, true}} {
+		err := writer.WriteSample(sample.Data, sample.DecodeTime, sample.Sync)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	if err := writer.WriteSample(slice, 9000, false); err != ErrWriterClosed {
+		t.Errorf("expected ErrWriterClosed, got %v", err)
+	}
+
+	data := buffer.Bytes()
+	file, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, found := file.VideoTrack()
+	if !found || track.Codec != "avc1" || track.Width != 1280 || track.Height != 720 || track.AVCConfig == nil {
+		t.Fatalf("unexpected track %+v", track)
+	}
+
+	types := make([]string, len(file.Boxes))
+	for i, box := range file.Boxes {
+		types[i] = box.Type
+	}
+	if got := fmt.Sprint(types); got != "[ftyp moov moof mdat moof mdat]" {
+		t.Fatalf("unexpected boxes %s", got)
+	}
+
+	// The first fragment contains the first GOP
+	moof := file.Boxes[2]
+	trun, found, _ := findPath(bytes.NewReader(data), moof, "traf", "trun")
+	if !found {
+		t.Fatal("no trun box in fragment")
+	}
+	run := data[trun.DataOffset():trun.End()]
+	count, offset := binary.BigEndian.Uint32(run[4:]), binary.BigEndian.Uint32(run[8:])
+	if count != 2 {
+		t.Fatalf("expected 2 samples, got %d", count)
+	}
+	if !bytes.Equal(data[moof.Offset+int64(offset):][:len(idr)], idr) {
+		t.Error("data offset does not point to the first sample")
+	}
+	durations := []uint32{binary.BigEndian.Uint32(run[12:]), binary.BigEndian.Uint32(run[24:])}
+	flags := []uint32{binary.BigEndian.Uint32(run[20:]), binary.BigEndian.Uint32(run[32:])}
+	if durations[0] != 3000 || durations[1] != 3003 {
+		t.Errorf("unexpected sample durations %v", durations)
+	}
+	if flags[0] != syncSampleFlags || flags[1] != nonSyncSampleFlags {
+		t.Errorf("unexpected sample flags %08X", flags)
+	}
+
+	// The duration of the last sample is taken from its predecessor
+	trun, _, _ = findPath(bytes.NewReader(data), file.Boxes[4], "traf", "trun")
+	if duration := binary.BigEndian.Uint32(data[trun.DataOffset()+12:]); duration != 3003 {
+		t.Errorf("expected the last sample to last 3003, got %d", duration)
+	}
+}
@@ -0,0 +1,202 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// mp4Epoch is the reference of creation and modification times in MP4 files
+var mp4Epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// maxUserDataSize limits the size of user data boxes that are kept in memory
+const maxUserDataSize = 64 * 1024
+
+// UserData is a box of the user data (udta) box, cameras use these to store vendor specific information
+type UserData struct {
+	// Type of the box, the copyright sign of QuickTime text boxes (e.g. ©xyz) is decoded
+	Type string
+	Size int64
+	Data []byte
+}
+
+// Text returns the content of a QuickTime text box or printable data
+func (u UserData) Text() (string, bool) {
+	data := u.Data
+	if len(u.Type) > 0 && []rune(u.Type)[0] == '©' && len(data) >= 4 {
+		// QuickTime text boxes start with the length of the text and a language code
+		length := int(binary.BigEndian.Uint16(data))
+		if 4+length <= len(data) {
+			data = data[4 : 4+length]
+		}
+	}
+
+	for len(data) > 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	if len(data) == 0 || !utf8.Valid(data) {
+		return "", false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\t' && r != '\n' {
+			return "", false
+		}
+	}
+	return string(data), true
+}
+
+// Location is a position stored in the file
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	// Altitude in meters, it is only valid if HasAltitude is true
+	Altitude    float64
+	HasAltitude bool
+}
+
+func (l Location) String() string {
+	if l.HasAltitude {
+		return fmt.Sprintf("%.6f, %.6f (%.1f m)", l.Latitude, l.Longitude, l.Altitude)
+	}
+	return fmt.Sprintf("%.6f, %.6f", l.Latitude, l.Longitude)
+}
+
+// iso6709 matches locations in decimal degrees as stored in ©xyz boxes (e.g. +48.1371+011.5754+519.000/)
+var iso6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+// ParseLocation parses a location in ISO 6709 notation
+func ParseLocation(value string) (Location, bool) {
+	matches := iso6709.FindStringSubmatch(value)
+	if matches == nil {
+		return Location{}, false
+	}
+	location := Location{}
+	location.Latitude, _ = strconv.ParseFloat(matches[1], 64)
+	location.Longitude, _ = strconv.ParseFloat(matches[2], 64)
+	if matches[3] != "" {
+		location.Altitude, _ = strconv.ParseFloat(matches[3], 64)
+		location.HasAltitude = true
+	}
+	return location, true
+}
+
+// Location returns the position stored in the ©xyz user data box
+func (f *File) Location() (Location, bool) {
+	for _, userData := range f.UserData {
+		if userData.Type != "©xyz" {
+			continue
+		}
+		if text, ok := userData.Text(); ok {
+			return ParseLocation(text)
+		}
+	}
+	return Location{}, false
+}
+
+// Duration returns the duration of the movie
+func (f *File) Duration() time.Duration {
+	return scaledDuration(f.MovieDuration, f.Timescale)
+}
+
+// MediaDuration returns the duration of the track
+func (t *Track) MediaDuration() time.Duration {
+	return scaledDuration(t.Duration, t.Timescale)
+}
+
+// FrameRate returns the average number of samples per second of the track
+func (t *Track) FrameRate() float64 {
+	if t.Duration == 0 || t.Timescale == 0 {
+		return 0
+	}
+	return float64(t.SampleCount()) * float64(t.Timescale) / float64(t.Duration)
+}
+
+func scaledDuration(duration uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	seconds := duration / uint64(timescale)
+	remainder := duration % uint64(timescale)
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(timescale)
+}
+
+// mp4Time converts a time in seconds since 1904, zero times are returned as zero time.Time
+func mp4Time(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return mp4Epoch.Add(time.Duration(seconds) * time.Second)
+}
+
+func (f *File) parseMovieHeader(data []byte) {
+	if len(data) >= 32 && data[0] == 1 {
+		f.CreationTime = mp4Time(binary.BigEndian.Uint64(data[4:]))
+		f.ModificationTime = mp4Time(binary.BigEndian.Uint64(data[12:]))
+		f.Timescale = binary.BigEndian.Uint32(data[20:])
+		f.MovieDuration = binary.BigEndian.Uint64(data[24:])
+	} else if len(data) >= 20 {
+		f.CreationTime = mp4Time(uint64(binary.BigEndian.Uint32(data[4:])))
+		f.ModificationTime = mp4Time(uint64(binary.BigEndian.Uint32(data[8:])))
+		f.Timescale = binary.BigEndian.Uint32(data[12:])
+		f.MovieDuration = uint64(binary.BigEndian.Uint32(data[16:]))
+	}
+}
+
+// parseUserData reads the boxes contained in an udta box, malformed trailing data (e.g. the
+// terminating zero word written by some QuickTime muxers) is ignored
+func (f *File) parseUserData(moov io.ReaderAt, udta BoxHeader) error {
+	boxes, _ := ReadBoxes(moov, udta.DataOffset(), udta.End())
+	for _, box := range boxes {
+		var err error
+		userData := UserData{Type: box.Type, Size: box.Size}
+		if box.Type[0] == 0xA9 {
+			userData.Type = "©" + box.Type[1:]
+		}
+		if box.DataSize() <= maxUserDataSize {
+			userData.Data, err = readBoxData(moov, box)
+			if err != nil {
+				return err
+			}
+		}
+		f.UserData = append(f.UserData, userData)
+	}
+	return nil
+}
+
+func (f *File) parseFileType(data []byte) {
+	if len(data) < 8 {
+		return
+	}
+	f.Brand = string(data[:4])
+	for offset := 8; offset+4 <= len(data); offset += 4 {
+		f.CompatibleBrands = append(f.CompatibleBrands, string(data[offset:offset+4]))
+	}
+}
+
+// avcProfiles are the names of the H.264 profiles identified by profile_idc
+var avcProfiles = map[uint8]string{
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4 Predictive",
+}
+
+// ProfileName returns the name of the H.264 profile and level (e.g. High@4.1)
+func (c *AVCDecoderConfiguration) ProfileName() string {
+	name, known := avcProfiles[c.Profile]
+	if !known {
+		name = fmt.Sprintf("Profile %d", c.Profile)
+	}
+	// Constraint set 1 marks Constrained Baseline streams
+	if c.Profile == 66 && c.Compatibility&0x40 != 0 {
+		name = "Constrained Baseline"
+	}
+	return fmt.Sprintf("%s@%d.%d", name, c.Level/10, c.Level%10)
+}
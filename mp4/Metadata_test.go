@@ -0,0 +1,82 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMovieMetadata(t *testing.T) {
+	created := time.Date(2019, 4, 12, 15, 30, 1, 0, time.UTC)
+	location := "+48.1371+011.5754+519.000/"
+
+	movie := bytes.Buffer{}
+	movie.Write(fileType("qt  ", "qt  "))
+	movie.Write(box("moov",
+		fullBox("mvhd", 0, 0,
+			u32(uint32(created.Sub(mp4Epoch)/time.Second)), u32(0),
+			u32(1000),
+			u32(61500),
+			u32(0x00010000), u16(0x0100), zeros(10), matrix(), zeros(24), u32(1),
+		),
+		box("udta",
+			box("\xA9xyz", u16(uint16(len(location))), u16(0x15C7), []byte(location)),
+			box("\xA9mak", u16(5), u16(0x15C7), []byte("AKASO")),
+			box("AMBA", []byte{0x01, 0x02, 0x03}),
+			zeros(4),
+		),
+	))
+
+	file, err := Open(bytes.NewReader(movie.Bytes()), int64(movie.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Brand != "qt  " {
+		t.Errorf("expected brand qt, got %q", file.Brand)
+	}
+	if !file.CreationTime.Equal(created) {
+		t.Errorf("expected creation time %s, got %s", created, file.CreationTime)
+	}
+	if file.Duration() != 61500*time.Millisecond {
+		t.Errorf("expected duration 1m1.5s, got %s", file.Duration())
+	}
+
+	if len(file.UserData) != 3 {
+		t.Fatalf("expected 3 user data boxes, got %+v", file.UserData)
+	}
+	if text, ok := file.UserData[1].Text(); file.UserData[1].Type != "©mak" || !ok || text != "AKASO" {
+		t.Errorf("unexpected text box %s: %q", file.UserData[1].Type, text)
+	}
+	if _, ok := file.UserData[2].Text(); ok || file.UserData[2].Type != "AMBA" {
+		t.Errorf("expected binary vendor box, got %+v", file.UserData[2])
+	}
+
+	position, found := file.Location()
+	if !found || position.Latitude != 48.1371 || position.Longitude != 11.5754 || !position.HasAltitude || position.Altitude != 519 {
+		t.Errorf("unexpected location %+v", position)
+	}
+}
+
+func TestTrackMetadata(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := WriteStill(&buffer, NewAVCDecoderConfiguration(testSPS, testPPS), 1280, 720, []byte{0, 0, 0, 1, 0x65})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := Open(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, _ := file.VideoTrack()
+
+	if track.FrameRate() != 30 {
+		t.Errorf("expected 30 frames per second, got %f", track.FrameRate())
+	}
+	if track.AVCConfig.ProfileName() != "High@3.1" {
+		t.Errorf("expected High@3.1, got %s", track.AVCConfig.ProfileName())
+	}
+	if !file.CreationTime.IsZero() {
+		t.Errorf("expected no creation time, got %s", file.CreationTime)
+	}
+}
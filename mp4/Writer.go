@@ -0,0 +1,232 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// VideoTimescale is the timescale used for video tracks written by this package
+const VideoTimescale = 90000
+
+// box serializes a box with the given content
+func box(boxType string, content ...[]byte) []byte {
+	size := 8
+	for _, part := range content {
+		size += len(part)
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, size))
+	binary.Write(buffer, binary.BigEndian, uint32(size))
+	buffer.WriteString(boxType)
+	for _, part := range content {
+		buffer.Write(part)
+	}
+	return buffer.Bytes()
+}
+
+// fullBox serializes a box with a version and flags field
+func fullBox(boxType string, version uint8, flags uint32, content ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags&0x00FFFFFF)
+	return box(boxType, append([][]byte{header}, content...)...)
+}
+
+func u8(value uint8) []byte {
+	return []byte{value}
+}
+
+func u16(value uint16) []byte {
+	buffer := make([]byte, 2)
+	binary.BigEndian.PutUint16(buffer, value)
+	return buffer
+}
+
+func u32(value uint32) []byte {
+	buffer := make([]byte, 4)
+	binary.BigEndian.PutUint32(buffer, value)
+	return buffer
+}
+
+func u64(value uint64) []byte {
+	buffer := make([]byte, 8)
+	binary.BigEndian.PutUint64(buffer, value)
+	return buffer
+}
+
+func zeros(count int) []byte {
+	return make([]byte, count)
+}
+
+// unityMatrix is the identity transformation matrix used in movie and track headers
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func matrix() []byte {
+	buffer := make([]byte, 0, 36)
+	for _, value := range unityMatrix {
+		buffer = append(buffer, u32(value)...)
+	}
+	return buffer
+}
+
+func fileType(major string, compatible ...string) []byte {
+	content := [][]byte{[]byte(major), u32(0x200)}
+	for _, brand := range compatible {
+		content = append(content, []byte(brand))
+	}
+	return box("ftyp", content...)
+}
+
+func movieHeader(timescale uint32, duration uint32, nextTrackID uint32) []byte {
+	return fullBox("mvhd", 0, 0,
+		u32(0), u32(0), // creation and modification time
+		u32(timescale),
+		u32(duration),
+		u32(0x00010000), // rate 1.0
+		u16(0x0100),     // volume 1.0
+		zeros(10),
+		matrix(),
+		zeros(24),
+		u32(nextTrackID),
+	)
+}
+
+func trackHeader(trackID uint32, duration uint32, width, height uint16) []byte {
+	return fullBox("tkhd", 0, 0x000003, // track enabled and in movie
+		u32(0), u32(0), // creation and modification time
+		u32(trackID),
+		zeros(4),
+		u32(duration),
+		zeros(8),
+		u16(0), u16(0), // layer and alternate group
+		u16(0), // volume
+		zeros(2),
+		matrix(),
+		u32(uint32(width)<<16),
+		u32(uint32(height)<<16),
+	)
+}
+
+func mediaHeader(timescale uint32, duration uint32) []byte {
+	return fullBox("mdhd", 0, 0,
+		u32(0), u32(0), // creation and modification time
+		u32(timescale),
+		u32(duration),
+		u16(0x55C4), // language "und"
+		u16(0),
+	)
+}
+
+func videoHandler() []byte {
+	return fullBox("hdlr", 0, 0,
+		u32(0),
+		[]byte("vide"),
+		zeros(12),
+		[]byte("VideoHandler\x00"),
+	)
+}
+
+func dataInformation() []byte {
+	return box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 0x000001)))
+}
+
+// avcConfigurationBox serializes an avcC box
+func avcConfigurationBox(config *AVCDecoderConfiguration) []byte {
+	content := bytes.Buffer{}
+	content.Write([]byte{1, config.Profile, config.Compatibility, config.Level})
+	content.WriteByte(0xFC | byte(config.LengthSize-1))
+	content.WriteByte(0xE0 | byte(len(config.SPS)))
+	for _, sps := range config.SPS {
+		content.Write(u16(uint16(len(sps))))
+		content.Write(sps)
+	}
+	content.WriteByte(byte(len(config.PPS)))
+	for _, pps := range config.PPS {
+		content.Write(u16(uint16(len(pps))))
+		content.Write(pps)
+	}
+	return box("avcC", content.Bytes())
+}
+
+func avcSampleEntry(config *AVCDecoderConfiguration, width, height uint16) []byte {
+	compressorName := make([]byte, 32)
+	return box("avc1",
+		zeros(6),
+		u16(1), // data reference index
+		zeros(16),
+		u16(width),
+		u16(height),
+		u32(0x00480000), // 72 dpi
+		u32(0x00480000),
+		zeros(4),
+		u16(1), // frame count
+		compressorName,
+		u16(0x0018), // depth
+		u16(0xFFFF),
+		avcConfigurationBox(config),
+	)
+}
+
+func sampleDescription(config *AVCDecoderConfiguration, width, height uint16) []byte {
+	return fullBox("stsd", 0, 0, u32(1), avcSampleEntry(config, width, height))
+}
+
+// NewAVCDecoderConfiguration creates a decoder configuration from H.264 parameter sets
+// using 4 Byte NAL unit length prefixes
+func NewAVCDecoderConfiguration(sps, pps []byte) *AVCDecoderConfiguration {
+	config := &AVCDecoderConfiguration{
+		LengthSize: 4,
+		SPS:        [][]byte{sps},
+		PPS:        [][]byte{pps},
+	}
+	if len(sps) >= 4 {
+		config.Profile = sps[1]
+		config.Compatibility = sps[2]
+		config.Level = sps[3]
+	}
+	return config
+}
+
+// WriteStill writes an MP4 file containing a single H.264 frame, sample contains the
+// NAL units of the frame prefixed by their length using config.LengthSize Bytes
+func WriteStill(w io.Writer, config *AVCDecoderConfiguration, width, height uint16, sample []byte) error {
+	const frameDuration = VideoTimescale / 30
+
+	ftyp := fileType("isom", "isom", "iso2", "avc1", "mp41")
+
+	buildMovie := func(chunkOffset uint32) []byte {
+		sampleTable := box("stbl",
+			sampleDescription(config, width, height),
+			fullBox("stts", 0, 0, u32(1), u32(1), u32(frameDuration)),
+			fullBox("stss", 0, 0, u32(1), u32(1)),
+			fullBox("stsc", 0, 0, u32(1), u32(1), u32(1), u32(1)),
+			fullBox("stsz", 0, 0, u32(0), u32(1), u32(uint32(len(sample)))),
+			fullBox("stco", 0, 0, u32(1), u32(chunkOffset)),
+		)
+		return box("moov",
+			movieHeader(1000, 1000*frameDuration/VideoTimescale, 2),
+			box("trak",
+				trackHeader(1, 1000*frameDuration/VideoTimescale, width, height),
+				box("mdia",
+					mediaHeader(VideoTimescale, frameDuration),
+					videoHandler(),
+					box("minf",
+						fullBox("vmhd", 0, 0x000001, zeros(8)),
+						dataInformation(),
+						sampleTable,
+					),
+				),
+			),
+		)
+	}
+
+	// The size of the movie box does not depend on the chunk offset
+	moovSize := len(buildMovie(0))
+	moov := buildMovie(uint32(len(ftyp) + moovSize + 8))
+
+	for _, part := range [][]byte{ftyp, moov, box("mdat", sample)} {
+		_, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
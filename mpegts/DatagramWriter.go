@@ -0,0 +1,34 @@
+package mpegts
+
+import "io"
+
+// DatagramSize is the amount of transport stream sent in a single UDP datagram,
+// 7 packets fit into an Ethernet frame
+const DatagramSize = 7 * PacketSize
+
+// DatagramWriter splits the transport stream into datagrams of at most DatagramSize
+type DatagramWriter struct {
+	w io.Writer
+}
+
+// NewDatagramWriter creates a writer sending to a packet oriented connection (e.g. UDP)
+func NewDatagramWriter(w io.Writer) *DatagramWriter {
+	return &DatagramWriter{w: w}
+}
+
+// Write sends p in as many datagrams as needed
+func (d *DatagramWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + DatagramSize
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := d.w.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
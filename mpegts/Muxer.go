@@ -0,0 +1,213 @@
+package mpegts
+
+import (
+	"bytes"
+	"io"
+)
+
+// PacketSize is the size of a transport stream packet
+const PacketSize = 188
+
+// Packet identifiers of the streams written by the Muxer
+const (
+	PATPID   = 0x0000
+	PMTPID   = 0x1000
+	VideoPID = 0x0100
+)
+
+// streamTypeH264 identifies an H.264 elementary stream in the PMT (ITU-T H.222.0 Table 2-34)
+const streamTypeH264 = 0x1B
+
+// programNumber is the number of the single program of the stream
+const programNumber = 1
+
+// ClockRate is the rate of PTS and the PCR base
+const ClockRate = 90000
+
+// timestampMask limits PTS and PCR to their 33 bit
+const timestampMask = 1<<33 - 1
+
+// ptsDelay is the time between the PCR and the PTS of an access unit, it is the time a
+// decoder gets to decode the access unit before presenting it
+const ptsDelay = ClockRate / 10
+
+// tableInterval is the maximum time between two PAT/PMT, they are repeated with every key frame as well
+const tableInterval = ClockRate / 10
+
+// accessUnitDelimiter starts every access unit, it is required for H.264 in transport streams
+var accessUnitDelimiter = []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0}
+
+// Muxer writes H.264 access units as an MPEG transport stream (ITU-T H.222.0) containing
+// a single program, the PCR is carried by the video stream
+type Muxer struct {
+	w          io.Writer
+	buffer     bytes.Buffer
+	continuity map[uint16]uint8
+
+	tablesWritten bool
+	lastTables    uint64
+}
+
+// NewMuxer creates a muxer writing to w, every access unit is written with a single call to w.Write
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w:          w,
+		continuity: make(map[uint16]uint8),
+	}
+}
+
+// WriteAccessUnit writes an H.264 access unit in Annex-B format, timestamp is the time of the
+// access unit in units of ClockRate and is used as PCR, it is presented ptsDelay later
+func (m *Muxer) WriteAccessUnit(data []byte, timestamp uint64, keyFrame bool) error {
+	m.buffer.Reset()
+
+	if keyFrame || !m.tablesWritten || timestamp-m.lastTables >= tableInterval {
+		m.writeSection(PATPID, programAssociationTable())
+		m.writeSection(PMTPID, programMapTable())
+		m.tablesWritten = true
+		m.lastTables = timestamp
+	}
+
+	if !startsWithDelimiter(data) {
+		data = append(append([]byte{}, accessUnitDelimiter...), data...)
+	}
+	pes := pesPacket(data, (timestamp+ptsDelay)&timestampMask)
+
+	// The first packet of the PES carries the PCR and marks random access points
+	flags := byte(0x10)
+	if keyFrame {
+		flags |= 0x40
+	}
+	adaptation := append([]byte{flags}, programClockReference(timestamp&timestampMask)...)
+	written := m.writePacket(VideoPID, true, adaptation, pes)
+	for written < len(pes) {
+		written += m.writePacket(VideoPID, false, nil, pes[written:])
+	}
+
+	_, err := m.w.Write(m.buffer.Bytes())
+	return err
+}
+
+// startsWithDelimiter returns true if the first NAL unit of data is an access unit delimiter
+func startsWithDelimiter(data []byte) bool {
+	data = bytes.TrimLeft(data, "\x00")
+	return len(data) >= 2 && data[0] == 0x01 && data[1]&0x1F == 0x09
+}
+
+// writeSection writes a PSI section into a single packet
+func (m *Muxer) writeSection(pid uint16, section []byte) {
+	// pointer_field, the section starts right after it
+	m.writePacket(pid, true, nil, append([]byte{0x00}, section...))
+}
+
+// writePacket writes a packet containing as much of payload as fits, the remaining space
+// is filled with stuffing Bytes. adaptation is the content of the adaptation field without
+// its length. It returns the number of payload Bytes written.
+func (m *Muxer) writePacket(pid uint16, start bool, adaptation []byte, payload []byte) int {
+	header := []byte{0x47, byte(pid>>8) & 0x1F, byte(pid), 0x10}
+	if start {
+		header[1] |= 0x40
+	}
+
+	space := PacketSize - len(header)
+	if adaptation != nil {
+		space -= 1 + len(adaptation)
+	}
+	if len(payload) < space {
+		stuffing := space - len(payload)
+		if adaptation == nil {
+			// The adaptation field length and flags
+			adaptation = []byte{}
+			stuffing--
+			if stuffing > 0 {
+				adaptation = append(adaptation, 0x00)
+				stuffing--
+			}
+		}
+		adaptation = append(adaptation, bytes.Repeat([]byte{0xFF}, stuffing)...)
+		space = len(payload)
+	}
+
+	if adaptation != nil {
+		header[3] |= 0x20
+	}
+	header[3] |= m.continuity[pid] & 0x0F
+	m.continuity[pid]++
+
+	m.buffer.Write(header)
+	if adaptation != nil {
+		m.buffer.WriteByte(byte(len(adaptation)))
+		m.buffer.Write(adaptation)
+	}
+	m.buffer.Write(payload[:space])
+	return space
+}
+
+// programAssociationTable announces the PMT of the program
+func programAssociationTable() []byte {
+	return psiSection(0x00, 0x0001, []byte{
+		programNumber >> 8, programNumber & 0xFF,
+		0xE0 | PMTPID>>8, PMTPID & 0xFF,
+	})
+}
+
+// programMapTable describes the video stream of the program
+func programMapTable() []byte {
+	return psiSection(0x02, programNumber, []byte{
+		0xE0 | VideoPID>>8, VideoPID & 0xFF, // PCR PID
+		0xF0, 0x00, // no program descriptors
+		streamTypeH264,
+		0xE0 | VideoPID>>8, VideoPID & 0xFF,
+		0xF0, 0x00, // no elementary stream descriptors
+	})
+}
+
+// psiSection serializes a long form PSI section including its CRC
+func psiSection(tableID byte, tableIDExtension uint16, content []byte) []byte {
+	// Table ID extension, version, section numbers, content and CRC
+	length := 5 + len(content) + 4
+	section := []byte{
+		tableID,
+		0xB0 | byte(length>>8), byte(length),
+		byte(tableIDExtension >> 8), byte(tableIDExtension),
+		0xC1, // version 0, current
+		0x00, // section number
+		0x00, // last section number
+	}
+	section = append(section, content...)
+	crc := checksum(section)
+	return append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// pesPacket wraps an access unit into a PES packet with a PTS
+func pesPacket(data []byte, pts uint64) []byte {
+	header := []byte{
+		0x00, 0x00, 0x01, 0xE0, // video stream 0
+		0x00, 0x00, // packet length
+		0x80, // marker bits
+		0x80, // PTS present
+		0x05, // header data length
+		0x21 | byte(pts>>29)&0x0E,
+		byte(pts >> 22),
+		0x01 | byte(pts>>14)&0xFE,
+		byte(pts >> 7),
+		0x01 | byte(pts<<1)&0xFE,
+	}
+	// The length is 0 (unbounded) if the packet is too large, this is only allowed for video streams
+	if length := len(header) - 6 + len(data); length <= 0xFFFF {
+		header[4], header[5] = byte(length>>8), byte(length)
+	}
+	return append(header, data...)
+}
+
+// programClockReference serializes the PCR of an adaptation field, the extension is always 0
+func programClockReference(base uint64) []byte {
+	return []byte{
+		byte(base >> 25),
+		byte(base >> 17),
+		byte(base >> 9),
+		byte(base >> 1),
+		byte(base<<7) | 0x7E,
+		0x00,
+	}
+}
@@ -0,0 +1,119 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// packets splits a transport stream by packet identifier
+func packets(t *testing.T, stream []byte) map[uint16][][]byte {
+	if len(stream)%PacketSize != 0 {
+		t.Fatalf("stream size %d is not a multiple of the packet size", len(stream))
+	}
+	result := make(map[uint16][][]byte)
+	for offset := 0; offset < len(stream); offset += PacketSize {
+		packet := stream[offset : offset+PacketSize]
+		if packet[0] != 0x47 {
+			t.Fatalf("packet at %d has no sync Byte", offset)
+		}
+		pid := binary.BigEndian.Uint16(packet[1:]) & 0x1FFF
+		result[pid] = append(result[pid], packet)
+	}
+	return result
+}
+
+// payload returns the payload of a packet following the adaptation field
+func payload(packet []byte) []byte {
+	if packet[3]&0x20 != 0 {
+		return packet[5+int(packet[4]):]
+	}
+	return packet[4:]
+}
+
+func TestMuxer(t *testing.T) {
+	buffer := bytes.Buffer{}
+	muxer := NewMuxer(&buffer)
+
+	accessUnit := append([]byte{0x00, 0x00, 0x00, 0x01, 0x65}, bytes.Repeat([]byte{0x88}, 400)...)
+	if err := muxer.WriteAccessUnit(accessUnit, 90000, true); err != nil {
+		t.Fatal(err)
+	}
+	stream := packets(t, buffer.Bytes())
+
+	pat := payload(stream[PATPID][0])
+	section := pat[1 : 1+3+int(binary.BigEndian.Uint16(pat[2:])&0x0FFF)]
+	if checksum(section) != 0 {
+		t.Errorf("invalid PAT CRC %X", section)
+	}
+	if pmtPID := binary.BigEndian.Uint16(section[10:]) & 0x1FFF; pmtPID != PMTPID {
+		t.Errorf("PAT announces PMT on PID %X", pmtPID)
+	}
+
+	pmt := payload(stream[PMTPID][0])
+	section = pmt[1 : 1+3+int(binary.BigEndian.Uint16(pmt[2:])&0x0FFF)]
+	if checksum(section) != 0 || section[12] != streamTypeH264 || binary.BigEndian.Uint16(section[13:])&0x1FFF != VideoPID {
+		t.Errorf("invalid PMT %X", section)
+	}
+
+	video := stream[VideoPID]
+	if len(video) != 3 {
+		t.Fatalf("expected 3 video packets, got %d", len(video))
+	}
+	first := video[0]
+	if first[1]&0x40 == 0 || first[5]&0x50 != 0x50 {
+		t.Errorf("first packet must start the PES and carry PCR and random access indicator: %X", first[:12])
+	}
+	if pcr := uint64(binary.BigEndian.Uint32(first[6:]))<<1 | uint64(first[10]>>7); pcr != 90000 {
+		t.Errorf("expected PCR 90000, got %d", pcr)
+	}
+
+	pes := make([]byte, 0)
+	for i, packet := range video {
+		if counter := packet[3] & 0x0F; int(counter) != i {
+			t.Errorf("packet %d has continuity counter %d", i, counter)
+		}
+		pes = append(pes, payload(packet)...)
+	}
+	pts := uint64(pes[9]>>1&0x07)<<30 | uint64(binary.BigEndian.Uint16(pes[10:])>>1)<<15 | uint64(binary.BigEndian.Uint16(pes[12:])>>1)
+	if pts != 90000+ptsDelay {
+		t.Errorf("expected PTS %d, got %d", 90000+ptsDelay, pts)
+	}
+	if length := int(binary.BigEndian.Uint16(pes[4:])); length != len(pes)-6 {
+		t.Errorf("PES length %d does not match %d", length, len(pes)-6)
+	}
+	// An access unit delimiter is inserted before the access unit
+	if !bytes.Equal(pes[14:], append(append([]byte{}, accessUnitDelimiter...), accessUnit...)) {
+		t.Errorf("unexpected PES payload %X", pes[14:])
+	}
+
+	// Tables are not repeated for the following frame
+	buffer.Reset()
+	muxer.WriteAccessUnit([]byte{0x00, 0x00, 0x01, 0x09, 0xF0, 0x00, 0x00, 0x01, 0x41, 0x9A}, 93003, false)
+	stream = packets(t, buffer.Bytes())
+	if len(stream[PATPID]) != 0 || len(stream[VideoPID]) != 1 || stream[VideoPID][0][3]&0x0F != 3 {
+		t.Errorf("unexpected packets %v", stream)
+	}
+}
+
+func TestDatagramWriter(t *testing.T) {
+	datagrams := make([]int, 0)
+	writer := NewDatagramWriter(writerFunc(func(p []byte) (int, error) {
+		datagrams = append(datagrams, len(p))
+		return len(p), nil
+	}))
+
+	n, err := writer.Write(make([]byte, 10*PacketSize))
+	if err != nil || n != 10*PacketSize {
+		t.Fatalf("unexpected result %d, %v", n, err)
+	}
+	if len(datagrams) != 2 || datagrams[0] != DatagramSize || datagrams[1] != 3*PacketSize {
+		t.Errorf("unexpected datagrams %v", datagrams)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
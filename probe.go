@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// streamProbe collects the parameters and statistics of the frames of the preview stream
+type streamProbe struct {
+	sps      *libipcamera.SequenceParameterSet
+	frames   int
+	bytes    int
+	nalUnits map[string]int
+
+	keyFrames []int
+	// gopLengths are the numbers of frames between two key frames
+	gopLengths []int
+
+	first, last      libipcamera.Frame
+	frameIntervals   []time.Duration
+	arrivalIntervals []time.Duration
+}
+
+func newStreamProbe() *streamProbe {
+	return &streamProbe{nalUnits: make(map[string]int)}
+}
+
+// add analyzes the next frame of the stream
+func (p *streamProbe) add(frame libipcamera.Frame) {
+	keyFrame := false
+	for _, nal := range frame.NALUnits() {
+		p.nalUnits[nal.TypeName()]++
+		switch nal.Type() {
+		case libipcamera.NALUnitSPS:
+			if p.sps == nil {
+				p.sps, _ = libipcamera.ParseSPS(nal)
+			}
+		case libipcamera.NALUnitIDR:
+			keyFrame = true
+		}
+	}
+
+	if p.frames > 0 {
+		p.frameIntervals = append(p.frameIntervals, frame.PTS-p.last.PTS)
+		p.arrivalIntervals = append(p.arrivalIntervals, frame.Received.Sub(p.last.Received))
+	} else {
+		p.first = frame
+	}
+	if keyFrame {
+		if len(p.keyFrames) > 0 {
+			p.gopLengths = append(p.gopLengths, p.frames-p.keyFrames[len(p.keyFrames)-1])
+		}
+		p.keyFrames = append(p.keyFrames, p.frames)
+	}
+
+	p.last = frame
+	p.frames++
+	p.bytes += len(frame.Data)
+}
+
+// report writes the stream parameters and statistics to w
+func (p *streamProbe) report(w io.Writer) error {
+	if p.frames == 0 {
+		return fmt.Errorf("no frames received")
+	}
+	out := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	if p.sps != nil {
+		config := mp4.AVCDecoderConfiguration{Profile: p.sps.Profile, Compatibility: p.sps.Constraints, Level: p.sps.Level}
+		fmt.Fprintf(out, "Codec:\tH.264 %s\n", config.ProfileName())
+		fmt.Fprintf(out, "Resolution:\t%dx%d\n", p.sps.Width, p.sps.Height)
+		if p.sps.FrameRate > 0 {
+			fmt.Fprintf(out, "Signalled frame rate:\t%.2f fps\n", p.sps.FrameRate)
+		} else {
+			fmt.Fprintf(out, "Signalled frame rate:\tnone\n")
+		}
+	} else {
+		fmt.Fprintf(out, "Codec:\tH.264, no SPS received\n")
+	}
+
+	// The span covers the frame intervals between the first and the last frame
+	span := p.last.PTS - p.first.PTS
+	fmt.Fprintf(out, "Frames:\t%d (%d key frames) in %s\n", p.frames, len(p.keyFrames), span)
+	if span > 0 {
+		fmt.Fprintf(out, "Frame rate:\t%.2f fps\n", float64(p.frames-1)/span.Seconds())
+		// The size of the first frame is not part of the span
+		fmt.Fprintf(out, "Bitrate:\t%.0f kbit/s\n", float64(p.bytes-len(p.first.Data))*8/span.Seconds()/1000)
+	}
+
+	if len(p.gopLengths) > 0 {
+		min, max, sum := p.gopLengths[0], p.gopLengths[0], 0
+		for _, length := range p.gopLengths {
+			if length < min {
+				min = length
+			}
+			if length > max {
+				max = length
+			}
+			sum += length
+		}
+		fmt.Fprintf(out, "GOP length:\t%.1f frames (min %d, max %d)\n", float64(sum)/float64(len(p.gopLengths)), min, max)
+	} else {
+		fmt.Fprintf(out, "GOP length:\tunknown, less than two key frames received\n")
+	}
+
+	if len(p.frameIntervals) > 0 {
+		fmt.Fprintf(out, "Frame interval:\t%s\n", intervalStatistics(p.frameIntervals))
+		fmt.Fprintf(out, "Arrival interval:\t%s\n", intervalStatistics(p.arrivalIntervals))
+	}
+
+	names := make([]string, 0, len(p.nalUnits))
+	for name := range p.nalUnits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := make([]string, len(names))
+	for i, name := range names {
+		counts[i] = fmt.Sprintf("%d %s", p.nalUnits[name], name)
+	}
+	fmt.Fprintf(out, "NAL units:\t%s\n", strings.Join(counts, ", "))
+
+	return out.Flush()
+}
+
+// intervalStatistics summarizes a series of intervals, the standard deviation is reported as jitter
+func intervalStatistics(intervals []time.Duration) string {
+	min, max := intervals[0], intervals[0]
+	var sum time.Duration
+	for _, interval := range intervals {
+		if interval < min {
+			min = interval
+		}
+		if interval > max {
+			max = interval
+		}
+		sum += interval
+	}
+	mean := sum / time.Duration(len(intervals))
+
+	var variance float64
+	for _, interval := range intervals {
+		deviation := float64(interval - mean)
+		variance += deviation * deviation
+	}
+	jitter := time.Duration(math.Sqrt(variance / float64(len(intervals))))
+
+	round := func(d time.Duration) time.Duration {
+		return d.Round(10 * time.Microsecond)
+	}
+	return fmt.Sprintf("%s mean, %s jitter (min %s, max %s)", round(mean), round(jitter), round(min), round(max))
+}
@@ -0,0 +1,215 @@
+package rtp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+const (
+	// DefaultMTU is the default maximum size of RTP packets (header and payload), it leaves
+	// room for IP and UDP headers and tunnel overhead within a 1500 Byte Ethernet frame
+	DefaultMTU = 1400
+	// H264PayloadType is the dynamic payload type used for H.264 streams
+	H264PayloadType = 99
+	// HeaderSize is the size of an RTP header without CSRCs and extensions
+	HeaderSize = 12
+
+	nalTypeSTAPA = 24
+	nalTypeFUA   = 28
+)
+
+// Header is the fixed header of an RTP packet (RFC 3550)
+type Header struct {
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+}
+
+// Marshal serializes the header followed by payload
+func (h Header) Marshal(payload []byte) []byte {
+	packet := make([]byte, HeaderSize+len(payload))
+	packet[0] = 0x80 // Version 2, no padding, extension or CSRCs
+	packet[1] = h.PayloadType & 0x7F
+	if h.Marker {
+		packet[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(packet[2:], h.SequenceNumber)
+	binary.BigEndian.PutUint32(packet[4:], h.Timestamp)
+	binary.BigEndian.PutUint32(packet[8:], h.SSRC)
+	copy(packet[HeaderSize:], payload)
+	return packet
+}
+
+// H264Packetizer creates RTP packets from H.264 access units as described in RFC 6184 (non-interleaved mode).
+// NAL units are sent as Single NAL Unit packets, small NAL units are aggregated into STAP-A packets and
+// NAL units exceeding the MTU are fragmented into FU-A packets.
+type H264Packetizer struct {
+	// MTU is the maximum size of a packet including the RTP header
+	MTU         int
+	PayloadType uint8
+	SSRC        uint32
+
+	sequenceNumber uint16
+}
+
+// NewH264Packetizer creates a packetizer with a random SSRC and initial sequence number
+func NewH264Packetizer(payloadType uint8, mtu int) *H264Packetizer {
+	random := make([]byte, 6)
+	rand.Read(random)
+
+	return &H264Packetizer{
+		MTU:            mtu,
+		PayloadType:    payloadType,
+		SSRC:           binary.BigEndian.Uint32(random),
+		sequenceNumber: binary.BigEndian.Uint16(random[4:]),
+	}
+}
+
+// SequenceNumber returns the sequence number of the next packet
+func (p *H264Packetizer) SequenceNumber() uint16 {
+	return p.sequenceNumber
+}
+
+// Packetize splits an access unit in Annex-B format into RTP packets, the marker bit is set on the last packet
+func (p *H264Packetizer) Packetize(accessUnit []byte, timestamp uint32) [][]byte {
+	payloads := p.payloads(SplitAnnexB(accessUnit))
+
+	packets := make([][]byte, len(payloads))
+	for i, payload := range payloads {
+		header := Header{
+			Marker:         i == len(payloads)-1,
+			PayloadType:    p.PayloadType,
+			SequenceNumber: p.sequenceNumber,
+			Timestamp:      timestamp,
+			SSRC:           p.SSRC,
+		}
+		packets[i] = header.Marshal(payload)
+		p.sequenceNumber++
+	}
+	return packets
+}
+
+// payloads creates the RTP payloads of a sequence of NAL units
+func (p *H264Packetizer) payloads(nalUnits [][]byte) [][]byte {
+	maxPayload := p.MTU - HeaderSize
+	payloads := make([][]byte, 0, len(nalUnits))
+
+	// pending NAL units are aggregated into a single packet
+	pending := make([][]byte, 0)
+	pendingSize := 1 // STAP-A NAL header
+	flush := func() {
+		switch len(pending) {
+		case 0:
+		case 1:
+			payloads = append(payloads, pending[0])
+		default:
+			payloads = append(payloads, aggregate(pending, pendingSize))
+		}
+		pending = pending[:0]
+		pendingSize = 1
+	}
+
+	for _, nal := range nalUnits {
+		if len(nal) == 0 {
+			continue
+		}
+		if len(nal) > maxPayload {
+			flush()
+			payloads = append(payloads, fragment(nal, maxPayload)...)
+			continue
+		}
+		if pendingSize+2+len(nal) > maxPayload {
+			flush()
+		}
+		pending = append(pending, nal)
+		pendingSize += 2 + len(nal)
+	}
+	flush()
+
+	return payloads
+}
+
+// aggregate creates a STAP-A payload containing multiple NAL units
+func aggregate(nalUnits [][]byte, size int) []byte {
+	payload := make([]byte, 1, size)
+	var forbidden, nri byte
+	for _, nal := range nalUnits {
+		forbidden |= nal[0] & 0x80
+		if nal[0]&0x60 > nri {
+			nri = nal[0] & 0x60
+		}
+		payload = append(payload, byte(len(nal)>>8), byte(len(nal)))
+		payload = append(payload, nal...)
+	}
+	payload[0] = forbidden | nri | nalTypeSTAPA
+	return payload
+}
+
+// fragment splits a NAL unit into FU-A payloads of at most maxPayload Bytes
+func fragment(nal []byte, maxPayload int) [][]byte {
+	indicator := nal[0]&0xE0 | nalTypeFUA
+	nalType := nal[0] & 0x1F
+	data := nal[1:]
+	chunkSize := maxPayload - 2
+
+	payloads := make([][]byte, 0, len(data)/chunkSize+1)
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		header := nalType
+		if offset == 0 {
+			header |= 0x80 // Start
+		}
+		if end == len(data) {
+			header |= 0x40 // End
+		}
+
+		payload := make([]byte, 0, 2+end-offset)
+		payload = append(payload, indicator, header)
+		payload = append(payload, data[offset:end]...)
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// SplitAnnexB splits a byte stream in Annex-B format into NAL units (without start codes),
+// data without start codes is returned as a single NAL unit
+func SplitAnnexB(data []byte) [][]byte {
+	nalUnits := make([][]byte, 0)
+
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nalUnits = append(nalUnits, trimTrailingZeros(data[start:i]))
+		}
+		start = i + 3
+		i += 2
+	}
+
+	if start < 0 {
+		if len(data) > 0 {
+			nalUnits = append(nalUnits, data)
+		}
+		return nalUnits
+	}
+	if start < len(data) {
+		nalUnits = append(nalUnits, data[start:])
+	}
+	return nalUnits
+}
+
+// trimTrailingZeros removes the leading zero of 4 Byte start codes and trailing_zero_8bits
+func trimTrailingZeros(nal []byte) []byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	return nal
+}
@@ -0,0 +1,103 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSplitAnnexB(t *testing.T) {
+	stream := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x64, 0x00,
+		0x00, 0x00, 0x01, 0x68, 0xEB,
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00,
+	}
+	nalUnits := SplitAnnexB(stream)
+	expected := [][]byte{{0x67, 0x64}, {0x68, 0xEB}, {0x65, 0x88, 0x84, 0x00}}
+	if len(nalUnits) != len(expected) {
+		t.Fatalf("expected %d NAL units, got %X", len(expected), nalUnits)
+	}
+	for i := range expected {
+		if !bytes.Equal(nalUnits[i], expected[i]) {
+			t.Errorf("NAL unit %d: expected %X, got %X", i, expected[i], nalUnits[i])
+		}
+	}
+}
+
+func TestPacketize(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1F}
+	pps := []byte{0x68, 0xEB, 0xE3}
+	idr := make([]byte, 250)
+	idr[0] = 0x65
+	for i := 1; i < len(idr); i++ {
+		idr[i] = byte(i)
+	}
+
+	accessUnit := bytes.Buffer{}
+	for _, nal := range [][]byte{sps, pps, idr} {
+		accessUnit.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		accessUnit.Write(nal)
+	}
+
+	packetizer := NewH264Packetizer(H264PayloadType, 100)
+	firstSequence := packetizer.SequenceNumber()
+	packets := packetizer.Packetize(accessUnit.Bytes(), 90000)
+
+	// SPS and PPS are aggregated, the IDR slice is fragmented into 3 packets of up to 86 Bytes payload
+	if len(packets) != 4 {
+		t.Fatalf("expected 4 packets, got %d", len(packets))
+	}
+
+	for i, packet := range packets {
+		if len(packet) > 100 {
+			t.Errorf("packet %d exceeds the MTU (%d Bytes)", i, len(packet))
+		}
+		if packet[0] != 0x80 || packet[1]&0x7F != H264PayloadType {
+			t.Errorf("packet %d: invalid header %X", i, packet[:2])
+		}
+		if marker := packet[1]&0x80 != 0; marker != (i == len(packets)-1) {
+			t.Errorf("packet %d: unexpected marker bit %t", i, marker)
+		}
+		if sequence := binary.BigEndian.Uint16(packet[2:]); sequence != firstSequence+uint16(i) {
+			t.Errorf("packet %d: expected sequence number %d, got %d", i, firstSequence+uint16(i), sequence)
+		}
+		if binary.BigEndian.Uint32(packet[4:]) != 90000 || binary.BigEndian.Uint32(packet[8:]) != packetizer.SSRC {
+			t.Errorf("packet %d: unexpected timestamp or SSRC", i)
+		}
+	}
+
+	stapA := packets[0][HeaderSize:]
+	expectedSTAPA := append([]byte{0x60 | 24, 0x00, 0x04}, sps...)
+	expectedSTAPA = append(append(expectedSTAPA, 0x00, 0x03), pps...)
+	if !bytes.Equal(stapA, expectedSTAPA) {
+		t.Errorf("expected STAP-A %X, got %X", expectedSTAPA, stapA)
+	}
+
+	// Reassemble the fragmented IDR slice
+	reassembled := []byte{}
+	for i, packet := range packets[1:] {
+		payload := packet[HeaderSize:]
+		if payload[0] != 0x60|28 {
+			t.Errorf("fragment %d: unexpected FU indicator %X", i, payload[0])
+		}
+		start, end := payload[1]&0x80 != 0, payload[1]&0x40 != 0
+		if start != (i == 0) || end != (i == 2) || payload[1]&0x1F != 5 {
+			t.Errorf("fragment %d: unexpected FU header %X", i, payload[1])
+		}
+		if start {
+			reassembled = append(reassembled, payload[0]&0xE0|payload[1]&0x1F)
+		}
+		reassembled = append(reassembled, payload[2:]...)
+	}
+	if !bytes.Equal(reassembled, idr) {
+		t.Errorf("reassembled NAL unit does not match the original")
+	}
+}
+
+func TestPacketizeSingleNALUnit(t *testing.T) {
+	packetizer := NewH264Packetizer(H264PayloadType, DefaultMTU)
+	packets := packetizer.Packetize([]byte{0x00, 0x00, 0x01, 0x41, 0x9A, 0x02}, 0)
+	if len(packets) != 1 || !bytes.Equal(packets[0][HeaderSize:], []byte{0x41, 0x9A, 0x02}) || packets[0][1]&0x80 == 0 {
+		t.Errorf("expected a single NAL unit packet with marker bit, got %X", packets)
+	}
+}
@@ -0,0 +1,163 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// RTCP packet types (RFC 3550)
+const (
+	TypeSenderReport      = 200
+	TypeReceiverReport    = 201
+	TypeSourceDescription = 202
+	TypeGoodbye           = 203
+)
+
+// ErrInvalidRTCP is returned for malformed RTCP packets
+var ErrInvalidRTCP = errors.New("Invalid RTCP packet")
+
+// ntpEpoch is the reference of NTP timestamps
+var ntpEpoch = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NTPTimestamp converts a time to the 64 bit NTP format (32 bit seconds and fraction)
+func NTPTimestamp(t time.Time) uint64 {
+	elapsed := t.Sub(ntpEpoch)
+	seconds := uint64(elapsed / time.Second)
+	fraction := uint64(elapsed%time.Second) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// SenderReport maps the RTP timestamps of a stream to wall-clock time
+type SenderReport struct {
+	SSRC        uint32
+	NTPTime     time.Time
+	RTPTime     uint32
+	PacketCount uint32
+	OctetCount  uint32
+}
+
+// Marshal serializes the report as a compound RTCP packet including the CNAME of the sender
+func (r SenderReport) Marshal(cname string) []byte {
+	packet := make([]byte, 28)
+	packet[0] = 0x80 // Version 2, no reception reports
+	packet[1] = TypeSenderReport
+	binary.BigEndian.PutUint16(packet[2:], 6)
+	binary.BigEndian.PutUint32(packet[4:], r.SSRC)
+	binary.BigEndian.PutUint64(packet[8:], NTPTimestamp(r.NTPTime))
+	binary.BigEndian.PutUint32(packet[16:], r.RTPTime)
+	binary.BigEndian.PutUint32(packet[20:], r.PacketCount)
+	binary.BigEndian.PutUint32(packet[24:], r.OctetCount)
+	return append(packet, sourceDescription(r.SSRC, cname)...)
+}
+
+// sourceDescription creates an SDES packet with a single CNAME item
+func sourceDescription(ssrc uint32, cname string) []byte {
+	if len(cname) > 255 {
+		cname = cname[:255]
+	}
+	// SSRC, CNAME item and at least one terminating null Byte padded to 32 bit
+	length := 4 + 2 + len(cname) + 1
+	length += (4 - length%4) % 4
+
+	packet := make([]byte, 4+length)
+	packet[0] = 0x81 // Version 2, one chunk
+	packet[1] = TypeSourceDescription
+	binary.BigEndian.PutUint16(packet[2:], uint16(length/4))
+	binary.BigEndian.PutUint32(packet[4:], ssrc)
+	packet[8] = 1 // CNAME
+	packet[9] = byte(len(cname))
+	copy(packet[10:], cname)
+	return packet
+}
+
+// Goodbye creates a BYE packet announcing that the source stops sending
+func Goodbye(ssrc uint32) []byte {
+	packet := make([]byte, 8)
+	packet[0] = 0x81 // Version 2, one source
+	packet[1] = TypeGoodbye
+	binary.BigEndian.PutUint16(packet[2:], 1)
+	binary.BigEndian.PutUint32(packet[4:], ssrc)
+	return packet
+}
+
+// ReceptionReport is the feedback of a receiver on a single source
+type ReceptionReport struct {
+	// Reporter is the SSRC of the receiver sending the report
+	Reporter uint32
+	// SSRC is the source the report is about
+	SSRC uint32
+	// FractionLost is the fraction of packets lost since the previous report (0-255 for 0-100%)
+	FractionLost uint8
+	// CumulativeLost is the total number of lost packets
+	CumulativeLost int32
+	// HighestSequence is the extended highest sequence number received
+	HighestSequence uint32
+	// Jitter is the interarrival jitter in RTP timestamp units
+	Jitter uint32
+	// LastSenderReport is the middle 32 bits of the NTP timestamp of the last sender report received
+	LastSenderReport uint32
+	// DelaySinceLastSenderReport in units of 1/65536 seconds
+	DelaySinceLastSenderReport uint32
+}
+
+// LossPercentage returns FractionLost in percent
+func (r ReceptionReport) LossPercentage() float64 {
+	return float64(r.FractionLost) * 100 / 256
+}
+
+// ParseReceptionReports returns the reception reports contained in the sender and receiver
+// reports of a compound RTCP packet, other packet types are skipped
+func ParseReceptionReports(data []byte) ([]ReceptionReport, error) {
+	reports := make([]ReceptionReport, 0)
+	for len(data) > 0 {
+		if len(data) < 4 || data[0]>>6 != 2 {
+			return reports, ErrInvalidRTCP
+		}
+		count := int(data[0] & 0x1F)
+		packetType := data[1]
+		length := (int(binary.BigEndian.Uint16(data[2:])) + 1) * 4
+		if length > len(data) {
+			return reports, ErrInvalidRTCP
+		}
+		packet := data[:length]
+		data = data[length:]
+
+		var blocks []byte
+		switch packetType {
+		case TypeReceiverReport:
+			if len(packet) < 8 {
+				return reports, ErrInvalidRTCP
+			}
+			blocks = packet[8:]
+		case TypeSenderReport:
+			if len(packet) < 28 {
+				return reports, ErrInvalidRTCP
+			}
+			blocks = packet[28:]
+		default:
+			continue
+		}
+
+		reporter := binary.BigEndian.Uint32(packet[4:])
+		if len(blocks) < count*24 {
+			return reports, ErrInvalidRTCP
+		}
+		for i := 0; i < count; i++ {
+			block := blocks[i*24:]
+			// The cumulative number of lost packets is a signed 24 bit value
+			lost := int32(binary.BigEndian.Uint32(block[4:])<<8) >> 8
+			reports = append(reports, ReceptionReport{
+				Reporter:                   reporter,
+				SSRC:                       binary.BigEndian.Uint32(block),
+				FractionLost:               block[4],
+				CumulativeLost:             lost,
+				HighestSequence:            binary.BigEndian.Uint32(block[8:]),
+				Jitter:                     binary.BigEndian.Uint32(block[12:]),
+				LastSenderReport:           binary.BigEndian.Uint32(block[16:]),
+				DelaySinceLastSenderReport: binary.BigEndian.Uint32(block[20:]),
+			})
+		}
+	}
+	return reports, nil
+}
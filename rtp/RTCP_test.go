@@ -0,0 +1,82 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestNTPTimestamp(t *testing.T) {
+	// 2019-04-12 15:30:01.5 UTC
+	timestamp := NTPTimestamp(time.Date(2019, 4, 12, 15, 30, 1, 500000000, time.UTC))
+	if seconds := timestamp >> 32; seconds != 3764071801 {
+		t.Errorf("expected 3764071801 seconds, got %d", seconds)
+	}
+	if fraction := uint32(timestamp); fraction != 0x80000000 {
+		t.Errorf("expected fraction 0x80000000, got %08X", fraction)
+	}
+}
+
+func TestSenderReport(t *testing.T) {
+	report := SenderReport{
+		SSRC:        0x11223344,
+		NTPTime:     time.Date(2019, 4, 12, 15, 30, 1, 0, time.UTC),
+		RTPTime:     90000,
+		PacketCount: 12,
+		OctetCount:  3456,
+	}
+	packet := report.Marshal("actioncam@test")
+
+	if packet[0] != 0x80 || packet[1] != TypeSenderReport || binary.BigEndian.Uint16(packet[2:]) != 6 {
+		t.Errorf("invalid sender report header %X", packet[:4])
+	}
+	if binary.BigEndian.Uint32(packet[16:]) != 90000 || binary.BigEndian.Uint32(packet[20:]) != 12 || binary.BigEndian.Uint32(packet[24:]) != 3456 {
+		t.Errorf("invalid sender info %X", packet[16:28])
+	}
+
+	sdes := packet[28:]
+	if sdes[1] != TypeSourceDescription || len(sdes)%4 != 0 || (int(binary.BigEndian.Uint16(sdes[2:]))+1)*4 != len(sdes) {
+		t.Errorf("invalid SDES packet %X", sdes)
+	}
+	if sdes[8] != 1 || string(sdes[10:10+int(sdes[9])]) != "actioncam@test" {
+		t.Errorf("invalid CNAME item %X", sdes[8:])
+	}
+
+	// Sender reports without reception report blocks contain no reception reports
+	reports, err := ParseReceptionReports(packet)
+	if err != nil || len(reports) != 0 {
+		t.Errorf("expected no reception reports, got %+v (%v)", reports, err)
+	}
+}
+
+func TestParseReceptionReports(t *testing.T) {
+	packet := []byte{
+		0x81, TypeReceiverReport, 0x00, 0x07,
+		0xAA, 0xBB, 0xCC, 0xDD, // Reporter
+		0x11, 0x22, 0x33, 0x44, // Source
+		0x40, 0xFF, 0xFF, 0xFE, // 25% lost, -2 cumulative
+		0x00, 0x01, 0x12, 0x34, // Highest sequence number
+		0x00, 0x00, 0x01, 0x68, // Jitter 360 (4 ms)
+		0x12, 0x34, 0x56, 0x78,
+		0x00, 0x01, 0x00, 0x00,
+	}
+	reports, err := ParseReceptionReports(append(packet, Goodbye(0xAABBCCDD)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected a single report, got %d", len(reports))
+	}
+
+	report := reports[0]
+	if report.Reporter != 0xAABBCCDD || report.SSRC != 0x11223344 || report.HighestSequence != 0x11234 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.LossPercentage() != 25 || report.CumulativeLost != -2 || report.Jitter != 360 {
+		t.Errorf("unexpected loss statistics %+v", report)
+	}
+
+	if _, err := ParseReceptionReports(packet[:20]); err != ErrInvalidRTCP {
+		t.Errorf("expected truncated packet to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package rtp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SessionDescription describes an H.264 RTP stream in SDP (RFC 4566), the format parameters
+// (RFC 6184 section 8.1) allow players to decode the stream before the first in-band SPS
+type SessionDescription struct {
+	SessionName string
+	// Address and Port the stream is sent to, a nil Address and Port 0 let the client choose (RTSP)
+	Address     net.IP
+	Port        int
+	PayloadType uint8
+	// SPS and PPS are the parameter sets of the stream without start codes, they are optional
+	SPS []byte
+	PPS []byte
+}
+
+// Marshal returns the SDP document
+func (d SessionDescription) Marshal() string {
+	address := "0.0.0.0"
+	if d.Address != nil {
+		address = d.Address.String()
+	}
+	addressType := "IP4"
+	if d.Address != nil && d.Address.To4() == nil {
+		addressType = "IP6"
+	}
+
+	// The packetizer uses Single NAL unit, STAP-A and FU-A packets
+	parameters := []string{"packetization-mode=1"}
+	if len(d.SPS) >= 4 {
+		// profile_idc, constraint flags and level_idc follow the NAL unit header
+		parameters = append(parameters, fmt.Sprintf("profile-level-id=%02X%02X%02X", d.SPS[1], d.SPS[2], d.SPS[3]))
+		if len(d.PPS) > 0 {
+			parameters = append(parameters, fmt.Sprintf("sprop-parameter-sets=%s,%s",
+				base64.StdEncoding.EncodeToString(d.SPS), base64.StdEncoding.EncodeToString(d.PPS)))
+		}
+	}
+
+	lines := []string{
+		"v=0",
+		fmt.Sprintf("o=- 0 0 IN %s %s", addressType, address),
+		fmt.Sprintf("s=%s", d.SessionName),
+		fmt.Sprintf("c=IN %s %s", addressType, address),
+		"t=0 0",
+		fmt.Sprintf("m=video %d RTP/AVP %d", d.Port, d.PayloadType),
+		fmt.Sprintf("a=rtpmap:%d H264/90000", d.PayloadType),
+		fmt.Sprintf("a=fmtp:%d %s", d.PayloadType, strings.Join(parameters, ";")),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
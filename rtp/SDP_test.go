@@ -0,0 +1,36 @@
+package rtp
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSessionDescription(t *testing.T) {
+	description := SessionDescription{
+		SessionName: "ActionCamera",
+		Address:     net.ParseIP("127.0.0.1"),
+		Port:        5220,
+		PayloadType: H264PayloadType,
+		SPS:         []byte{0x67, 0x42, 0xC0, 0x1F, 0xDA},
+		PPS:         []byte{0x68, 0xCE, 0x3C, 0x80},
+	}
+	sdp := description.Marshal()
+
+	for _, line := range []string{
+		"c=IN IP4 127.0.0.1\r\n",
+		"m=video 5220 RTP/AVP 99\r\n",
+		"a=rtpmap:99 H264/90000\r\n",
+		"a=fmtp:99 packetization-mode=1;profile-level-id=42C01F;sprop-parameter-sets=Z0LAH9o=,aM48gA==\r\n",
+	} {
+		if !strings.Contains(sdp, line) {
+			t.Errorf("expected %q in SDP:\n%s", line, sdp)
+		}
+	}
+
+	// Without parameter sets only the packetization mode is known
+	sdp = SessionDescription{SessionName: "ActionCamera", PayloadType: H264PayloadType}.Marshal()
+	if !strings.Contains(sdp, "m=video 0 RTP/AVP 99\r\n") || !strings.Contains(sdp, "a=fmtp:99 packetization-mode=1\r\n") {
+		t.Errorf("unexpected SDP:\n%s", sdp)
+	}
+}
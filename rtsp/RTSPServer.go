@@ -4,45 +4,75 @@ import (
 	"bufio"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jonas-koeritz/actioncam/libipcamera"
 )
 
 // Server implements the RTSP protocol to serve a H.264 stream
 type Server struct {
-	localIP       string
-	localPort     int
-	listener      net.Listener
-	remoteRTPPort int
-	remoteIP      string
-	rtpRelay      *libipcamera.RTPRelay
-	camera        *libipcamera.Camera
-	sdp           string
-	context       context.Context
+	// PreviewAddress is the local address the preview stream of the camera is received on
+	PreviewAddress string
+
+	localIP   string
+	localPort int
+	listener  net.Listener
+	camera    *libipcamera.Camera
+	context   context.Context
+
+	lock sync.Mutex
+	// ingest receives the preview stream once the first client starts playing
+	ingest   *libipcamera.StreamIngest
+	sessions map[string]*session
+}
+
+var errSessionNotFound = errors.New("Session has not been set up")
+
+// parameterSetTimeout is the time DESCRIBE waits for the SPS and PPS of the stream
+const parameterSetTimeout = 5 * time.Second
+
+// session is a client receiving the stream, the RTP output is created during SETUP
+// and subscribed to the stream on PLAY
+type session struct {
+	output      *libipcamera.RTPOutput
+	unsubscribe func()
+}
+
+// stop stops sending the stream to the client
+func (s *session) stop() {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+		s.unsubscribe = nil
+	}
+	if s.output != nil {
+		s.output.Close()
+		s.output = nil
+	}
 }
 
 // CreateServer creates a new Server instance
 func CreateServer(ctx context.Context, localIP string, port int, camera *libipcamera.Camera) *Server {
 	server := &Server{
-		localIP:       localIP,
-		localPort:     port,
-		camera:        camera,
-		remoteRTPPort: 0,
-		remoteIP:      "",
-		sdp:           "v=0\r\ns=ActionCamera\r\nm=video 0 RTP/AVP 99\r\na=rtpmap:99 H264/90000",
-		context:       ctx,
+		PreviewAddress: camera.PreviewAddress(),
+
+		localIP:   localIP,
+		localPort: port,
+		camera:    camera,
+		context:   ctx,
+		sessions:  make(map[string]*session),
 	}
 	return server
 }
 
 // ListenAndServe starts listening for connections and handles them
 func (s *Server) ListenAndServe() error {
-	log.Printf("%+v\n", *s)
 	listener, err := net.Listen("tcp4", fmt.Sprintf("%s:%d", s.localIP, s.localPort))
 	if err != nil {
 		return err
@@ -70,6 +100,8 @@ func (s *Server) ListenAndServe() error {
 }
 
 func (s *Server) handleClient(conn net.Conn) error {
+	defer s.closeSession(sessionID(conn))
+
 	packet := make([]string, 0)
 	scanner := bufio.NewScanner(conn)
 	for scanner.Scan() {
@@ -102,7 +134,7 @@ func (s *Server) handleRequest(packet []string, conn net.Conn) {
 		}
 	}
 
-	session := fmt.Sprintf("%X", md5.Sum([]byte(conn.RemoteAddr().String())))
+	session := sessionID(conn)
 
 	switch method {
 	case "OPTIONS":
@@ -110,11 +142,20 @@ func (s *Server) handleRequest(packet []string, conn net.Conn) {
 		replyCSeq(conn, headers)
 		conn.Write([]byte("Public: DESCRIBE, SETUP, PLAY, PAUSE, RECORD\r\n\r\n"))
 	case "DESCRIBE":
+		sdp, err := s.describe()
+		if err != nil {
+			log.Printf("ERROR starting stream: %s\n", err)
+			writeStatus(conn, 500, "Internal Server Error")
+			replyCSeq(conn, headers)
+			conn.Write([]byte("\r\n"))
+			return
+		}
+
 		writeStatus(conn, 200, "OK")
 		replyCSeq(conn, headers)
 		writeHeader(conn, "Content-Type", "application/sdp")
-		writeHeader(conn, "Content-Length", fmt.Sprintf("%d", len(s.sdp)))
-		conn.Write([]byte(fmt.Sprintf("\r\n%s", s.sdp)))
+		writeHeader(conn, "Content-Length", fmt.Sprintf("%d", len(sdp)))
+		conn.Write([]byte(fmt.Sprintf("\r\n%s", sdp)))
 	case "SETUP":
 		transportDescription := strings.Split(headers["Transport"], ";")
 		rtpDescription := transportDescription[len(transportDescription)-1]
@@ -123,28 +164,45 @@ func (s *Server) handleRequest(packet []string, conn net.Conn) {
 			log.Printf("ERROR Parsing RTP description: %s\n", err)
 			return
 		}
-		s.remoteRTPPort = int(remoteRTPPort)
-		s.remoteIP = (conn.RemoteAddr().(*net.TCPAddr)).IP.String()
-
-		log.Printf("Preparing to Stream to %s:%d\n", s.remoteIP, s.remoteRTPPort)
+		output, err := s.setupSession(session, (conn.RemoteAddr().(*net.TCPAddr)).IP, int(remoteRTPPort))
+		if err != nil {
+			log.Printf("ERROR creating RTP output: %s\n", err)
+			writeStatus(conn, 500, "Internal Server Error")
+			replyCSeq(conn, headers)
+			conn.Write([]byte("\r\n"))
+			return
+		}
+		rtpPort, rtcpPort := output.LocalPorts()
 
 		writeStatus(conn, 200, "OK")
 		replyCSeq(conn, headers)
-		writeHeader(conn, "Transport", headers["Transport"]+";ssrc=0")
+		writeHeader(conn, "Transport", fmt.Sprintf("%s;server_port=%d-%d;ssrc=%08X", headers["Transport"], rtpPort, rtcpPort, output.SSRC()))
 		writeHeader(conn, "Session", session)
 		conn.Write([]byte("\r\n"))
 
 	case "PLAY":
-		s.rtpRelay = libipcamera.CreateRTPRelay(s.context, net.ParseIP(s.remoteIP), s.remoteRTPPort)
-		s.camera.StartPreviewStream()
+		output, err := s.playSession(session)
+		if errors.Is(err, errSessionNotFound) {
+			writeStatus(conn, 454, "Session Not Found")
+			replyCSeq(conn, headers)
+			conn.Write([]byte("\r\n"))
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR starting stream: %s\n", err)
+			writeStatus(conn, 500, "Internal Server Error")
+			replyCSeq(conn, headers)
+			conn.Write([]byte("\r\n"))
+			return
+		}
 
 		writeStatus(conn, 200, "OK")
 		replyCSeq(conn, headers)
 		writeHeader(conn, "Session", session)
-		writeHeader(conn, "RTP-Info", "url="+request[1]+";seq=10;rtptime=10")
+		writeHeader(conn, "RTP-Info", fmt.Sprintf("url=%s;seq=%d", request[1], output.InitialSequenceNumber()))
 		conn.Write([]byte("\r\n"))
 	case "TEARDOWN":
-		s.rtpRelay.Stop()
+		s.closeSession(session)
 		writeStatus(conn, 200, "OK")
 		replyCSeq(conn, headers)
 		conn.Write([]byte("\r\n"))
@@ -161,6 +219,93 @@ func (s *Server) handleRequest(packet []string, conn net.Conn) {
 	}
 }
 
+func sessionID(conn net.Conn) string {
+	return fmt.Sprintf("%X", md5.Sum([]byte(conn.RemoteAddr().String())))
+}
+
+func (s *Server) setupSession(id string, remoteIP net.IP, remoteRTPPort int) (*libipcamera.RTPOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if existing, found := s.sessions[id]; found {
+		existing.stop()
+		delete(s.sessions, id)
+	}
+
+	output, err := libipcamera.CreateRTPOutput(remoteIP, remoteRTPPort)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[id] = &session{output: output}
+	log.Printf("Preparing to Stream to %s:%d\n", remoteIP, remoteRTPPort)
+	return output, nil
+}
+
+// playSession starts sending the stream to a client, the preview stream of the camera
+// is started when the first client starts playing and shared by all clients
+func (s *Server) playSession(id string) (*libipcamera.RTPOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	client, found := s.sessions[id]
+	if !found {
+		return nil, errSessionNotFound
+	}
+	if client.unsubscribe != nil {
+		return client.output, nil
+	}
+
+	ingest, err := s.startIngest()
+	if err != nil {
+		return nil, err
+	}
+	client.unsubscribe = ingest.Subscribe(client.output)
+	return client.output, nil
+}
+
+// startIngest starts receiving the preview stream of the camera if it is not yet running,
+// the caller must hold the lock
+func (s *Server) startIngest() (*libipcamera.StreamIngest, error) {
+	if s.ingest == nil {
+		ingest, err := libipcamera.CreateStreamIngest(s.context, s.PreviewAddress)
+		if err != nil {
+			return nil, err
+		}
+		s.ingest = ingest
+		s.camera.StartPreviewStream()
+	}
+	return s.ingest, nil
+}
+
+// describe returns the SDP of the stream including the parameter sets of the preview, if they
+// are not received in time the SDP lacks them and players have to wait for the in-band SPS
+func (s *Server) describe() (string, error) {
+	s.lock.Lock()
+	ingest, err := s.startIngest()
+	s.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(s.context, parameterSetTimeout)
+	defer cancel()
+	parameterSets, err := ingest.ParameterSets(ctx)
+	if err != nil {
+		log.Printf("WARNING: No parameter sets received, describing the stream without them: %s\n", err)
+	}
+	return parameterSets.SessionDescription(nil, 0), nil
+}
+
+func (s *Server) closeSession(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if client, found := s.sessions[id]; found {
+		client.stop()
+		delete(s.sessions, id)
+	}
+}
+
 func writeStatus(conn net.Conn, status int, statusWord string) {
 	conn.Write([]byte(fmt.Sprintf("RTSP/1.0 %d %s\r\n", status, statusWord)))
 }
@@ -176,4 +321,14 @@ func writeHeader(conn net.Conn, key, value string) {
 // Stop stops listening for connections
 func (s *Server) Stop() {
 	s.listener.Close()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, client := range s.sessions {
+		client.stop()
+		delete(s.sessions, id)
+	}
+	if s.ingest != nil {
+		s.ingest.Stop()
+	}
 }
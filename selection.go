@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// fileSelection holds the command line options used to select files stored on the camera
+type fileSelection struct {
+	patterns []string
+	since    string
+	until    string
+	kind     string
+	all      bool
+	latest   int
+}
+
+// timeFormats are the accepted formats for time arguments, all interpreted in local time
+var timeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeArgument parses an absolute time in one of the timeFormats or a duration
+// (e.g. 24h) relative to now
+func parseTimeArgument(value string, now time.Time) (time.Time, error) {
+	if ago, err := time.ParseDuration(value); err == nil && ago >= 0 {
+		return now.Add(-ago), nil
+	}
+	for _, format := range timeFormats {
+		t, err := time.ParseInLocation(format, value, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Cannot parse time %q, use a format like 2006-01-02, \"2006-01-02 15:04\" or a duration like 24h", value)
+}
+
+// isEmpty returns true if no selection criteria have been specified
+func (s *fileSelection) isEmpty() bool {
+	return len(s.patterns) == 0 && s.since == "" && s.until == "" && s.kind == "" && !s.all && s.latest == 0
+}
+
+// apply returns all files matching the selection, relative times are based on now.
+// Without any criteria only the latest file is selected.
+func (s *fileSelection) apply(files libipcamera.FileList, now time.Time) (libipcamera.FileList, error) {
+	if s.isEmpty() {
+		if len(files) == 0 {
+			return files, nil
+		}
+		return files[len(files)-1:], nil
+	}
+
+	for _, pattern := range s.patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+		}
+	}
+
+	if len(s.patterns) > 0 {
+		files = files.Filter(func(file libipcamera.StoredFile) bool {
+			for _, pattern := range s.patterns {
+				if matched, _ := path.Match(pattern, file.Path); matched {
+					return true
+				}
+				if matched, _ := path.Match(pattern, file.Name()); matched {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if s.kind != "" {
+		kind, err := libipcamera.ParseFileKind(s.kind)
+		if err != nil {
+			return nil, err
+		}
+		files = files.FilterByKind(kind)
+	}
+
+	if s.since != "" {
+		since, err := parseTimeArgument(s.since, now)
+		if err != nil {
+			return nil, err
+		}
+		files = files.Since(since)
+	}
+
+	if s.until != "" {
+		until, err := parseTimeArgument(s.until, now)
+		if err != nil {
+			return nil, err
+		}
+		files = files.Until(until)
+	}
+
+	if s.latest > 0 && !s.all {
+		files = latestFiles(files, s.latest)
+	}
+
+	return files, nil
+}
+
+// latestFiles returns the last count files, ordered by capture time if every file has one
+// and in the order reported by the camera otherwise
+func latestFiles(files libipcamera.FileList, count int) libipcamera.FileList {
+	ordered := make(libipcamera.FileList, len(files))
+	copy(ordered, files)
+
+	for _, file := range ordered {
+		if file.CaptureTime.IsZero() {
+			return lastFiles(ordered, count)
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].CaptureTime.Before(ordered[j].CaptureTime)
+	})
+	return lastFiles(ordered, count)
+}
+
+func lastFiles(files libipcamera.FileList, count int) libipcamera.FileList {
+	if count >= len(files) {
+		return files
+	}
+	return files[len(files)-count:]
+}
+
+// localNames returns the names the files are saved as in a single directory. Files sharing
+// a name (e.g. in MOVIE and MOVIE/RO) are prefixed with their directory on the camera, an
+// error is returned if the names still collide.
+func localNames(files libipcamera.FileList) ([]string, error) {
+	occurrences := make(map[string]int)
+	for _, file := range files {
+		occurrences[file.Name()]++
+	}
+
+	names := make([]string, len(files))
+	sources := make(map[string]string)
+	for i, file := range files {
+		name := file.Name()
+		if directory := path.Base(path.Dir(file.Path)); occurrences[name] > 1 && directory != "/" && directory != "." {
+			name = directory + "_" + name
+		}
+		if other, used := sources[name]; used {
+			return nil, fmt.Errorf("%s and %s would both be saved as %s", other, file.Path, name)
+		}
+		sources[name] = file.Path
+		names[i] = name
+	}
+	return names, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+func testFile(path string, kind libipcamera.FileKind, captureTime time.Time) libipcamera.StoredFile {
+	return libipcamera.StoredFile{Path: path, Kind: kind, CaptureTime: captureTime}
+}
+
+func paths(files libipcamera.FileList) string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func TestParseTimeArgument(t *testing.T) {
+	now := time.Date(2019, 4, 12, 15, 30, 0, 0, time.Local)
+	tests := []struct {
+		value    string
+		expected time.Time
+		valid    bool
+	}{
+		{"2019-04-12", time.Date(2019, 4, 12, 0, 0, 0, 0, time.Local), true},
+		{"2019-04-12 15:04", time.Date(2019, 4, 12, 15, 4, 0, 0, time.Local), true},
+		{"2019-04-12 15:04:05", time.Date(2019, 4, 12, 15, 4, 5, 0, time.Local), true},
+		{"2019-04-12T15:04:05", time.Date(2019, 4, 12, 15, 4, 5, 0, time.Local), true},
+		{"2019-04-12T15:04:05Z", time.Date(2019, 4, 12, 15, 4, 5, 0, time.UTC), true},
+		{"24h", now.Add(-24 * time.Hour), true},
+		{"1h30m", now.Add(-90 * time.Minute), true},
+		{"0s", now, true},
+		{"-1h", time.Time{}, false},
+		{"12.04.2019", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, test := range tests {
+		parsed, err := parseTimeArgument(test.value, now)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+			continue
+		}
+		if !parsed.Equal(test.expected) {
+			t.Errorf("%q: expected %s, got %s", test.value, test.expected, parsed)
+		}
+	}
+}
+
+func TestFileSelectionApply(t *testing.T) {
+	now := time.Date(2019, 4, 12, 18, 0, 0, 0, time.Local)
+	day := func(hour int) time.Time {
+		return time.Date(2019, 4, 12, hour, 0, 0, 0, time.Local)
+	}
+	files := libipcamera.FileList{
+		testFile("/DCIM/MOVIE/2019_0411_120000.MP4", libipcamera.KindVideo, day(12).AddDate(0, 0, -1)),
+		testFile("/DCIM/MOVIE/2019_0412_090000.MP4", libipcamera.KindVideo, day(9)),
+		testFile("/DCIM/PHOTO/2019_0412_100000.JPG", libipcamera.KindPhoto, day(10)),
+		testFile("/DCIM/MOVIE/2019_0412_160000.MP4", libipcamera.KindVideo, day(16)),
+		testFile("/DCIM/MOVIE/THM/2019_0412_160000.THM", libipcamera.KindThumbnail, day(16)),
+		testFile("/DCIM/MOVIE/CLIP.MP4", libipcamera.KindVideo, time.Time{}),
+	}
+
+	tests := []struct {
+		name      string
+		selection fileSelection
+		expected  string
+		valid     bool
+	}{
+		{"empty", fileSelection{}, "CLIP.MP4", true},
+		{"all", fileSelection{all: true}, paths(files), true},
+		{"name glob", fileSelection{patterns: []string{"*.JPG"}}, "2019_0412_100000.JPG", true},
+		{"path glob", fileSelection{patterns: []string{"/DCIM/MOVIE/THM/*"}}, "2019_0412_160000.THM", true},
+		{"multiple globs", fileSelection{patterns: []string{"*.JPG", "*.THM"}}, "2019_0412_100000.JPG,2019_0412_160000.THM", true},
+		{"invalid glob", fileSelection{patterns: []string{"[*.MP4"}}, "", false},
+		{"kind", fileSelection{kind: "Video"}, "2019_0411_120000.MP4,2019_0412_090000.MP4,2019_0412_160000.MP4,CLIP.MP4", true},
+		{"invalid kind", fileSelection{kind: "audio"}, "", false},
+		{"since", fileSelection{since: "2019-04-12 10:00"}, "2019_0412_100000.JPG,2019_0412_160000.MP4,2019_0412_160000.THM", true},
+		{"until", fileSelection{until: "2019-04-12"}, "2019_0411_120000.MP4", true},
+		{"relative", fileSelection{since: "3h", kind: "video"}, "2019_0412_160000.MP4", true},
+		{"range", fileSelection{since: "2019-04-12", until: "8h", patterns: []string{"*.MP4"}}, "2019_0412_090000.MP4", true},
+		{"invalid since", fileSelection{since: "today"}, "", false},
+		{"invalid until", fileSelection{until: "tomorrow"}, "", false},
+		{"latest", fileSelection{kind: "video", since: "2019-04-01", latest: 2}, "2019_0412_090000.MP4,2019_0412_160000.MP4", true},
+		{"latest with all", fileSelection{kind: "photo", latest: 1, all: true}, "2019_0412_100000.JPG", true},
+	}
+	for _, test := range tests {
+		selected, err := test.selection.apply(files, now)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if paths(selected) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, paths(selected))
+		}
+	}
+
+	if selected, err := (&fileSelection{}).apply(nil, now); err != nil || len(selected) != 0 {
+		t.Errorf("expected no files from an empty list, got %v (%v)", selected, err)
+	}
+}
+
+func TestLatestFiles(t *testing.T) {
+	noon := time.Date(2019, 4, 12, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		files    libipcamera.FileList
+		count    int
+		expected string
+	}{
+		{
+			"by capture time",
+			libipcamera.FileList{
+				testFile("/C.MP4", libipcamera.KindVideo, noon.Add(2*time.Hour)),
+				testFile("/A.MP4", libipcamera.KindVideo, noon),
+				testFile("/B.MP4", libipcamera.KindVideo, noon.Add(time.Hour)),
+			},
+			2, "B.MP4,C.MP4",
+		},
+		{
+			// Files captured at the same time keep the order of the camera
+			"ties",
+			libipcamera.FileList{
+				testFile("/B.MP4", libipcamera.KindVideo, noon),
+				testFile("/C.THM", libipcamera.KindThumbnail, noon.Add(time.Hour)),
+				testFile("/A.MP4", libipcamera.KindVideo, noon),
+				testFile("/C.MP4", libipcamera.KindVideo, noon.Add(time.Hour)),
+			},
+			3, "A.MP4,C.THM,C.MP4",
+		},
+		{
+			"without capture time",
+			libipcamera.FileList{
+				testFile("/B.MP4", libipcamera.KindVideo, noon),
+				testFile("/CLIP.MP4", libipcamera.KindVideo, time.Time{}),
+				testFile("/A.MP4", libipcamera.KindVideo, noon.Add(-time.Hour)),
+			},
+			2, "CLIP.MP4,A.MP4",
+		},
+		{
+			"more than available",
+			libipcamera.FileList{testFile("/A.MP4", libipcamera.KindVideo, noon)},
+			5, "A.MP4",
+		},
+	}
+	for _, test := range tests {
+		original := paths(test.files)
+		latest := latestFiles(test.files, test.count)
+		if paths(latest) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, paths(latest))
+		}
+		if paths(test.files) != original {
+			t.Errorf("%s: the list has been reordered", test.name)
+		}
+	}
+}
+
+func TestLocalNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    libipcamera.FileList
+		expected string
+		valid    bool
+	}{
+		{
+			"unique",
+			libipcamera.FileList{{Path: "/DCIM/MOVIE/A.MP4"}, {Path: "/DCIM/PHOTO/B.JPG"}},
+			"A.MP4,B.JPG", true,
+		},
+		{
+			"same name in different directories",
+			libipcamera.FileList{{Path: "/DCIM/MOVIE/A.MP4"}, {Path: "/DCIM/MOVIE/RO/A.MP4"}, {Path: "/DCIM/MOVIE/B.MP4"}},
+			"MOVIE_A.MP4,RO_A.MP4,B.MP4", true,
+		},
+		{
+			"prefixed name still colliding",
+			libipcamera.FileList{{Path: "/A/RO/A.MP4"}, {Path: "/B/RO/A.MP4"}},
+			"", false,
+		},
+		{
+			"prefixed name colliding with another file",
+			libipcamera.FileList{{Path: "/DCIM/RO/A.MP4"}, {Path: "/DCIM/A.MP4"}, {Path: "/DCIM/RO_A.MP4"}},
+			"", false,
+		},
+	}
+	for _, test := range tests {
+		names, err := localNames(test.files)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if strings.Join(names, ",") != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, strings.Join(names, ","))
+		}
+	}
+}
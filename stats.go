@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// formatStats returns a single line summary of the stream statistics
+func formatStats(stats libipcamera.StreamStats) string {
+	return fmt.Sprintf("%5.1f fps  %7.1f kbit/s  frames %d (%d key)  packets %d  lost %d  invalid %d  unknown %d  max gap %s",
+		stats.FrameRate, stats.Bitrate/1000, stats.Frames, stats.KeyFrames, stats.Packets,
+		stats.LostPackets, stats.InvalidPackets, stats.UnknownMessageCount(), stats.MaxFrameGap.Round(time.Millisecond))
+}
+
+// reportStats writes the totals of a monitoring session including the unknown message types
+func reportStats(w io.Writer, stats libipcamera.StreamStats) error {
+	lines := []string{
+		fmt.Sprintf("Frames:           %d (%d key frames)", stats.Frames, stats.KeyFrames),
+		fmt.Sprintf("Data:             %.1f MiB", float64(stats.Bytes)/(1024*1024)),
+		fmt.Sprintf("Packets:          %d", stats.Packets),
+		fmt.Sprintf("Lost packets:     %d", stats.LostPackets),
+		fmt.Sprintf("Invalid packets:  %d", stats.InvalidPackets),
+		fmt.Sprintf("Max frame gap:    %s", stats.MaxFrameGap.Round(time.Millisecond)),
+	}
+	if !stats.Started.IsZero() && !stats.LastFrame.IsZero() {
+		lines = append(lines, fmt.Sprintf("Duration:         %s", stats.LastFrame.Sub(stats.Started).Round(time.Second)))
+	}
+
+	messageTypes := make([]int, 0, len(stats.UnknownMessages))
+	for messageType := range stats.UnknownMessages {
+		messageTypes = append(messageTypes, int(messageType))
+	}
+	sort.Ints(messageTypes)
+	for _, messageType := range messageTypes {
+		lines = append(lines, fmt.Sprintf("Unknown 0x%04X:   %d messages", messageType, stats.UnknownMessages[uint16(messageType)]))
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
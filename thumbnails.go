@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonas-koeritz/actioncam/download"
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+	"github.com/jonas-koeritz/actioncam/mp4"
+)
+
+// thumbnail is a preview image of a video stored on the camera
+type thumbnail struct {
+	Video libipcamera.StoredFile
+	// File is the path of the preview relative to the contact sheet
+	File string
+	// IsVideo is true if the preview is a single frame MP4 file instead of an image
+	IsVideo bool
+}
+
+// fileStem returns the name of a file without directory and extension
+func fileStem(name string) string {
+	name = path.Base(name)
+	return strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// cameraThumbnail returns the thumbnail the camera created for a video (if any)
+func cameraThumbnail(files libipcamera.FileList, video libipcamera.StoredFile) (libipcamera.StoredFile, bool) {
+	for _, file := range files.FilterByKind(libipcamera.KindThumbnail) {
+		if fileStem(file.Path) == fileStem(video.Path) {
+			return file, true
+		}
+	}
+	return libipcamera.StoredFile{}, false
+}
+
+// extractKeyframe reads the first key frame of a video stored on the camera using HTTP Range
+// requests and writes it to destination as a single frame MP4 file
+func extractKeyframe(ctx context.Context, camera *libipcamera.Camera, video libipcamera.StoredFile, destination string) error {
+	remote := camera.OpenFile(ctx, video)
+	file, err := mp4.Open(remote, remote.Size())
+	if err != nil {
+		return err
+	}
+
+	track, found := file.VideoTrack()
+	if !found || track.AVCConfig == nil {
+		return errors.New("File contains no H.264 video track")
+	}
+
+	keyframe, found := track.FirstSyncSample()
+	if !found {
+		return errors.New("Video track contains no key frame")
+	}
+	sample, err := track.ReadSample(keyframe)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	err = mp4.WriteStill(out, track.AVCConfig, uint16(track.Width), uint16(track.Height), sample)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// fetchThumbnail stores a preview of a video in dir, using the cameras own thumbnail if it exists
+func fetchThumbnail(ctx context.Context, camera *libipcamera.Camera, files libipcamera.FileList, video libipcamera.StoredFile, dir string) (thumbnail, error) {
+	if cameraFile, found := cameraThumbnail(files, video); found {
+		name := fileStem(video.Path) + ".jpg"
+		_, err := download.File(ctx, download.Job{
+			URL:  camera.FileURL(cameraFile.Path),
+			Path: filepath.Join(dir, name),
+			Size: cameraFile.Size,
+		}, download.DefaultAttempts, nil)
+		return thumbnail{Video: video, File: name}, err
+	}
+
+	name := fileStem(video.Path) + ".mp4"
+	err := extractKeyframe(ctx, camera, video, filepath.Join(dir, name))
+	return thumbnail{Video: video, File: name, IsVideo: true}, err
+}
+
+var contactSheetTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>actioncam thumbnails</title>
+<style>
+body { font-family: sans-serif; background: #222; color: #eee; }
+.sheet { display: flex; flex-wrap: wrap; gap: 12px; }
+figure { margin: 0; width: 320px; }
+img, video { width: 320px; height: 180px; object-fit: cover; background: #000; }
+figcaption { font-size: 12px; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>{{len .}} Videos</h1>
+<div class="sheet">
+{{range .}}<figure>
+{{if .IsVideo}}<video src="{{.File}}" preload="auto" muted></video>{{else}}<img src="{{.File}}" alt="{{.Video.Name}}">{{end}}
+<figcaption>{{.Video.Path}}<br>{{if not .Video.CaptureTime.IsZero}}{{.Video.CaptureTime.Format "2006-01-02 15:04:05"}} &middot; {{end}}{{.Video.Size}} Bytes</figcaption>
+</figure>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// writeContactSheet writes an HTML index of all thumbnails into dir
+func writeContactSheet(dir string, thumbnails []thumbnail) error {
+	out, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	err = contactSheetTemplate.Execute(out, thumbnails)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
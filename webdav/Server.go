@@ -0,0 +1,330 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/camerafiles"
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+// Server serves the files stored on the cameras SD-Card as a read-only WebDAV tree
+type Server struct {
+	source  camerafiles.Source
+	files   *camerafiles.CachedList
+	client  *http.Client
+	started time.Time
+
+	lock sync.Mutex
+	tree *tree
+	// loaded is the time the file list of tree has been loaded
+	loaded time.Time
+}
+
+// NewServer creates a new Server serving the files of source
+func NewServer(source camerafiles.Source) *Server {
+	return &Server{
+		source:  source,
+		files:   camerafiles.NewCachedList(source),
+		client:  &http.Client{},
+		started: time.Now(),
+	}
+}
+
+// node is a file or directory in the served tree
+type node struct {
+	name     string
+	path     string
+	file     *libipcamera.StoredFile
+	children map[string]*node
+	modified time.Time
+}
+
+func (n *node) isDirectory() bool {
+	return n.file == nil
+}
+
+type tree struct {
+	nodes map[string]*node
+}
+
+// buildTree creates the directory structure of all files, fallbackTime is used for files without a capture time
+func buildTree(files libipcamera.FileList, fallbackTime time.Time) *tree {
+	t := &tree{nodes: make(map[string]*node)}
+	t.nodes["/"] = &node{name: "", path: "/", children: make(map[string]*node)}
+
+	for i := range files {
+		file := files[i]
+		filePath := path.Clean("/" + file.Path)
+		modified := file.CaptureTime
+		if modified.IsZero() {
+			modified = fallbackTime
+		}
+		if !t.add(&node{name: path.Base(filePath), path: filePath, file: &file, modified: modified}) {
+			log.Printf("WARNING: Skipping %s, the path conflicts with another file or directory\n", file.Path)
+		}
+	}
+
+	// Directories are as old as their newest file
+	for _, n := range t.nodes {
+		if n.isDirectory() && n.modified.IsZero() {
+			n.modified = fallbackTime
+		}
+	}
+	return t
+}
+
+// add inserts a node and creates all of its parent directories. Nodes are not added if
+// their path is the root, already exists or if a parent is a file.
+func (t *tree) add(n *node) bool {
+	if _, exists := t.nodes[n.path]; exists || n.path == "/" {
+		return false
+	}
+	parent := t.directory(path.Dir(n.path))
+	if parent == nil {
+		return false
+	}
+	t.nodes[n.path] = n
+	parent.children[n.name] = n
+
+	for directory := parent; ; directory = t.nodes[path.Dir(directory.path)] {
+		if n.modified.After(directory.modified) {
+			directory.modified = n.modified
+		}
+		if directory.path == "/" {
+			break
+		}
+	}
+	return true
+}
+
+// directory returns the directory node of a path, it is created if it does not exist.
+// nil is returned if the path (or one of its parents) is a file.
+func (t *tree) directory(directoryPath string) *node {
+	if n, exists := t.nodes[directoryPath]; exists {
+		if !n.isDirectory() {
+			return nil
+		}
+		return n
+	}
+	n := &node{name: path.Base(directoryPath), path: directoryPath, children: make(map[string]*node)}
+	if !t.add(n) {
+		return nil
+	}
+	return n
+}
+
+// currentTree returns the tree of files, it is rebuilt when the file list has been refreshed
+func (s *Server) currentTree() (*tree, error) {
+	files, loaded, err := s.files.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.tree == nil || !loaded.Equal(s.loaded) {
+		s.tree = buildTree(files, s.started)
+		s.loaded = loaded
+	}
+	return s.tree, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+		return
+	case "PROPFIND", http.MethodGet, http.MethodHead:
+	default:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+		http.Error(w, "The camera is served read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, err := s.currentTree()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Could not load file list: %s", err), http.StatusBadGateway)
+		return
+	}
+
+	requestPath := path.Clean("/" + r.URL.Path)
+	n, found := t.nodes[requestPath]
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == "PROPFIND":
+		s.propfind(w, r, n)
+	case n.isDirectory():
+		s.listDirectory(w, r, n)
+	default:
+		s.serveFile(w, r, n)
+	}
+}
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"D:multistatus"`
+	Namespace string     `xml:"xmlns:D,attr"`
+	Responses []response `xml:"D:response"`
+}
+
+type response struct {
+	Href     string   `xml:"D:href"`
+	Propstat propstat `xml:"D:propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"D:prop"`
+	Status string `xml:"D:status"`
+}
+
+type prop struct {
+	DisplayName   string       `xml:"D:displayname"`
+	ResourceType  resourceType `xml:"D:resourcetype"`
+	ContentLength string       `xml:"D:getcontentlength,omitempty"`
+	ContentType   string       `xml:"D:getcontenttype,omitempty"`
+	LastModified  string       `xml:"D:getlastmodified"`
+	CreationDate  string       `xml:"D:creationdate"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+func (s *Server) propfind(w http.ResponseWriter, r *http.Request, n *node) {
+	depth := r.Header.Get("Depth")
+	if strings.EqualFold(depth, "infinity") {
+		// RFC 4918 allows servers to refuse infinite depth requests
+		http.Error(w, "Depth infinity is not supported", http.StatusForbidden)
+		return
+	}
+	if depth == "" {
+		// Clients omitting the header expect a directory listing
+		depth = "1"
+	}
+
+	result := multistatus{Namespace: "DAV:"}
+	result.Responses = append(result.Responses, propertiesOf(n))
+	if depth == "1" && n.isDirectory() {
+		for _, child := range sortedChildren(n) {
+			result.Responses = append(result.Responses, propertiesOf(child))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Encode(result)
+}
+
+func propertiesOf(n *node) response {
+	properties := prop{
+		DisplayName:  n.name,
+		LastModified: n.modified.UTC().Format(http.TimeFormat),
+		CreationDate: n.modified.UTC().Format(time.RFC3339),
+	}
+	if n.isDirectory() {
+		properties.ResourceType.Collection = &struct{}{}
+	} else {
+		properties.ContentLength = strconv.FormatUint(n.file.Size, 10)
+		properties.ContentType = n.file.ContentType()
+	}
+
+	return response{
+		Href: href(n),
+		Propstat: propstat{
+			Prop:   properties,
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+// href returns the escaped URL path of a node, directories end with a slash
+func href(n *node) string {
+	segments := strings.Split(n.path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escaped := strings.Join(segments, "/")
+	if n.isDirectory() && !strings.HasSuffix(escaped, "/") {
+		escaped += "/"
+	}
+	return escaped
+}
+
+func sortedChildren(n *node) []*node {
+	children := make([]*node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}}</title></head>
+<body><h1>{{.Path}}</h1><ul>
+{{range .Children}}<li><a href="{{.Href}}">{{.Name}}</a>{{if .Size}} ({{.Size}} Bytes){{end}}</li>
+{{end}}</ul></body></html>
+`))
+
+// listDirectory renders a simple HTML listing for browsers
+func (s *Server) listDirectory(w http.ResponseWriter, r *http.Request, n *node) {
+	type entry struct {
+		Name string
+		Href string
+		Size uint64
+	}
+	entries := make([]entry, 0, len(n.children))
+	for _, child := range sortedChildren(n) {
+		e := entry{Name: child.name, Href: href(child)}
+		if !child.isDirectory() {
+			e.Size = child.file.Size
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	listingTemplate.Execute(w, struct {
+		Path     string
+		Children []entry
+	}{n.path, entries})
+}
+
+// serveFile proxies a GET request (including its Range header) to the cameras HTTP server
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, n *node) {
+	w.Header().Set("Content-Type", n.file.ContentType())
+	w.Header().Set("Last-Modified", n.modified.UTC().Format(http.TimeFormat))
+
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatUint(n.file.Size, 10))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	camerafiles.Proxy(s.client, w, r, s.source.FileURL(n.file.Path))
+}
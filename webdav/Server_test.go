@@ -0,0 +1,126 @@
+package webdav
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonas-koeritz/actioncam/libipcamera"
+)
+
+type testSource struct {
+	files     libipcamera.FileList
+	cameraURL string
+}
+
+func (s *testSource) GetFileList() (libipcamera.FileList, error) {
+	return s.files, nil
+}
+
+func (s *testSource) FileURL(path string) string {
+	return s.cameraURL + path
+}
+
+func TestServer(t *testing.T) {
+	content := []byte("0123456789")
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Now(), bytes.NewReader(content))
+	}))
+	defer camera.Close()
+
+	source := &testSource{
+		files: libipcamera.FileList{
+			{Path: "/DCIM/MOVIE/2019_0412_153001.MP4", Size: 10, CaptureTime: time.Date(2019, 4, 12, 15, 30, 1, 0, time.UTC)},
+			{Path: "/DCIM/PHOTO/IMG 0001.JPG", Size: 10},
+		},
+		cameraURL: camera.URL,
+	}
+	server := httptest.NewServer(NewServer(source))
+	defer server.Close()
+
+	request, _ := http.NewRequest("PROPFIND", server.URL+"/DCIM/", nil)
+	request.Header.Set("Depth", "1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("expected status 207, got %d", response.StatusCode)
+	}
+	for _, expected := range []string{"<D:href>/DCIM/</D:href>", "<D:href>/DCIM/MOVIE/</D:href>", "<D:href>/DCIM/PHOTO/</D:href>", "<D:collection></D:collection>"} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected response to contain %s:\n%s", expected, body)
+		}
+	}
+
+	request, _ = http.NewRequest("PROPFIND", server.URL+"/DCIM/PHOTO/IMG%200001.JPG", nil)
+	request.Header.Set("Depth", "0")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	for _, expected := range []string{"<D:href>/DCIM/PHOTO/IMG%200001.JPG</D:href>", "<D:getcontentlength>10</D:getcontentlength>", "<D:getcontenttype>image/jpeg</D:getcontenttype>"} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected response to contain %s:\n%s", expected, body)
+		}
+	}
+
+	request, _ = http.NewRequest(http.MethodGet, server.URL+"/DCIM/MOVIE/2019_0412_153001.MP4", nil)
+	request.Header.Set("Range", "bytes=2-5")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusPartialContent || string(body) != "2345" {
+		t.Errorf("expected partial content 2345, got %d %q", response.StatusCode, body)
+	}
+	if response.Header.Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("unexpected Content-Range %q", response.Header.Get("Content-Range"))
+	}
+
+	request, _ = http.NewRequest(http.MethodPut, server.URL+"/DCIM/new.MP4", nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected PUT to be rejected, got %d", response.StatusCode)
+	}
+}
+
+func TestBuildTreeConflicts(t *testing.T) {
+	files := libipcamera.FileList{
+		{Path: "/", Size: 1},
+		{Path: "/DCIM/MOVIE", Size: 2},
+		{Path: "/DCIM/MOVIE/2019_0412_153001.MP4", Size: 3},
+		{Path: "/DCIM/PHOTO/IMG0001.JPG", Size: 4},
+		{Path: "/DCIM/PHOTO", Size: 5},
+	}
+	tree := buildTree(files, time.Now())
+
+	root := tree.nodes["/"]
+	if !root.isDirectory() || len(root.children) != 1 {
+		t.Fatalf("expected the root to stay a directory, got %+v", root)
+	}
+	if n := tree.nodes["/DCIM/MOVIE"]; n == nil || n.isDirectory() {
+		t.Errorf("expected /DCIM/MOVIE to be a file, got %+v", n)
+	}
+	if _, exists := tree.nodes["/DCIM/MOVIE/2019_0412_153001.MP4"]; exists {
+		t.Error("expected the file below a file to be skipped")
+	}
+	if n := tree.nodes["/DCIM/PHOTO"]; n == nil || !n.isDirectory() || len(n.children) != 1 {
+		t.Errorf("expected /DCIM/PHOTO to stay a directory, got %+v", n)
+	}
+}